@@ -1,120 +1,74 @@
-package main
+package bfs
 
 import (
 	"math/rand"
 	"net"
-	"time"
-	"os"
-	"strconv"
+	"sort"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+	"analytics/graph"
+	"analytics/seed"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-type Flow struct {
-	SourceIP        net.IP
-	DestinationIP   net.IP
-	SourcePort      uint16
-	DestinationPort uint16
-	Protocol        uint8
-	ByteCount       uint32
-}
-
 type Node struct {
-	ip   net.IP
+	ip    net.IP
 	edges []*Node
 }
 
-func main() {
-
-	log.Info().Msgf("%v", os.Args)
-
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
-
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
-	if len(os.Args) != 4 {
-		log.Error().Msg("Usage: ./bfs <node_count> <edgeSampleSize> <freq>")
-		os.Exit(1)
-	}
-
-	nodes, err := strconv.Atoi(os.Args[1])
-	if err != nil {
-		log.Error().Msg("Error: Invalid node_count")
-		os.Exit(1)
-	}
-
-	edgeSampleSize, err := strconv.Atoi(os.Args[2])
-	if err != nil {
-		log.Error().Msg("Error: Invalid edgeSampleSize")
-		os.Exit(1)
-	}
-
-	freq, err := strconv.Atoi(os.Args[3])
-	if err != nil {
-		log.Error().Msg("Error: Invalid run frequency")
-		os.Exit(1)
-	}
-
-
-	rand.Seed(time.Now().UnixNano())
-	nodeCount := nodes
-	edgeCount := edgeSampleSize
-	flows := generateFlows(nodeCount, edgeCount)
-
-	nodeList := createNetworkFromFlows(flows)
-
+// BFS walks the flow graph breadth first from a random host on every run.
+type BFS struct {
+	exportPath string
+	rand       *rand.Rand
+	flows      []flow.Flow
+	nodeList   []*Node
+	startNode  *Node
+}
 
-	ticker := time.NewTicker(time.Duration(freq) * time.Second)
+func init() {
+	analytic.Register("bfs", func() analytic.Analytic { return &BFS{} })
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			startNode := nodeList[rand.Intn(len(nodeList))]
-			start := time.Now()
-			bfs(nodeList, startNode)
-			elapsed := time.Since(start)
-			elapsedMS := elapsed.Microseconds()
+// Init takes an optional graph export path, whose extension picks the format.
+func (b *BFS) Init(cfg *config.Config) error {
+	b.exportPath = cfg.BFS.ExportPath
+	b.rand = seed.New(cfg.Seed, "bfs")
+	return nil
+}
 
-			log.Info().Time("start", start).Int("nodes", nodes).Int("edgesamplesize", edgeSampleSize).Int64("elapsed", elapsedMS).Msgf("Computation with node count %d and edge sample %d took %s\n", nodes, edgeSampleSize, elapsed)
+func (b *BFS) Ingest(flows []flow.Flow) error {
+	b.flows = append(b.flows, flows...)
+	b.nodeList = createNetworkFromFlows(b.flows)
 
+	if b.exportPath != "" {
+		if err := graph.Export(b.exportPath, b.flows); err != nil {
+			return err
 		}
+		log.Info().Str("path", b.exportPath).Msg("Exported flow graph")
 	}
+	return nil
 }
 
-func generateIPs(nodeCount int) []net.IP {
-	ips := make([]net.IP, nodeCount)
-	for i := 0; i < nodeCount; i++ {
-		ips[i] = net.IPv4(byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256)))
+func (b *BFS) Run() error {
+	if len(b.nodeList) == 0 {
+		return nil
 	}
-	return ips
+	b.startNode = b.nodeList[b.rand.Intn(len(b.nodeList))]
+	bfs(b.nodeList, b.startNode)
+	return nil
 }
 
-func generateFlows(nodeCount, edgeCount int) []Flow {
-	ips := generateIPs(nodeCount)
-	flows := make([]Flow, edgeCount)
-
-	for i := 0; i < edgeCount; i++ {
-		srcIP := ips[rand.Intn(nodeCount)]
-		dstIP := ips[rand.Intn(nodeCount)]
-		for srcIP.Equal(dstIP) {
-			dstIP = ips[rand.Intn(nodeCount)]
-		}
-
-		flows[i] = Flow{
-			SourceIP:        srcIP,
-			DestinationIP:   dstIP,
-			SourcePort:      uint16(rand.Uint32() % 65536),
-			DestinationPort: uint16(rand.Uint32() % 65536),
-			Protocol:        uint8(rand.Intn(3)),
-			ByteCount:       rand.Uint32() % 100000,
-		}
+func (b *BFS) Report(e *zerolog.Event) {
+	if b.startNode != nil {
+		e.Str("startnode", b.startNode.ip.String())
 	}
-
-	return flows
 }
 
-func createNetworkFromFlows(flows []Flow) []*Node {
+func createNetworkFromFlows(flows []flow.Flow) []*Node {
 	nodes := make(map[string]*Node)
 
 	for _, flow := range flows {
@@ -139,11 +93,14 @@ func createNetworkFromFlows(flows []Flow) []*Node {
 	return nodesList(nodes)
 }
 
+// nodesList orders the nodes by address so that the same seed picks the same
+// start nodes.
 func nodesList(nodesMap map[string]*Node) []*Node {
 	nodes := make([]*Node, 0, len(nodesMap))
 	for _, node := range nodesMap {
 		nodes = append(nodes, node)
 	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ip.String() < nodes[j].ip.String() })
 	return nodes
 }
 
@@ -167,5 +124,3 @@ func bfs(nodes []*Node, startNode *Node) {
 		}
 	}
 }
-
-
@@ -1,11 +0,0 @@
-module kullbackleibler
-
-go 1.18
-
-require github.com/rs/zerolog v1.29.1
-
-require (
-	github.com/mattn/go-colorable v0.1.12 // indirect
-	github.com/mattn/go-isatty v0.0.14 // indirect
-	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
-)
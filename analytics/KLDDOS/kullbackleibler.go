@@ -1,60 +1,64 @@
-package main
+package klddos
 
 import (
-	"fmt"
 	"math"
-	"math/rand"
-	"net"
-	"time"
-	"os"
-	"strconv"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+	"analytics/seed"
 
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
-type Flow struct {
-	SourceIP        net.IP
-	DestinationIP   net.IP
-	SourcePort      uint16
-	DestinationPort uint16
-	Protocol        uint8
-	ByteCount       uint32
+// KLDDOS compares the byte count distribution of the observed flows with that
+// of a normal traffic sample and reports a DDoS when they diverge.
+type KLDDOS struct {
+	normalFlows   []flow.Flow
+	observedFlows []flow.Flow
+	numBins       int
+	threshold     float64
+	kld           float64
+	detected      bool
 }
 
-func generateIPs(nodeCount int) []net.IP {
-	ips := make([]net.IP, nodeCount)
-	for i := 0; i < nodeCount; i++ {
-		ips[i] = net.IPv4(byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256)))
-	}
-	return ips
+func init() {
+	analytic.Register("klddos", func() analytic.Analytic { return &KLDDOS{} })
 }
 
-func generateFlows(nodeCount, edgeCount int) []Flow {
-	ips := generateIPs(nodeCount)
-	flows := make([]Flow, edgeCount)
+// Init generates the normal traffic sample the observed flows are compared to.
+func (k *KLDDOS) Init(cfg *config.Config) error {
+	k.numBins = cfg.KLDDOS.Bins
+	k.threshold = cfg.KLDDOS.Threshold
+	k.normalFlows = flow.NewGenerator(seed.New(cfg.Seed, "klddos")).Flows(cfg.Nodes, cfg.EdgeSampleSize)
+	return nil
+}
 
-	for i := 0; i < edgeCount; i++ {
-		srcIP := ips[rand.Intn(nodeCount)]
-		dstIP := ips[rand.Intn(nodeCount)]
-		for srcIP.Equal(dstIP) {
-			dstIP = ips[rand.Intn(nodeCount)]
-		}
+func (k *KLDDOS) Ingest(flows []flow.Flow) error {
+	k.observedFlows = append(k.observedFlows, flows...)
+	return nil
+}
 
-		flows[i] = Flow{
-			SourceIP:        srcIP,
-			DestinationIP:   dstIP,
-			SourcePort:      uint16(rand.Uint32() % 65536),
-			DestinationPort: uint16(rand.Uint32() % 65536),
-			Protocol:        uint8(rand.Intn(3)),
-			ByteCount:       rand.Uint32() % 100000,
-		}
+func (k *KLDDOS) Run() error {
+	if len(k.observedFlows) == 0 {
+		return nil
 	}
+	k.kld, k.detected = compute(k.normalFlows, k.observedFlows, k.numBins, k.threshold)
+	return nil
+}
+
+func (k *KLDDOS) Report(e *zerolog.Event) {
+	e.Float64("kld", k.kld).Bool("ddos", k.detected)
+}
 
-	return flows
+func (k *KLDDOS) Detections() int {
+	if k.detected {
+		return 1
+	}
+	return 0
 }
 
-func createHistogram(flows []Flow, numBins int) []int {
+func createHistogram(flows []flow.Flow, numBins int) []int {
 	histogram := make([]int, numBins)
 	maxBytes := uint32(0)
 
@@ -102,66 +106,7 @@ func normalizeHistogram(histogram []int) []float64 {
 	return normalized
 }
 
-func main() {
-
-	log.Info().Msgf("%v", os.Args)
-
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
-
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
-	if len(os.Args) != 4 {
-		log.Error().Msg("Usage: ./baseline <node_count> <edgeSampleSize> <freq>")
-		os.Exit(1)
-	}
-
-	nodes, err := strconv.Atoi(os.Args[1])
-	if err != nil {
-		log.Error().Msg("Error: Invalid node_count")
-		os.Exit(1)
-	}
-
-	edgeSampleSize, err := strconv.Atoi(os.Args[2])
-	if err != nil {
-		log.Error().Msg("Error: Invalid edgeSampleSize")
-		os.Exit(1)
-	}
-
-	freq, err := strconv.Atoi(os.Args[3])
-	if err != nil {
-		log.Error().Msg("Error: Invalid run frequency")
-		os.Exit(1)
-	}
-
-	rand.Seed(time.Now().UnixNano())
-
-	nodeCount := nodes
-	normalEdgeCount := edgeSampleSize
-	attackEdgeCount := edgeSampleSize // Simulating an increase in traffic volume (e.g., due to a DDoS attack)
-
-	normalFlows := generateFlows(nodeCount, normalEdgeCount)
-	attackFlows := generateFlows(nodeCount, attackEdgeCount)
-
-
-	ticker := time.NewTicker(time.Duration(freq) * time.Second)
-
-	for {
-		select {
-		case <-ticker.C:
-			start := time.Now()
-			compute(normalFlows, attackFlows)
-			elapsed := time.Since(start)
-			elapsedMS := elapsed.Microseconds()
-
-			log.Info().Time("start", start).Int("nodes", nodes).Int("edgesamplesize", edgeSampleSize).Int64("elapsed", elapsedMS).Msgf("Computation with node count %d and edge sample %d took %s\n", nodes, edgeSampleSize, elapsed)
-
-		}
-	}
-}
-
-func compute(flowset1, flowset2 []Flow) {
-	numBins := 10
-
+func compute(flowset1, flowset2 []flow.Flow, numBins int, threshold float64) (float64, bool) {
 	histNormal := createHistogram(flowset1, numBins)
 	histAttack := createHistogram(flowset2, numBins)
 
@@ -169,12 +114,6 @@ func compute(flowset1, flowset2 []Flow) {
 	normalizedHistAttack := normalizeHistogram(histAttack)
 
 	kld := calculateKLD(normalizedHistNormal, normalizedHistAttack)
-	fmt.Printf("Kullback-Leibler Divergence: %f\n", kld)
 
-	threshold := 0.5
-	if kld > threshold {
-		fmt.Println("DDoS attack detected!")
-	} else {
-		fmt.Println("No DDoS attack detected.")
-	}
-}
\ No newline at end of file
+	return kld, kld > threshold
+}
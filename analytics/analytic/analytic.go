@@ -0,0 +1,61 @@
+// Package analytic defines the interface every detection analytic implements
+// and the registry the runner looks them up in by name.
+package analytic
+
+import (
+	"fmt"
+	"sort"
+
+	"analytics/config"
+	"analytics/flow"
+
+	"github.com/rs/zerolog"
+)
+
+// An Analytic is driven by the runner: Init once, Ingest the flows, then Run
+// on every tick followed by Report to add its results to the tick's log event.
+type Analytic interface {
+	// Init reads the analytic's own section of the configuration.
+	Init(cfg *config.Config) error
+	// Ingest adds flows to those the analytic has already seen.
+	Ingest(flows []flow.Flow) error
+	// Run is the computation that is timed.
+	Run() error
+	Report(e *zerolog.Event)
+}
+
+// A Detector is an analytic that raises alerts. Detections is the number its
+// last Run raised, which the runner logs and exports as a metric.
+type Detector interface {
+	Detections() int
+}
+
+type Factory func() Analytic
+
+var registry = make(map[string]Factory)
+
+// Register makes an analytic available to the runner. It is called from the
+// init function of each analytic package and panics on a duplicate name.
+func Register(name string, factory Factory) {
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("analytic: %q registered twice", name))
+	}
+	registry[name] = factory
+}
+
+func New(name string) (Analytic, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown analytic %q, analytics: %v", name, Names())
+	}
+	return factory(), nil
+}
+
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,72 +1,70 @@
-package main
+package baseline
 
 import (
+	"fmt"
 	"math/rand"
-	"os"
-	"strconv"
-	"time"
-	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+	"analytics/seed"
 
+	"github.com/rs/zerolog"
 )
 
-func compute(nodes int, factor int) {
-	// Simulate the time complexity by performing operations proportional to nodes * factor
-	operations := nodes * factor
-
-	for i := 0; i < operations; i++ {
-		// Perform a simple operation (e.g., addition) to simulate the computation
-		_ = rand.Float64() + rand.Float64()
-	}
+// Baseline is a control analytic that ignores the flows and runs a workload
+// of known complexity instead.
+type Baseline struct {
+	nodes    int
+	factor   int
+	workload string
+	run      func()
 }
 
-func main() {
-
-	log.Info().Msgf("%v", os.Args)
-
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
-
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-
-	if len(os.Args) != 4 {
-		log.Error().Msg("Usage: ./baseline <node_count> <time_complexity_factor>")
-		os.Exit(1)
-	}
+func init() {
+	analytic.Register("baseline", func() analytic.Analytic { return &Baseline{} })
+	config.RegisterWorkloads(workloadNames()...)
+}
 
-	nodes, err := strconv.Atoi(os.Args[1])
-	if err != nil {
-		log.Error().Msg("Error: Invalid node_count")
-		os.Exit(1)
+// Init picks the workload and its complexity factor, defaulting to linear-cpu,
+// and builds the workload's inputs so that runs only time the work.
+func (b *Baseline) Init(cfg *config.Config) error {
+	b.nodes = cfg.Nodes
+	b.factor = cfg.Baseline.Factor
+	b.workload = cfg.Baseline.Workload
+	if b.workload == "" {
+		b.workload = defaultWorkload
 	}
 
-	factor, err := strconv.Atoi(os.Args[2])
-	if err != nil {
-		log.Error().Msg("Error: Invalid time_complexity_factor")
-		os.Exit(1)
+	setup, ok := workloads[b.workload]
+	if !ok {
+		return fmt.Errorf("unknown workload %q, workloads: %v", b.workload, workloadNames())
 	}
+	b.run = setup(seed.New(cfg.Seed, "baseline"), b.nodes, b.factor)
+	return nil
+}
 
-	freq, err := strconv.Atoi(os.Args[3])
-	if err != nil {
-		log.Error().Msg("Error: Invalid run frequency")
-		os.Exit(1)
-	}
+func (b *Baseline) Ingest(flows []flow.Flow) error {
+	return nil
+}
 
-	ticker := time.NewTicker(time.Duration(freq) * time.Second)
+func (b *Baseline) Run() error {
+	b.run()
+	return nil
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			start := time.Now()
-			compute(nodes, factor)
-			elapsed := time.Since(start)
-			elapsedMS := elapsed.Microseconds()
+func (b *Baseline) Report(e *zerolog.Event) {
+	e.Str("workload", b.workload).Int("factor", b.factor)
+}
 
-			log.Info().Time("start", start).Int("nodes", nodes).Int("factor", factor).Int64("elapsed", elapsedMS).Msgf("Computation with node count %d and time complexity factor %d took %s\n", nodes, factor, elapsed)
+func compute(r *rand.Rand, nodes int, factor int) func() {
+	// Simulate the time complexity by performing operations proportional to nodes * factor
+	operations := nodes * factor
 
-		
-			log.Debug().Msgf("Computation with node count %d and time complexity factor %d took %s\n", nodes, factor, elapsed)
-			}
+	return func() {
+		for i := 0; i < operations; i++ {
+			// Perform a simple operation (e.g., addition) to simulate the computation
+			_ = r.Float64() + r.Float64()
+		}
 	}
-
 }
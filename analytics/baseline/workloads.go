@@ -0,0 +1,353 @@
+package baseline
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// A workload is a control with a known complexity class and resource profile.
+// It builds its inputs once, drawn from r so that a seed reproduces them, and
+// returns the work each run repeats over them. The problem size is
+// n = nodes * factor, except for the graph workloads where nodes is the
+// vertex count and factor the average out-degree, so E = n.
+type workload func(r *rand.Rand, nodes int, factor int) func()
+
+// Workloads are named <class>-<variant>. Classes are linear O(n), nlogn
+// O(n log n), quadratic O(n^2) and graph O(V+E). Variants are:
+//
+//	cpu    arithmetic on values that stay in registers and L1, allocating nothing
+//	mem    fresh allocations each run, traversed by chasing pointers
+//	cache  scattered reads over cache-line sized records, defeating prefetch
+var workloads = map[string]workload{
+	"linear-cpu":      compute,
+	"linear-mem":      linearMem,
+	"linear-cache":    linearCache,
+	"nlogn-cpu":       nlognCPU,
+	"nlogn-mem":       nlognMem,
+	"nlogn-cache":     nlognCache,
+	"quadratic-cpu":   quadraticCPU,
+	"quadratic-mem":   quadraticMem,
+	"quadratic-cache": quadraticCache,
+	"graph-cpu":       graphCPU,
+	"graph-mem":       graphMem,
+	"graph-cache":     graphCache,
+}
+
+const defaultWorkload = "linear-cpu"
+
+func workloadNames() []string {
+	names := make([]string, 0, len(workloads))
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sink keeps the compiler from discarding work whose result is otherwise unused.
+var sink uint64
+
+// listNode is a heap allocated cell for the pointer-chasing workloads.
+type listNode struct {
+	value uint64
+	next  *listNode
+	left  *listNode
+	right *listNode
+}
+
+// cacheLine is one 64 byte record, so every scattered read touches a new line.
+type cacheLine [8]uint64
+
+func randomValues(r *rand.Rand, n int) []uint64 {
+	values := make([]uint64, n)
+	for i := range values {
+		values[i] = r.Uint64()
+	}
+	return values
+}
+
+// newShuffledList allocates a cell per value and links them in order, so
+// with values in a random order the traversal order is unrelated to the
+// allocation order.
+func newShuffledList(values []uint64, order []int) *listNode {
+	cells := make([]*listNode, len(values))
+	for i := range cells {
+		cells[i] = &listNode{value: values[i]}
+	}
+	var head *listNode
+	for i := len(order) - 1; i >= 0; i-- {
+		cells[order[i]].next = head
+		head = cells[order[i]]
+	}
+	return head
+}
+
+func newCacheLines(r *rand.Rand, n int) ([]cacheLine, []int) {
+	lines := make([]cacheLine, n)
+	for i := range lines {
+		lines[i][0] = r.Uint64()
+	}
+	return lines, r.Perm(n)
+}
+
+func linearMem(r *rand.Rand, nodes int, factor int) func() {
+	values, order := randomValues(r, nodes*factor), r.Perm(nodes*factor)
+	return func() {
+		total := uint64(0)
+		for cell := newShuffledList(values, order); cell != nil; cell = cell.next {
+			total += cell.value
+		}
+		sink += total
+	}
+}
+
+func linearCache(r *rand.Rand, nodes int, factor int) func() {
+	lines, order := newCacheLines(r, nodes*factor)
+	return func() {
+		total := uint64(0)
+		for _, idx := range order {
+			total += lines[idx][0]
+		}
+		sink += total
+	}
+}
+
+// uint64Sort sorts values in place. It is used by pointer, so sorting does
+// not allocate.
+type uint64Sort struct{ values []uint64 }
+
+func (s *uint64Sort) Len() int           { return len(s.values) }
+func (s *uint64Sort) Less(i, j int) bool { return s.values[i] < s.values[j] }
+func (s *uint64Sort) Swap(i, j int)      { s.values[i], s.values[j] = s.values[j], s.values[i] }
+
+// nlognCPU sorts the same random values every run, copied over the sorted
+// ones so each sort starts from the same disorder.
+func nlognCPU(r *rand.Rand, nodes int, factor int) func() {
+	values := randomValues(r, nodes*factor)
+	sorted := &uint64Sort{values: make([]uint64, len(values))}
+	return func() {
+		copy(sorted.values, values)
+		sort.Sort(sorted)
+		if len(sorted.values) > 0 {
+			sink += sorted.values[0]
+		}
+	}
+}
+
+// nlognMem builds an unbalanced binary search tree from random keys, which has
+// an expected depth of O(log n), by allocating and chasing a node per key.
+func nlognMem(r *rand.Rand, nodes int, factor int) func() {
+	keys := randomValues(r, nodes*factor)
+	return func() {
+		if len(keys) == 0 {
+			return
+		}
+
+		root := &listNode{value: keys[0]}
+		for _, key := range keys[1:] {
+			cell := root
+			for {
+				if key < cell.value {
+					if cell.left == nil {
+						cell.left = &listNode{value: key}
+						break
+					}
+					cell = cell.left
+				} else {
+					if cell.right == nil {
+						cell.right = &listNode{value: key}
+						break
+					}
+					cell = cell.right
+				}
+			}
+		}
+		sink += root.value
+	}
+}
+
+// lineSort sorts indexes by the keys held in the cache lines they point to.
+type lineSort struct {
+	lines []cacheLine
+	order []int
+}
+
+func (s *lineSort) Len() int           { return len(s.order) }
+func (s *lineSort) Less(i, j int) bool { return s.lines[s.order[i]][0] < s.lines[s.order[j]][0] }
+func (s *lineSort) Swap(i, j int)      { s.order[i], s.order[j] = s.order[j], s.order[i] }
+
+// nlognCache sorts indexes by keys held in scattered cache lines, so every
+// comparison reads two unrelated lines.
+func nlognCache(r *rand.Rand, nodes int, factor int) func() {
+	lines, order := newCacheLines(r, nodes*factor)
+	sorted := &lineSort{lines: lines, order: make([]int, len(order))}
+	return func() {
+		copy(sorted.order, order)
+		sort.Sort(sorted)
+		if len(sorted.order) > 0 {
+			sink += lines[sorted.order[0]][0]
+		}
+	}
+}
+
+func quadraticCPU(r *rand.Rand, nodes int, factor int) func() {
+	values := make([]float64, nodes*factor)
+	for i := range values {
+		values[i] = r.Float64()
+	}
+	return func() {
+		total := 0.0
+		for _, a := range values {
+			for _, b := range values {
+				total += a * b
+			}
+		}
+		sink += uint64(total)
+	}
+}
+
+// quadraticMem walks the whole shuffled list once for every element in it.
+func quadraticMem(r *rand.Rand, nodes int, factor int) func() {
+	values, order := randomValues(r, nodes*factor), r.Perm(nodes*factor)
+	return func() {
+		head := newShuffledList(values, order)
+		total := uint64(0)
+		for outer := head; outer != nil; outer = outer.next {
+			for inner := head; inner != nil; inner = inner.next {
+				total += outer.value ^ inner.value
+			}
+		}
+		sink += total
+	}
+}
+
+func quadraticCache(r *rand.Rand, nodes int, factor int) func() {
+	lines, order := newCacheLines(r, nodes*factor)
+	return func() {
+		total := uint64(0)
+		for _, i := range order {
+			for _, j := range order {
+				total += lines[i][0] ^ lines[j][0]
+			}
+		}
+		sink += total
+	}
+}
+
+// randomGraph returns a compressed adjacency list of nodes vertices with
+// nodes*factor edges to uniformly random targets.
+func randomGraph(r *rand.Rand, nodes int, factor int) ([]int, []int) {
+	offsets := make([]int, nodes+1)
+	targets := make([]int, nodes*factor)
+	for v := 0; v < nodes; v++ {
+		offsets[v+1] = offsets[v] + factor
+		for e := offsets[v]; e < offsets[v+1]; e++ {
+			targets[e] = r.Intn(nodes)
+		}
+	}
+	return offsets, targets
+}
+
+// graphCPU runs a breadth first search over a compact adjacency list whose
+// vertex state is a small bitmap, so the cost is the O(V+E) control flow. The
+// queue holds every vertex at most once, so it never grows past nodes.
+func graphCPU(r *rand.Rand, nodes int, factor int) func() {
+	offsets, targets := randomGraph(r, nodes, factor)
+	visited := make([]bool, nodes)
+	queue := make([]int, 0, nodes)
+	return func() {
+		if nodes == 0 {
+			return
+		}
+		for i := range visited {
+			visited[i] = false
+		}
+
+		queue = append(queue[:0], 0)
+		visited[0] = true
+		for head := 0; head < len(queue); head++ {
+			v := queue[head]
+			for _, w := range targets[offsets[v]:offsets[v+1]] {
+				if !visited[w] {
+					visited[w] = true
+					queue = append(queue, w)
+				}
+			}
+		}
+		sink += uint64(len(queue))
+	}
+}
+
+// graphMem allocates a vertex object per node with a slice of edge pointers,
+// as bfs.go does, and searches it by chasing those pointers.
+func graphMem(r *rand.Rand, nodes int, factor int) func() {
+	offsets, targets := randomGraph(r, nodes, factor)
+	return func() {
+		if nodes == 0 {
+			return
+		}
+
+		type vertex struct {
+			visited bool
+			edges   []*vertex
+		}
+
+		vertices := make([]*vertex, nodes)
+		for i := range vertices {
+			vertices[i] = &vertex{}
+		}
+		for i, v := range vertices {
+			for _, w := range targets[offsets[i]:offsets[i+1]] {
+				v.edges = append(v.edges, vertices[w])
+			}
+		}
+
+		visitedCount := uint64(0)
+		queue := []*vertex{vertices[0]}
+		vertices[0].visited = true
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			visitedCount++
+			for _, w := range v.edges {
+				if !w.visited {
+					w.visited = true
+					queue = append(queue, w)
+				}
+			}
+		}
+		sink += visitedCount
+	}
+}
+
+// graphCache searches the same kind of graph but keeps each vertex's state in
+// its own cache line and renumbers vertices randomly, so neighbours are never
+// adjacent in memory.
+func graphCache(r *rand.Rand, nodes int, factor int) func() {
+	offsets, targets := randomGraph(r, nodes, factor)
+	lines, relabel := newCacheLines(r, nodes)
+	queue := make([]int, 0, nodes)
+	return func() {
+		if nodes == 0 {
+			return
+		}
+		for i := range lines {
+			lines[i][1] = 0
+		}
+
+		queue = append(queue[:0], 0)
+		lines[relabel[0]][1] = 1
+		total := uint64(0)
+		for head := 0; head < len(queue); head++ {
+			v := queue[head]
+			total += lines[relabel[v]][0]
+			for _, w := range targets[offsets[v]:offsets[v+1]] {
+				if lines[relabel[w]][1] == 0 {
+					lines[relabel[w]][1] = 1
+					queue = append(queue, w)
+				}
+			}
+		}
+		sink += total
+	}
+}
@@ -0,0 +1,65 @@
+package baseline
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"analytics/config"
+)
+
+// The cpu and cache variants build their inputs up front, so their runs
+// allocate nothing and time only the work.
+func TestRunsDoNotAllocate(t *testing.T) {
+	for _, name := range workloadNames() {
+		if strings.HasSuffix(name, "-mem") {
+			continue
+		}
+		run := workloads[name](rand.New(rand.NewSource(1)), 200, 4)
+		if allocs := testing.AllocsPerRun(5, run); allocs != 0 {
+			t.Errorf("%s allocates %v times per run", name, allocs)
+		}
+	}
+}
+
+// Every run repeats the same work on the same inputs, so a deterministic
+// workload adds the same amount to sink each time.
+func TestRunsRepeat(t *testing.T) {
+	for _, name := range workloadNames() {
+		if name == defaultWorkload {
+			// linear-cpu draws its operands as it runs
+			continue
+		}
+		run := workloads[name](rand.New(rand.NewSource(1)), 200, 4)
+		before := sink
+		run()
+		first := sink - before
+		run()
+		if second := sink - before - first; second != first {
+			t.Errorf("%s added %d to sink on its first run and %d on its second", name, first, second)
+		}
+	}
+}
+
+func TestEmptyWorkloads(t *testing.T) {
+	for _, name := range workloadNames() {
+		workloads[name](rand.New(rand.NewSource(1)), 0, 4)()
+	}
+}
+
+// An unknown workload is caught by Validate with the other settings, before
+// the analytic is set up.
+func TestValidateWorkload(t *testing.T) {
+	cfg := config.Default()
+	cfg.Analytic = "baseline"
+	if err := cfg.Validate([]string{"baseline"}); err != nil {
+		t.Errorf("the default workload did not validate: %v", err)
+	}
+
+	cfg.Baseline.Workload = "linear-gpu"
+	cfg.Baseline.Factor = 0
+	err := cfg.Validate([]string{"baseline"})
+	if err == nil || !strings.Contains(err.Error(), `baseline.workload "linear-gpu"`) || !strings.Contains(err.Error(), "baseline.factor") {
+		t.Errorf("an unknown workload and a zero factor gave %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package beaconing
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"sort"
+	"time"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+	"analytics/seed"
+
+	"github.com/rs/zerolog"
+)
+
+// Largest number of bins in a series before it is truncated for the FFT
+const maxSeriesBins = 1 << 14
+
+// seriesKey identifies the (src, dst, port) connection series that is scored.
+type seriesKey struct {
+	src  string
+	dst  string
+	port uint16
+}
+
+type BeaconScore struct {
+	Source          string
+	Destination     string
+	DestinationPort uint16
+	Events          int
+	MeanInterval    time.Duration
+	JitterScore     float64
+	PeriodicScore   float64
+	Score           float64
+}
+
+// Beaconing scores every (src, dst, port) connection series for periodicity
+// and reports the ones that look like malware calling home.
+type Beaconing struct {
+	// Shortest series that is scored, time series bins per median interval,
+	// beacon score threshold and the fraction of generated nodes that beacon
+	cfg config.Beaconing
+
+	flows   []flow.Flow
+	beacons []BeaconScore
+}
+
+func init() {
+	analytic.Register("beaconing", func() analytic.Analytic { return &Beaconing{} })
+}
+
+// Init seeds the traffic with the beacons of a few infected hosts.
+func (b *Beaconing) Init(cfg *config.Config) error {
+	b.cfg = cfg.Beaconing
+	b.flows = generateBeacons(seed.New(cfg.Seed, "beaconing"), cfg.Nodes, b.cfg.InfectedFraction)
+	return nil
+}
+
+func (b *Beaconing) Ingest(flows []flow.Flow) error {
+	b.flows = append(b.flows, flows...)
+	return nil
+}
+
+func (b *Beaconing) Run() error {
+	b.beacons = compute(b.flows, b.cfg)
+	return nil
+}
+
+// Report adds each detected beacon to the tick's event, as the other
+// detectors report what they found.
+func (b *Beaconing) Report(e *zerolog.Event) {
+	detected := zerolog.Arr()
+	for _, beacon := range b.beacons {
+		detected.Dict(zerolog.Dict().Str("src", beacon.Source).Str("dst", beacon.Destination).Uint16("port", beacon.DestinationPort).Int("events", beacon.Events).Dur("interval", beacon.MeanInterval).Float64("jitter", beacon.JitterScore).Float64("periodic", beacon.PeriodicScore).Float64("score", beacon.Score))
+	}
+
+	e.Int("beacons", len(b.beacons)).Array("detected", detected)
+}
+
+func (b *Beaconing) Detections() int {
+	return len(b.beacons)
+}
+
+// generateBeacons simulates infected hosts calling home to a single C2 server
+// on a fixed period with a small amount of jitter, the way POS malware would.
+func generateBeacons(r *rand.Rand, nodeCount int, infectedFraction float64) []flow.Flow {
+	infected := int(math.Ceil(float64(nodeCount) * infectedFraction))
+	c2IP := flow.RandomIP(r)
+	windowStart := flow.WindowStart()
+
+	var flows []flow.Flow
+	for _, srcIP := range flow.NewGenerator(r).IPs(infected) {
+		period := time.Duration(30+r.Intn(270)) * time.Second
+		jitter := period / 20
+
+		for t := time.Duration(r.Int63n(int64(period))); t < flow.Window; t += period {
+			startTime := windowStart.Add(t + time.Duration(r.Int63n(int64(2*jitter))) - jitter)
+			byteCount := 200 + r.Uint32()%300
+
+			flows = append(flows, flow.Flow{
+				SourceIP:        srcIP,
+				DestinationIP:   c2IP,
+				SourcePort:      uint16(r.Intn(65535-1024) + 1024),
+				DestinationPort: 443,
+				Protocol:        6,
+				ByteCount:       byteCount,
+				PacketCount:     byteCount/flow.AvgPacketSize + 1,
+				StartTime:       startTime,
+				EndTime:         startTime.Add(time.Duration(r.Intn(500)) * time.Millisecond),
+			})
+		}
+	}
+
+	return flows
+}
+
+func groupSeries(flows []flow.Flow) map[seriesKey][]time.Time {
+	series := make(map[seriesKey][]time.Time)
+
+	for _, f := range flows {
+		key := seriesKey{
+			src:  f.SourceIP.String(),
+			dst:  f.DestinationIP.String(),
+			port: f.DestinationPort,
+		}
+		series[key] = append(series[key], f.StartTime)
+	}
+
+	return series
+}
+
+func interArrivals(times []time.Time) []float64 {
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	deltas := make([]float64, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		deltas[i-1] = times[i].Sub(times[i-1]).Seconds()
+	}
+	return deltas
+}
+
+// jitterScore is one minus the coefficient of variation of the inter-arrival
+// times, so a perfectly regular series scores 1 and a bursty one scores 0.
+func jitterScore(deltas []float64) (float64, float64) {
+	mean := 0.0
+	for _, d := range deltas {
+		mean += d
+	}
+	mean /= float64(len(deltas))
+
+	if mean == 0 {
+		return 0, 0
+	}
+
+	variance := 0.0
+	for _, d := range deltas {
+		variance += (d - mean) * (d - mean)
+	}
+	variance /= float64(len(deltas))
+
+	return math.Max(0, 1-math.Sqrt(variance)/mean), mean
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// periodicScore bins the connection times into a count series and returns the
+// strongest autocorrelation peak at a non-zero lag. The autocorrelation is
+// taken from the power spectrum (Wiener-Khinchin), so the cost is O(n log n).
+func periodicScore(times []time.Time, deltas []float64, binsPerInterval int) float64 {
+	binWidth := median(deltas) / float64(binsPerInterval)
+	if binWidth <= 0 {
+		return 0
+	}
+
+	span := times[len(times)-1].Sub(times[0]).Seconds()
+	bins := int(span/binWidth) + 1
+	if bins > maxSeriesBins {
+		bins = maxSeriesBins
+	}
+
+	// Zero pad to twice the series length so the correlation is not circular
+	size := 1
+	for size < 2*bins {
+		size <<= 1
+	}
+
+	counts := make([]float64, bins)
+	for _, t := range times {
+		idx := int(t.Sub(times[0]).Seconds() / binWidth)
+		if idx < bins {
+			counts[idx]++
+		}
+	}
+
+	mean := 0.0
+	for _, c := range counts {
+		mean += c
+	}
+	mean /= float64(bins)
+
+	signal := make([]complex128, size)
+	for i, c := range counts {
+		signal[i] = complex(c-mean, 0)
+	}
+
+	spectrum := fft(signal, false)
+	for i, v := range spectrum {
+		spectrum[i] = complex(real(v)*real(v)+imag(v)*imag(v), 0)
+	}
+	acf := fft(spectrum, true)
+
+	zeroLag := real(acf[0])
+	if zeroLag == 0 {
+		return 0
+	}
+
+	// Skip lags shorter than half an interval, which only measure the width of
+	// a single peak rather than its repetition
+	best := 0.0
+	for lag := binsPerInterval / 2; lag < bins/2; lag++ {
+		// Normalise for the shrinking overlap at larger lags
+		r := real(acf[lag]) / zeroLag * float64(bins) / float64(bins-lag)
+		if r > best {
+			best = r
+		}
+	}
+
+	return math.Min(best, 1)
+}
+
+// fft is an iterative radix-2 Cooley-Tukey transform. len(x) must be a power
+// of two. The inverse transform is scaled by 1/n.
+func fft(x []complex128, inverse bool) []complex128 {
+	n := len(x)
+	out := make([]complex128, n)
+
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	for i := 0; i < n; i++ {
+		rev := 0
+		for b := 0; b < bits; b++ {
+			if i&(1<<b) != 0 {
+				rev |= 1 << (bits - 1 - b)
+			}
+		}
+		out[rev] = x[i]
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, sign*2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even := out[start+k]
+				odd := w * out[start+k+size/2]
+				out[start+k] = even + odd
+				out[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+
+	if inverse {
+		for i := range out {
+			out[i] /= complex(float64(n), 0)
+		}
+	}
+
+	return out
+}
+
+func compute(flows []flow.Flow, cfg config.Beaconing) []BeaconScore {
+	var beacons []BeaconScore
+
+	for key, times := range groupSeries(flows) {
+		if len(times) < cfg.MinEvents {
+			continue
+		}
+
+		deltas := interArrivals(times)
+		jitter, mean := jitterScore(deltas)
+		periodic := periodicScore(times, deltas, cfg.BinsPerInterval)
+
+		score := (jitter + periodic) / 2
+		if score >= cfg.Threshold {
+			beacons = append(beacons, BeaconScore{
+				Source:          key.src,
+				Destination:     key.dst,
+				DestinationPort: key.port,
+				Events:          len(times),
+				MeanInterval:    time.Duration(mean * float64(time.Second)),
+				JitterScore:     jitter,
+				PeriodicScore:   periodic,
+				Score:           score,
+			})
+		}
+	}
+
+	return beacons
+}
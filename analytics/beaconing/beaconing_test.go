@@ -0,0 +1,131 @@
+package beaconing
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"analytics/config"
+	"analytics/flow"
+
+	"github.com/rs/zerolog"
+)
+
+var start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// periodicTimes calls home every period, give or take jitter.
+func periodicTimes(r *rand.Rand, n int, period, jitter time.Duration) []time.Time {
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = start.Add(time.Duration(i)*period + time.Duration(r.Int63n(int64(2*jitter))) - jitter)
+	}
+	return times
+}
+
+// randomTimes arrive as a Poisson process with the given mean interval.
+func randomTimes(r *rand.Rand, n int, mean time.Duration) []time.Time {
+	times := make([]time.Time, n)
+	at := start
+	for i := range times {
+		at = at.Add(time.Duration(r.ExpFloat64() * float64(mean)))
+		times[i] = at
+	}
+	return times
+}
+
+func series(src string, times []time.Time) []flow.Flow {
+	flows := make([]flow.Flow, len(times))
+	for i, t := range times {
+		flows[i] = flow.Flow{SourceIP: net.ParseIP(src), DestinationIP: net.ParseIP("203.0.113.7"), DestinationPort: 443, StartTime: t, EndTime: t}
+	}
+	return flows
+}
+
+func scores(times []time.Time, binsPerInterval int) (jitter, periodic float64) {
+	deltas := interArrivals(times)
+	jitter, _ = jitterScore(deltas)
+	return jitter, periodicScore(times, deltas, binsPerInterval)
+}
+
+func TestScores(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	binsPerInterval := config.Default().Beaconing.BinsPerInterval
+
+	jitter, periodic := scores(periodicTimes(r, 60, time.Minute, 2*time.Second), binsPerInterval)
+	if jitter < 0.9 || periodic < 0.7 {
+		t.Errorf("a beacon every minute give or take 2s scored jitter %.3f and periodic %.3f", jitter, periodic)
+	}
+
+	jitter, periodic = scores(randomTimes(r, 60, time.Minute), binsPerInterval)
+	if jitter > 0.3 || periodic > 0.5 {
+		t.Errorf("Poisson arrivals scored jitter %.3f and periodic %.3f", jitter, periodic)
+	}
+
+	// A perfectly regular series is as periodic as it gets
+	if jitter, _ := jitterScore([]float64{30, 30, 30, 30}); jitter != 1 {
+		t.Errorf("equal intervals scored jitter %v, want 1", jitter)
+	}
+	if jitter, mean := jitterScore([]float64{0, 0, 0}); jitter != 0 || mean != 0 {
+		t.Errorf("simultaneous events scored jitter %v over mean %v, want 0", jitter, mean)
+	}
+}
+
+func TestComputeSkipsShortSeries(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	cfg := config.Default().Beaconing
+
+	short := series("10.0.0.1", periodicTimes(r, cfg.MinEvents-1, time.Minute, time.Second))
+	if beacons := compute(short, cfg); len(beacons) != 0 {
+		t.Errorf("scored %+v from %d events, below the minimum of %d", beacons, len(short), cfg.MinEvents)
+	}
+
+	enough := series("10.0.0.1", periodicTimes(r, cfg.MinEvents, time.Minute, time.Second))
+	if beacons := compute(enough, cfg); len(beacons) != 1 {
+		t.Errorf("found %d beacons in %d regular events, want 1", len(beacons), len(enough))
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	b := &Beaconing{cfg: config.Default().Beaconing}
+	b.Ingest(series("10.0.0.1", periodicTimes(r, 60, 5*time.Minute, 5*time.Second)))
+	b.Ingest(series("10.0.0.2", randomTimes(r, 60, 5*time.Minute)))
+	if err := b.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	e := logger.Info()
+	b.Report(e)
+	e.Send()
+
+	var report struct {
+		Beacons  int `json:"beacons"`
+		Detected []struct {
+			Src      string  `json:"src"`
+			Dst      string  `json:"dst"`
+			Port     uint16  `json:"port"`
+			Events   int     `json:"events"`
+			Interval float64 `json:"interval"`
+			Score    float64 `json:"score"`
+		} `json:"detected"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Beacons != 1 || len(report.Detected) != 1 || b.Detections() != 1 {
+		t.Fatalf("reported %s, want only the periodic series", buf.Bytes())
+	}
+	d := report.Detected[0]
+	if d.Src != "10.0.0.1" || d.Dst != "203.0.113.7" || d.Port != 443 || d.Events != 60 || d.Score < b.cfg.Threshold {
+		t.Errorf("reported beacon %+v", d)
+	}
+	// zerolog writes durations in milliseconds
+	if d.Interval < 4.9*60e3 || d.Interval > 5.1*60e3 {
+		t.Errorf("reported an interval of %vms, want about 5m", d.Interval)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"analytics/config"
+	"analytics/fit"
+	"analytics/sweep"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// The measured network of 100 stores, which target sizes given in stores are
+// scaled from.
+const (
+	storeBase  = 100
+	storeNodes = 1083
+	storeEdges = 59725
+)
+
+// metric is a cost column of the sweep that can be fitted.
+type metric struct {
+	unit string
+	cost func(sweep.Row) float64
+}
+
+var metricColumns = map[string]metric{
+	"elapsed": {"us", func(r sweep.Row) float64 { return float64(r.ElapsedMeanUS) }},
+	"cpu":     {"us", func(r sweep.Row) float64 { return float64(r.CPUUserMeanUS + r.CPUSysMeanUS) }},
+	"alloc":   {"bytes", func(r sweep.Row) float64 { return r.AllocBytesMean }},
+	"heap":    {"bytes", func(r sweep.Row) float64 { return float64(r.HeapPeakBytes) }},
+	"rss":     {"bytes", func(r sweep.Row) float64 { return float64(r.MaxRSSBytes) }},
+}
+
+// Target is the size fits are extrapolated to.
+type Target struct {
+	Stores float64 `json:"stores,omitempty"`
+	Nodes  float64 `json:"nodes"`
+	Edges  float64 `json:"edges"`
+}
+
+type modelReport struct {
+	Model string `json:"model"`
+	fit.Fit
+	Prediction fit.Estimate `json:"prediction"`
+}
+
+// Report is every model fitted to one cost of one analytic.
+type Report struct {
+	Analytic string            `json:"analytic"`
+	Metric   string            `json:"metric"`
+	Unit     string            `json:"unit"`
+	Target   Target            `json:"target"`
+	Models   []modelReport     `json:"models"`
+	Best     string            `json:"best,omitempty"`
+	Skipped  map[string]string `json:"skipped,omitempty"`
+}
+
+func main() {
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	var (
+		metrics = config.Strings{"elapsed", "cpu", "alloc", "heap"}
+		level   float64
+		target  Target
+		out     string
+	)
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] sweep.csv|sweep.json ...\n\n", fs.Name())
+		fs.PrintDefaults()
+	}
+	fs.Var(&metrics, "metrics", "comma separated costs to fit: elapsed, cpu, alloc, heap, rss")
+	fs.Float64Var(&level, "level", 0.95, "confidence level of the intervals")
+	fs.Float64Var(&target.Stores, "target.stores", 1000, fmt.Sprintf("store count to extrapolate to, %d stores being %d nodes and %d edges", storeBase, storeNodes, storeEdges))
+	fs.Float64Var(&target.Nodes, "target.nodes", 0, "node count to extrapolate to, overrides -target.stores")
+	fs.Float64Var(&target.Edges, "target.edges", 0, "edge count to extrapolate to, overrides -target.stores")
+	fs.StringVar(&out, "out", "", "also write the fits to this JSON file")
+
+	err := fs.Parse(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err == nil && fs.NArg() == 0 {
+		err = fmt.Errorf("no sweep files given")
+	}
+	if err == nil && (level <= 0 || level >= 1) {
+		err = fmt.Errorf("level must be between 0 and 1, got %v", level)
+	}
+	for _, m := range metrics {
+		if _, ok := metricColumns[m]; !ok && err == nil {
+			err = fmt.Errorf("unknown metric %q", m)
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Invalid arguments")
+		os.Exit(2)
+	}
+
+	// An explicit node or edge count replaces the store scaling for that
+	// count, and the target is then no longer a whole number of stores
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["target.nodes"] {
+		target.Nodes = target.Stores * storeNodes / storeBase
+	}
+	if !set["target.edges"] {
+		target.Edges = target.Stores * storeEdges / storeBase
+	}
+	if set["target.nodes"] || set["target.edges"] {
+		target.Stores = 0
+	}
+
+	var rows []sweep.Row
+	for _, path := range fs.Args() {
+		read, err := sweep.Read(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Error: Could not read sweep")
+			os.Exit(1)
+		}
+		rows = append(rows, read...)
+	}
+
+	byAnalytic := map[string][]sweep.Row{}
+	var analytics []string
+	for _, row := range rows {
+		if row.Iterations == 0 {
+			continue
+		}
+		if _, ok := byAnalytic[row.Analytic]; !ok {
+			analytics = append(analytics, row.Analytic)
+		}
+		byAnalytic[row.Analytic] = append(byAnalytic[row.Analytic], row)
+	}
+	sort.Strings(analytics)
+
+	var reports []Report
+	for _, name := range analytics {
+		for _, m := range metrics {
+			reports = append(reports, fitMetric(name, m, byAnalytic[name], level, target))
+		}
+	}
+
+	printReports(reports, level)
+
+	if out != "" {
+		if err := write(out, reports); err != nil {
+			log.Error().Err(err).Str("path", out).Msg("Error: Could not write fits")
+			os.Exit(1)
+		}
+		log.Info().Str("path", out).Int("fits", len(reports)).Msg("Fits written")
+	}
+}
+
+func fitMetric(name, m string, rows []sweep.Row, level float64, target Target) Report {
+	column := metricColumns[m]
+
+	var samples []fit.Sample
+	dropped := 0
+	for _, row := range rows {
+		cost := column.cost(row)
+		if cost <= 0 {
+			dropped++
+			continue
+		}
+		samples = append(samples, fit.Sample{Nodes: float64(row.Nodes), Edges: float64(row.Edges), Cost: cost})
+	}
+
+	report := Report{Analytic: name, Metric: m, Unit: column.unit, Target: target}
+
+	fits, skipped := fit.Models(samples, level)
+	for _, f := range fits {
+		report.Models = append(report.Models, modelReport{Model: f.Name(), Fit: f, Prediction: f.Predict(target.Nodes, target.Edges)})
+	}
+	if best := fit.Best(fits); best >= 0 {
+		report.Best = fits[best].Name()
+	}
+	if len(skipped) > 0 {
+		report.Skipped = map[string]string{}
+		for model, err := range skipped {
+			reason := err.Error()
+			if errors.Is(err, fit.ErrTooFewSamples) && dropped > 0 {
+				reason += fmt.Sprintf("; %d of the %d points have no %s to fit", dropped, len(rows), m)
+			}
+			report.Skipped[model] = reason
+		}
+	}
+	return report
+}
+
+func printReports(reports []Report, level float64) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	pct := level * 100
+	fmt.Fprintf(w, "analytic\tmetric\tmodel\texponents (%g%% CI)\tscale\tr2\tresid se\tpoints\tpredicted (%g%% CI)\t\n", pct, pct)
+	for _, r := range reports {
+		for _, m := range r.Models {
+			exponents := "1 (fixed)"
+			if len(m.Exponents) > 0 {
+				parts := make([]string, len(m.Exponents))
+				for i, e := range m.Exponents {
+					parts[i] = fmt.Sprintf("%.3f [%.3f, %.3f]", e.Value, e.Lower, e.Upper)
+				}
+				exponents = strings.Join(parts, " ")
+			}
+			best := ""
+			if m.Model == r.Best {
+				best = " *"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s%s\t%s\t%.4g\t%.3f\t%.3f\t%d\t%.4g [%.4g, %.4g] %s\t\n",
+				r.Analytic, r.Metric, m.Model, best, exponents, m.Scale.Value, m.R2, m.ResidualSE, m.Points,
+				m.Prediction.Value, m.Prediction.Lower, m.Prediction.Upper, r.Unit)
+		}
+		skipped := make([]string, 0, len(r.Skipped))
+		for model := range r.Skipped {
+			skipped = append(skipped, model)
+		}
+		sort.Strings(skipped)
+		for _, model := range skipped {
+			fmt.Fprintf(w, "%s\t%s\t%s\tnot fitted: %s\t\t\t\t\t\t\n", r.Analytic, r.Metric, model, r.Skipped[model])
+		}
+	}
+	if len(reports) > 0 {
+		t := reports[0].Target
+		fmt.Fprintf(w, "\npredictions at %.0f nodes and %.0f edges", t.Nodes, t.Edges)
+		if t.Stores > 0 {
+			fmt.Fprintf(w, " (%g stores)", t.Stores)
+		}
+		fmt.Fprintf(w, ", * marks the model with the smallest residual standard error\n")
+	}
+}
+
+func write(path string, reports []Report) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(reports); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/runner"
+
+	_ "analytics/BFS-Generic"
+	_ "analytics/KLDDOS"
+	_ "analytics/baseline"
+	_ "analytics/beaconing"
+	_ "analytics/heavyhitter"
+	_ "analytics/pcr"
+	_ "analytics/superspreader"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+
+	log.Info().Msgf("%v", os.Args)
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	cfg, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Invalid arguments")
+		os.Exit(2)
+	}
+
+	if err := cfg.Validate(analytic.Names()); err != nil {
+		log.Error().Err(err).Msg("Error: Invalid configuration")
+		os.Exit(2)
+	}
+
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = fmt.Sprintf("%s-%d", cfg.Analytic, time.Now().Unix())
+	}
+
+	log.Info().Interface("config", cfg).Msg("Effective configuration")
+
+	// Stop between runs on SIGINT or SIGTERM, so docker stop lets the current
+	// computation finish and the summary be logged
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if _, err := runner.Run(ctx, cfg); err != nil {
+		log.Error().Err(err).Msgf("Error: Could not start %s", cfg.Analytic)
+		os.Exit(1)
+	}
+}
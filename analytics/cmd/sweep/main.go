@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/sweep"
+
+	_ "analytics/BFS-Generic"
+	_ "analytics/KLDDOS"
+	_ "analytics/baseline"
+	_ "analytics/beaconing"
+	_ "analytics/heavyhitter"
+	_ "analytics/pcr"
+	_ "analytics/superspreader"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultIterations is used when -iterations is not given, as a sweep point
+// has to end.
+const defaultIterations = 10
+
+func main() {
+
+	log.Info().Msgf("%v", os.Args)
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	cfg, err := config.Load(os.Args[0], os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Invalid arguments")
+		os.Exit(2)
+	}
+
+	if cfg.Iterations == 0 {
+		cfg.Iterations = defaultIterations
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if cfg.RunID == "" {
+		cfg.RunID = fmt.Sprintf("sweep-%d", time.Now().Unix())
+	}
+	if cfg.Sweep.Out == "" {
+		cfg.Sweep.Out = filepath.Join(cfg.Results, cfg.RunID+".csv")
+	}
+
+	points, err := sweep.Points(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Invalid configuration")
+		os.Exit(2)
+	}
+	// Check every point as it will be run, so a bad value in one of the
+	// ladders stops the sweep before it starts rather than partway through
+	for i, p := range points {
+		pointCfg := p.Config(cfg, i)
+		if err := pointCfg.Validate(analytic.Names()); err != nil {
+			log.Error().Err(err).Str("analytic", p.Analytic).Int("nodes", p.Nodes).Int("edges", p.Edges).Dur("freq", p.Frequency).Msg("Error: Invalid configuration")
+			os.Exit(2)
+		}
+	}
+
+	log.Info().Interface("config", cfg).Int("points", len(points)).Msg("Effective configuration")
+
+	// Stop after the run in progress on SIGINT or SIGTERM, and still write
+	// the points measured so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rows, runErr := sweep.Run(ctx, cfg, points)
+	if runErr != nil {
+		log.Error().Err(runErr).Msg("Error: Sweep failed")
+	}
+
+	if err := sweep.Write(cfg.Sweep.Out, rows); err != nil {
+		log.Error().Err(err).Str("path", cfg.Sweep.Out).Msg("Error: Could not write sweep")
+		os.Exit(1)
+	}
+	log.Info().Str("path", cfg.Sweep.Out).Int("points", len(rows)).Msg("Sweep written")
+
+	if runErr != nil {
+		os.Exit(1)
+	}
+}
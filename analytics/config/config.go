@@ -0,0 +1,510 @@
+// Package config builds the runner configuration from, in increasing order of
+// precedence, built-in defaults, a YAML or JSON config file, ANALYTIC_*
+// environment variables and command line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is prepended to a flag name, upper cased with dots and dashes
+// replaced by underscores, to give its environment variable. -klddos.bins is
+// read from ANALYTIC_KLDDOS_BINS.
+const EnvPrefix = "ANALYTIC_"
+
+// Schedules the runner can start runs on.
+const (
+	ScheduleFixedRate  = "fixed-rate"
+	ScheduleFixedDelay = "fixed-delay"
+	ScheduleContinuous = "continuous"
+	SchedulePoisson    = "poisson"
+)
+
+// Input sources for the flows handed to the analytic.
+const (
+	SourceGenerate = "generate"
+	SourceCSV      = "csv"
+	SourceNone     = "none"
+)
+
+// Duration is a time.Duration that reads and writes as "5s" in flags and
+// config files. A bare number is taken as seconds, as the old positional
+// frequency argument was.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(s string) error {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// Ints is a comma separated list of integers, such as a node count ladder.
+type Ints []int
+
+func (l Ints) String() string {
+	parts := make([]string, len(l))
+	for i, v := range l {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *Ints) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		*l = append(*l, v)
+	}
+	return nil
+}
+
+// Durations is a comma separated list of durations, such as run frequencies.
+type Durations []Duration
+
+func (l Durations) String() string {
+	parts := make([]string, len(l))
+	for i, v := range l {
+		parts[i] = v.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *Durations) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		var d Duration
+		if err := d.Set(strings.TrimSpace(part)); err != nil {
+			return err
+		}
+		*l = append(*l, d)
+	}
+	return nil
+}
+
+// Strings is a comma separated list of names.
+type Strings []string
+
+func (l Strings) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l *Strings) Set(s string) error {
+	*l = nil
+	for _, part := range strings.Split(s, ",") {
+		*l = append(*l, strings.TrimSpace(part))
+	}
+	return nil
+}
+
+// Sweep is read by the sweep command, which runs each analytic for a fixed
+// number of iterations at every point of the size ladder and frequency list.
+// Nodes and Edges are paired off unless Cross is set, when every node count is
+// run with every edge count. A single edge count is used with every node
+// count. Empty lists fall back to the single values above.
+type Sweep struct {
+	Analytics Strings   `yaml:"analytics" json:"analytics"`
+	Nodes     Ints      `yaml:"nodes" json:"nodes"`
+	Edges     Ints      `yaml:"edges" json:"edges"`
+	Freqs     Durations `yaml:"freqs" json:"freqs"`
+	Cross     bool      `yaml:"cross" json:"cross"`
+	// Out is the .csv or .json file the points are written to
+	Out string `yaml:"out" json:"out"`
+}
+
+// Profile serves net/http/pprof on Addr, if set, and captures profiles of
+// iterations From to To, counting from 1, into the results directory.
+type Profile struct {
+	Addr  string `yaml:"addr" json:"addr"`
+	From  int    `yaml:"from" json:"from"`
+	To    int    `yaml:"to" json:"to"`
+	CPU   bool   `yaml:"cpu" json:"cpu"`
+	Heap  bool   `yaml:"heap" json:"heap"`
+	Trace bool   `yaml:"trace" json:"trace"`
+}
+
+type Input struct {
+	Source string `yaml:"source" json:"source"`
+	Path   string `yaml:"path" json:"path"`
+}
+
+type Baseline struct {
+	Workload string `yaml:"workload" json:"workload"`
+	Factor   int    `yaml:"factor" json:"factor"`
+}
+
+type BFS struct {
+	ExportPath string `yaml:"export" json:"export"`
+}
+
+type KLDDOS struct {
+	Bins      int     `yaml:"bins" json:"bins"`
+	Threshold float64 `yaml:"threshold" json:"threshold"`
+}
+
+type Beaconing struct {
+	MinEvents        int     `yaml:"minEvents" json:"minEvents"`
+	BinsPerInterval  int     `yaml:"binsPerInterval" json:"binsPerInterval"`
+	Threshold        float64 `yaml:"threshold" json:"threshold"`
+	InfectedFraction float64 `yaml:"infectedFraction" json:"infectedFraction"`
+}
+
+type HeavyHitter struct {
+	Window   Duration `yaml:"window" json:"window"`
+	TopK     int      `yaml:"topK" json:"topK"`
+	Capacity int      `yaml:"capacity" json:"capacity"`
+	// Retain is how many closed windows' heavy hitters are kept, the oldest
+	// being dropped first, so a long run holds a bounded history
+	Retain int `yaml:"retain" json:"retain"`
+}
+
+type Superspreader struct {
+	Window          Duration `yaml:"window" json:"window"`
+	Sites           int      `yaml:"sites" json:"sites"`
+	Precision       int      `yaml:"precision" json:"precision"`
+	Threshold       int      `yaml:"threshold" json:"threshold"`
+	ScannerFraction float64  `yaml:"scannerFraction" json:"scannerFraction"`
+	VictimFraction  float64  `yaml:"victimFraction" json:"victimFraction"`
+	AttackFanout    int      `yaml:"attackFanout" json:"attackFanout"`
+	// Import is sketch files written by other sites' runners, merged with
+	// this runner's sites on every run, and Export is where this runner's
+	// own sketches are written once its flows are ingested
+	Import Strings `yaml:"import" json:"import"`
+	Export string  `yaml:"export" json:"export"`
+}
+
+type Config struct {
+	Analytic       string   `yaml:"analytic" json:"analytic"`
+	Nodes          int      `yaml:"nodes" json:"nodes"`
+	EdgeSampleSize int      `yaml:"edges" json:"edges"`
+	Frequency      Duration `yaml:"freq" json:"freq"`
+	Schedule       string   `yaml:"schedule" json:"schedule"`
+	// Iterations and Duration stop the run after that many runs or that long,
+	// whichever comes first. Zero is no limit.
+	Iterations int      `yaml:"iterations" json:"iterations"`
+	Duration   Duration `yaml:"duration" json:"duration"`
+	// Warmup is how long the runner waits after setting up before its first
+	// run, so that a sampler watching it from the start has its first sample
+	// by then. Duration is counted from the end of the warm-up.
+	Warmup Duration `yaml:"warmup" json:"warmup"`
+	// Seed drives every random choice of the run. Zero picks one from the
+	// clock, which is logged so the run can be repeated.
+	Seed  int64 `yaml:"seed" json:"seed"`
+	Input Input `yaml:"input" json:"input"`
+	// RunID names this run's files in Results. The runner fills it in from
+	// the analytic and start time if it is not set.
+	RunID   string  `yaml:"runID" json:"runID"`
+	Results string  `yaml:"results" json:"results"`
+	Profile Profile `yaml:"profile" json:"profile"`
+	// MetricsAddr serves Prometheus metrics on /metrics, if set
+	MetricsAddr string `yaml:"metricsAddr" json:"metricsAddr"`
+	Sweep       Sweep  `yaml:"sweep" json:"sweep"`
+
+	Baseline      Baseline      `yaml:"baseline" json:"baseline"`
+	BFS           BFS           `yaml:"bfs" json:"bfs"`
+	KLDDOS        KLDDOS        `yaml:"klddos" json:"klddos"`
+	Beaconing     Beaconing     `yaml:"beaconing" json:"beaconing"`
+	HeavyHitter   HeavyHitter   `yaml:"heavyhitter" json:"heavyhitter"`
+	Superspreader Superspreader `yaml:"superspreader" json:"superspreader"`
+}
+
+// Default is the 100 store dataset the Dockerfiles have always run.
+func Default() *Config {
+	return &Config{
+		Nodes:          1083,
+		EdgeSampleSize: 59725,
+		Frequency:      Duration(5 * time.Second),
+		Schedule:       ScheduleFixedRate,
+		Input:          Input{Source: SourceGenerate},
+		Results:        "results",
+		Profile:        Profile{CPU: true, Heap: true, Trace: true},
+		Baseline:       Baseline{Workload: "linear-cpu", Factor: 1},
+		KLDDOS:         KLDDOS{Bins: 10, Threshold: 0.5},
+		Beaconing: Beaconing{
+			MinEvents:        6,
+			BinsPerInterval:  8,
+			Threshold:        0.7,
+			InfectedFraction: 0.01,
+		},
+		HeavyHitter: HeavyHitter{
+			Window:   Duration(5 * time.Minute),
+			TopK:     10,
+			Capacity: 1000,
+			Retain:   12,
+		},
+		Superspreader: Superspreader{
+			Window:          Duration(5 * time.Minute),
+			Sites:           4,
+			Precision:       10,
+			Threshold:       100,
+			ScannerFraction: 0.005,
+			VictimFraction:  0.002,
+			AttackFanout:    2000,
+		},
+	}
+}
+
+// bind registers a flag for every setting, writing into cfg. Each flag's
+// default is the value cfg already holds.
+func bind(fs *flag.FlagSet, cfg *Config) *string {
+	configPath := fs.String("config", "", "YAML or JSON config file")
+
+	fs.StringVar(&cfg.Analytic, "analytic", cfg.Analytic, "analytic to run")
+	fs.IntVar(&cfg.Nodes, "nodes", cfg.Nodes, "simulated node count")
+	fs.IntVar(&cfg.EdgeSampleSize, "edges", cfg.EdgeSampleSize, "simulated edge (flow) count")
+	fs.Var(&cfg.Frequency, "freq", "run frequency, e.g. 5s")
+	fs.StringVar(&cfg.Schedule, "schedule", cfg.Schedule, "fixed-rate, fixed-delay, continuous or poisson")
+	fs.IntVar(&cfg.Iterations, "iterations", cfg.Iterations, "stop after this many runs, 0 for no limit")
+	fs.Var(&cfg.Duration, "duration", "stop after this long, e.g. 10m, 0 for no limit")
+	fs.Var(&cfg.Warmup, "warmup", "wait this long after setting up before the first run, e.g. 5s for a sampler to catch up")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "random seed, 0 to pick one from the clock")
+	fs.StringVar(&cfg.Input.Source, "input", cfg.Input.Source, "flow source: generate, csv or none")
+	fs.StringVar(&cfg.Input.Path, "input.path", cfg.Input.Path, "flow CSV written by summarize, for -input csv")
+	fs.StringVar(&cfg.RunID, "run-id", cfg.RunID, "name for this run's result files, default <analytic>-<unix time>")
+	fs.StringVar(&cfg.Results, "results", cfg.Results, "directory profiles are written to")
+
+	fs.StringVar(&cfg.MetricsAddr, "metrics.addr", cfg.MetricsAddr, "serve Prometheus metrics on /metrics at this address, e.g. :9090")
+	fs.StringVar(&cfg.Profile.Addr, "pprof.addr", cfg.Profile.Addr, "serve net/http/pprof on this address, e.g. :6060")
+	fs.IntVar(&cfg.Profile.From, "profile.from", cfg.Profile.From, "first iteration to profile, 0 for none")
+	fs.IntVar(&cfg.Profile.To, "profile.to", cfg.Profile.To, "last iteration to profile, default profile.from")
+	fs.BoolVar(&cfg.Profile.CPU, "profile.cpu", cfg.Profile.CPU, "capture a CPU profile of the profiled iterations")
+	fs.BoolVar(&cfg.Profile.Heap, "profile.heap", cfg.Profile.Heap, "capture a heap profile after the last profiled iteration")
+	fs.BoolVar(&cfg.Profile.Trace, "profile.trace", cfg.Profile.Trace, "capture an execution trace of the profiled iterations")
+
+	fs.Var(&cfg.Sweep.Analytics, "sweep.analytics", "analytics to sweep, default -analytic")
+	fs.Var(&cfg.Sweep.Nodes, "sweep.nodes", "node count ladder, e.g. 100,1000,10000")
+	fs.Var(&cfg.Sweep.Edges, "sweep.edges", "edge count ladder, paired with sweep.nodes")
+	fs.Var(&cfg.Sweep.Freqs, "sweep.freqs", "run frequencies, e.g. 1s,5s")
+	fs.BoolVar(&cfg.Sweep.Cross, "sweep.cross", cfg.Sweep.Cross, "run every node count with every edge count")
+	fs.StringVar(&cfg.Sweep.Out, "sweep.out", cfg.Sweep.Out, "write the sweep to this .csv or .json file, default <results>/<run-id>.csv")
+
+	fs.StringVar(&cfg.Baseline.Workload, "baseline.workload", cfg.Baseline.Workload, "baseline workload name")
+	fs.IntVar(&cfg.Baseline.Factor, "baseline.factor", cfg.Baseline.Factor, "baseline time complexity factor")
+
+	fs.StringVar(&cfg.BFS.ExportPath, "bfs.export", cfg.BFS.ExportPath, "write the flow graph to a .graphml, .gexf or .dot file")
+
+	fs.IntVar(&cfg.KLDDOS.Bins, "klddos.bins", cfg.KLDDOS.Bins, "byte count histogram bins")
+	fs.Float64Var(&cfg.KLDDOS.Threshold, "klddos.threshold", cfg.KLDDOS.Threshold, "divergence above which a DDoS is reported")
+
+	fs.IntVar(&cfg.Beaconing.MinEvents, "beaconing.min-events", cfg.Beaconing.MinEvents, "shortest connection series that is scored")
+	fs.IntVar(&cfg.Beaconing.BinsPerInterval, "beaconing.bins-per-interval", cfg.Beaconing.BinsPerInterval, "time series bins per median inter-arrival")
+	fs.Float64Var(&cfg.Beaconing.Threshold, "beaconing.threshold", cfg.Beaconing.Threshold, "score at or above which a series is a beacon")
+	fs.Float64Var(&cfg.Beaconing.InfectedFraction, "beaconing.infected", cfg.Beaconing.InfectedFraction, "fraction of generated nodes that beacon")
+
+	fs.Var(&cfg.HeavyHitter.Window, "heavyhitter.window", "tumbling window size")
+	fs.IntVar(&cfg.HeavyHitter.TopK, "heavyhitter.topk", cfg.HeavyHitter.TopK, "talkers reported per dimension")
+	fs.IntVar(&cfg.HeavyHitter.Capacity, "heavyhitter.capacity", cfg.HeavyHitter.Capacity, "Space-Saving counters per sketch")
+	fs.IntVar(&cfg.HeavyHitter.Retain, "heavyhitter.retain", cfg.HeavyHitter.Retain, "closed windows whose heavy hitters are kept, oldest dropped first")
+
+	fs.Var(&cfg.Superspreader.Window, "superspreader.window", "tumbling window size")
+	fs.IntVar(&cfg.Superspreader.Sites, "superspreader.sites", cfg.Superspreader.Sites, "sensors the flows are split across")
+	fs.IntVar(&cfg.Superspreader.Precision, "superspreader.precision", cfg.Superspreader.Precision, "HyperLogLog precision, 2^p registers per host")
+	fs.IntVar(&cfg.Superspreader.Threshold, "superspreader.threshold", cfg.Superspreader.Threshold, "distinct peers at which a host is flagged")
+	fs.Float64Var(&cfg.Superspreader.ScannerFraction, "superspreader.scanners", cfg.Superspreader.ScannerFraction, "fraction of generated nodes that scan")
+	fs.Float64Var(&cfg.Superspreader.VictimFraction, "superspreader.victims", cfg.Superspreader.VictimFraction, "fraction of generated nodes that are DDoS victims")
+	fs.IntVar(&cfg.Superspreader.AttackFanout, "superspreader.fanout", cfg.Superspreader.AttackFanout, "distinct peers of each generated scanner or victim")
+	fs.Var(&cfg.Superspreader.Import, "superspreader.import", "sketch files exported by other sites' runners to merge in, comma separated")
+	fs.StringVar(&cfg.Superspreader.Export, "superspreader.export", cfg.Superspreader.Export, "write this runner's sketches to this file for another site to import")
+
+	return configPath
+}
+
+// Load parses args (without the program name) on top of the environment, the
+// config file named by -config or ANALYTIC_CONFIG, and the defaults.
+func Load(name string, args []string) (*Config, error) {
+	// The config file has to be read before the flags are applied over it, so
+	// find its path with a first pass that is then thrown away
+	scratch := flag.NewFlagSet(name, flag.ContinueOnError)
+	scratch.SetOutput(discard{})
+	configPath := bind(scratch, Default())
+	if err := applyEnv(scratch); err != nil {
+		return nil, err
+	}
+	if err := scratch.Parse(args); err != nil && !errors.Is(err, flag.ErrHelp) {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *configPath != "" {
+		if err := loadFile(*configPath, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	bind(fs, cfg)
+	if err := applyEnv(fs); err != nil {
+		return nil, err
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %v, settings are named flags now, see -help", fs.Args())
+	}
+
+	return cfg, nil
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+func applyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %v", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	default:
+		return fmt.Errorf("config %s: unknown format, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+	return nil
+}
+
+// workloads are the baseline workload names Validate accepts.
+var workloads []string
+
+// RegisterWorkloads records the baseline analytic's workloads, so that an
+// unknown baseline.workload is reported by Validate along with the other
+// settings. The baseline package registers them when it is linked in;
+// without it the name is not checked.
+func RegisterWorkloads(names ...string) {
+	workloads = append(workloads, names...)
+}
+
+// Validate checks every setting is in range. analytics is the set of names
+// the runner can run.
+func (c *Config) Validate(analytics []string) error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	known := false
+	for _, name := range analytics {
+		known = known || name == c.Analytic
+	}
+	check(known, "analytic %q is not one of %v", c.Analytic, analytics)
+	check(c.Frequency > 0, "freq must be positive")
+	switch c.Schedule {
+	case ScheduleFixedRate, ScheduleFixedDelay, ScheduleContinuous, SchedulePoisson:
+	default:
+		problems = append(problems, fmt.Sprintf("schedule %q is not one of fixed-rate, fixed-delay, continuous or poisson", c.Schedule))
+	}
+	check(c.Iterations >= 0, "iterations must not be negative")
+	check(c.Duration >= 0, "duration must not be negative")
+	check(c.Warmup >= 0, "warmup must not be negative")
+
+	switch c.Input.Source {
+	case SourceGenerate:
+		check(c.Nodes >= 2, "nodes must be at least 2 to generate flows")
+		check(c.EdgeSampleSize > 0, "edges must be positive to generate flows")
+	case SourceCSV:
+		check(c.Input.Path != "", "input.path is required for -input csv")
+	case SourceNone:
+	default:
+		problems = append(problems, fmt.Sprintf("input %q is not one of generate, csv or none", c.Input.Source))
+	}
+
+	check(c.MetricsAddr == "" || c.MetricsAddr != c.Profile.Addr, "metrics.addr and pprof.addr must differ")
+	check(c.Profile.From >= 0, "profile.from must not be negative")
+	check(c.Profile.To == 0 || c.Profile.To >= c.Profile.From, "profile.to must be at least profile.from")
+	check(c.Profile.From == 0 || c.Profile.CPU || c.Profile.Heap || c.Profile.Trace, "profile.from is set but profile.cpu, profile.heap and profile.trace are all off")
+	check(c.Profile.From == 0 || c.Results != "", "results is required to profile")
+
+	if len(workloads) > 0 && c.Baseline.Workload != "" {
+		known := false
+		for _, name := range workloads {
+			known = known || name == c.Baseline.Workload
+		}
+		check(known, "baseline.workload %q is not one of %v", c.Baseline.Workload, workloads)
+	}
+	check(c.Baseline.Factor > 0, "baseline.factor must be positive")
+	check(c.KLDDOS.Bins > 0, "klddos.bins must be positive")
+	check(c.KLDDOS.Threshold >= 0, "klddos.threshold must not be negative")
+	check(c.Beaconing.MinEvents >= 3, "beaconing.min-events must be at least 3")
+	check(c.Beaconing.BinsPerInterval >= 2, "beaconing.bins-per-interval must be at least 2")
+	check(c.Beaconing.Threshold >= 0 && c.Beaconing.Threshold <= 1, "beaconing.threshold must be between 0 and 1")
+	check(c.Beaconing.InfectedFraction >= 0 && c.Beaconing.InfectedFraction <= 1, "beaconing.infected must be between 0 and 1")
+	check(c.HeavyHitter.Window > 0, "heavyhitter.window must be positive")
+	check(c.HeavyHitter.TopK > 0, "heavyhitter.topk must be positive")
+	check(c.HeavyHitter.Capacity >= c.HeavyHitter.TopK, "heavyhitter.capacity must be at least heavyhitter.topk")
+	check(c.HeavyHitter.Retain > 0, "heavyhitter.retain must be positive")
+	check(c.Superspreader.Window > 0, "superspreader.window must be positive")
+	check(c.Superspreader.Sites > 0, "superspreader.sites must be positive")
+	check(c.Superspreader.Precision >= 4 && c.Superspreader.Precision <= 16, "superspreader.precision must be between 4 and 16")
+	check(c.Superspreader.Threshold > 0, "superspreader.threshold must be positive")
+	check(c.Superspreader.ScannerFraction >= 0 && c.Superspreader.ScannerFraction <= 1, "superspreader.scanners must be between 0 and 1")
+	check(c.Superspreader.VictimFraction >= 0 && c.Superspreader.VictimFraction <= 1, "superspreader.victims must be between 0 and 1")
+	check(c.Superspreader.AttackFanout >= 0, "superspreader.fanout must not be negative")
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
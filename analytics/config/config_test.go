@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Settings come from the defaults, then the file, then ANALYTIC_* variables,
+// then flags, each overriding the last.
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "runner.yaml")
+	yaml := "analytic: bfs\nnodes: 500\nfreq: 2s\nklddos:\n  bins: 20\n  threshold: 0.8\n"
+	if err := os.WriteFile(file, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		env   map[string]string
+		args  []string
+		check func(*Config) bool
+	}{
+		{"defaults", nil, nil, func(c *Config) bool {
+			return c.Analytic == Default().Analytic && c.Nodes == 1083 && c.Frequency == Duration(5*time.Second)
+		}},
+		{"file over defaults", nil, []string{"-config", file}, func(c *Config) bool {
+			return c.Analytic == "bfs" && c.Nodes == 500 && c.KLDDOS.Bins == 20 && c.EdgeSampleSize == 59725
+		}},
+		{"file named by the environment", map[string]string{"ANALYTIC_CONFIG": file}, nil, func(c *Config) bool {
+			return c.Analytic == "bfs" && c.Nodes == 500
+		}},
+		{"environment over file", map[string]string{"ANALYTIC_NODES": "700", "ANALYTIC_KLDDOS_BINS": "30"}, []string{"-config", file}, func(c *Config) bool {
+			return c.Nodes == 700 && c.KLDDOS.Bins == 30 && c.KLDDOS.Threshold == 0.8
+		}},
+		{"flags over environment", map[string]string{"ANALYTIC_NODES": "700", "ANALYTIC_FREQ": "3"}, []string{"-config", file, "-nodes", "900"}, func(c *Config) bool {
+			return c.Nodes == 900 && c.Frequency == Duration(3*time.Second) && c.Analytic == "bfs"
+		}},
+		{"dashes in the variable name", map[string]string{"ANALYTIC_BEACONING_MIN_EVENTS": "9", "ANALYTIC_RUN_ID": "soak"}, nil, func(c *Config) bool {
+			return c.Beaconing.MinEvents == 9 && c.RunID == "soak"
+		}},
+		{"lists", nil, []string{"-sweep.nodes", "100, 1000", "-sweep.freqs", "1s,500ms"}, func(c *Config) bool {
+			return len(c.Sweep.Nodes) == 2 && c.Sweep.Nodes[1] == 1000 && c.Sweep.Freqs[1] == Duration(500*time.Millisecond)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load("runner", tc.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.check(cfg) {
+				t.Errorf("loaded %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.yaml")
+	if err := os.WriteFile(unknown, []byte("nodes: 5\ncolour: blue\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ini := filepath.Join(dir, "runner.ini")
+	if err := os.WriteFile(ini, []byte("nodes=5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"unknown file setting", nil, []string{"-config", unknown}, "colour"},
+		{"unknown file format", nil, []string{"-config", ini}, "unknown format"},
+		{"bad environment value", map[string]string{"ANALYTIC_NODES": "many"}, nil, "ANALYTIC_NODES"},
+		{"positional arguments", nil, []string{"5"}, "unexpected arguments"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load("runner", tc.args)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want an error mentioning %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	analytics := []string{"baseline", "bfs"}
+	for _, tc := range []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{"defaults", func(c *Config) {}, nil},
+		{"unknown analytic", func(c *Config) { c.Analytic = "pagerank" }, []string{`analytic "pagerank"`}},
+		{"every problem at once", func(c *Config) {
+			c.Frequency = 0
+			c.Schedule = "hourly"
+			c.Iterations = -1
+			c.KLDDOS.Bins = 0
+		}, []string{"freq", `schedule "hourly"`, "iterations", "klddos.bins"}},
+		{"csv input without a path", func(c *Config) { c.Input.Source = SourceCSV }, []string{"input.path"}},
+		{"too few nodes to generate", func(c *Config) { c.Nodes = 1 }, []string{"nodes"}},
+		{"no flows needs no nodes", func(c *Config) { c.Input.Source, c.Nodes = SourceNone, 0 }, nil},
+		{"shared listen address", func(c *Config) { c.MetricsAddr, c.Profile.Addr = ":9090", ":9090" }, []string{"metrics.addr"}},
+		{"profile range backwards", func(c *Config) { c.Profile.From, c.Profile.To = 5, 2 }, []string{"profile.to"}},
+		{"precision out of range", func(c *Config) { c.Superspreader.Precision = 20 }, []string{"superspreader.precision"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Analytic = "baseline"
+			tc.change(cfg)
+			err := cfg.Validate(analytics)
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Errorf("got %v, want no problems", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got no error, want %q", tc.want)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%v does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
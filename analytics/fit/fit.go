@@ -0,0 +1,262 @@
+// Package fit estimates how an analytic's cost grows with network size. It
+// fits power laws, cost = a·n^b, cost = a·m^b and cost = a·n^b·m^c, and the
+// n·log n model cost = a·n·ln n, by least squares on the logarithms, and
+// extrapolates the fits to sizes that were not measured.
+package fit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Variables a model can be fitted against.
+const (
+	Nodes = "n"
+	Edges = "m"
+)
+
+// Model kinds.
+const (
+	PowerLaw = "power"
+	NLogN    = "nlogn"
+)
+
+// Sample is one measured cost at a network size.
+type Sample struct {
+	Nodes float64
+	Edges float64
+	Cost  float64
+}
+
+func (s Sample) value(variable string) float64 {
+	if variable == Edges {
+		return s.Edges
+	}
+	return s.Nodes
+}
+
+// Estimate is a fitted parameter with its confidence interval.
+type Estimate struct {
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Fit is one model fitted to a set of samples.
+type Fit struct {
+	Kind      string   `json:"kind"`
+	Variables []string `json:"variables"`
+	// Scale is the constant factor a, in the unit of the cost
+	Scale Estimate `json:"scale"`
+	// Exponents has one entry per variable for a power law and is empty for
+	// n·log n, whose exponent is fixed
+	Exponents []Estimate `json:"exponents,omitempty"`
+	Points    int        `json:"points"`
+	Level     float64    `json:"level"`
+	// R2 and ResidualSE are of the fit to log cost. ResidualSE is corrected
+	// for the number of parameters so models of different sizes compare
+	R2         float64 `json:"r2"`
+	ResidualSE float64 `json:"residual_se"`
+
+	beta []float64
+	cov  [][]float64
+	t    float64
+}
+
+// Name is the model written as a formula, such as n^b·m^c or m·log m.
+func (f Fit) Name() string {
+	if f.Kind == NLogN {
+		return fmt.Sprintf("%s·log %s", f.Variables[0], f.Variables[0])
+	}
+	terms := make([]string, len(f.Variables))
+	for i, v := range f.Variables {
+		terms[i] = v + "^" + string("bcd"[i])
+	}
+	return strings.Join(terms, "·")
+}
+
+// Power fits cost = a·x^b, or the product of a power of each variable when
+// several are given.
+func Power(samples []Sample, level float64, variables ...string) (Fit, error) {
+	if len(samples) <= 1+len(variables) {
+		return Fit{}, tooFew(len(samples), 1+len(variables))
+	}
+	x := make([][]float64, len(samples))
+	y := make([]float64, len(samples))
+	for i, s := range samples {
+		row := []float64{1}
+		for _, v := range variables {
+			if s.value(v) <= 0 {
+				return Fit{}, fmt.Errorf("%s must be positive to fit a power law", v)
+			}
+			row = append(row, math.Log(s.value(v)))
+		}
+		if s.Cost <= 0 {
+			return Fit{}, errors.New("cost must be positive to fit a power law")
+		}
+		x[i] = row
+		y[i] = math.Log(s.Cost)
+	}
+
+	f, err := solve(x, y, level)
+	if err != nil {
+		return Fit{}, err
+	}
+	f.Kind = PowerLaw
+	f.Variables = variables
+	for i := range variables {
+		f.Exponents = append(f.Exponents, f.interval(i+1))
+	}
+	return f, nil
+}
+
+// NLogNFit fits cost = a·x·ln x, leaving only the constant factor free.
+func NLogNFit(samples []Sample, level float64, variable string) (Fit, error) {
+	if len(samples) <= 1 {
+		return Fit{}, tooFew(len(samples), 1)
+	}
+	x := make([][]float64, len(samples))
+	y := make([]float64, len(samples))
+	for i, s := range samples {
+		v := s.value(variable)
+		if v <= 1 {
+			return Fit{}, fmt.Errorf("%s must be above 1 to fit n·log n", variable)
+		}
+		if s.Cost <= 0 {
+			return Fit{}, errors.New("cost must be positive to fit n·log n")
+		}
+		x[i] = []float64{1}
+		y[i] = math.Log(s.Cost) - math.Log(v*math.Log(v))
+	}
+
+	f, err := solve(x, y, level)
+	if err != nil {
+		return Fit{}, err
+	}
+
+	// R² is of log cost, not of the cost left over once x·ln x is taken out
+	var mean, tss float64
+	for i, s := range samples {
+		mean += (math.Log(s.Cost) - mean) / float64(i+1)
+	}
+	for _, s := range samples {
+		tss += (math.Log(s.Cost) - mean) * (math.Log(s.Cost) - mean)
+	}
+	f.R2 = rSquared(f.ResidualSE*f.ResidualSE*float64(len(samples)-1), tss)
+
+	f.Kind = NLogN
+	f.Variables = []string{variable}
+	return f, nil
+}
+
+func solve(x [][]float64, y []float64, level float64) (Fit, error) {
+	beta, cov, rss, err := ols(x, y)
+	if err != nil {
+		return Fit{}, err
+	}
+
+	n, k := len(y), len(beta)
+	var mean, tss float64
+	for i, v := range y {
+		mean += (v - mean) / float64(i+1)
+	}
+	for _, v := range y {
+		tss += (v - mean) * (v - mean)
+	}
+
+	f := Fit{
+		Points:     n,
+		Level:      level,
+		R2:         rSquared(rss, tss),
+		ResidualSE: math.Sqrt(rss / float64(n-k)),
+		beta:       beta,
+		cov:        cov,
+		t:          tQuantile(1-(1-level)/2, n-k),
+	}
+	scale := f.interval(0)
+	f.Scale = Estimate{Value: math.Exp(scale.Value), Lower: math.Exp(scale.Lower), Upper: math.Exp(scale.Upper)}
+	return f, nil
+}
+
+func rSquared(rss, tss float64) float64 {
+	if tss == 0 {
+		return 1
+	}
+	return 1 - rss/tss
+}
+
+func (f Fit) interval(i int) Estimate {
+	half := f.t * math.Sqrt(f.cov[i][i])
+	return Estimate{Value: f.beta[i], Lower: f.beta[i] - half, Upper: f.beta[i] + half}
+}
+
+// Predict extrapolates the fit to a network of nodes and edges, returning the
+// expected cost with a confidence interval for it at the fit's level.
+func (f Fit) Predict(nodes, edges float64) Estimate {
+	size := Sample{Nodes: nodes, Edges: edges}
+
+	x := []float64{1}
+	offset := 0.0
+	if f.Kind == NLogN {
+		v := size.value(f.Variables[0])
+		offset = math.Log(v * math.Log(v))
+	} else {
+		for _, v := range f.Variables {
+			x = append(x, math.Log(size.value(v)))
+		}
+	}
+
+	mean, variance := offset, 0.0
+	for i := range x {
+		mean += f.beta[i] * x[i]
+		for j := range x {
+			variance += x[i] * f.cov[i][j] * x[j]
+		}
+	}
+	half := f.t * math.Sqrt(variance)
+	return Estimate{Value: math.Exp(mean), Lower: math.Exp(mean - half), Upper: math.Exp(mean + half)}
+}
+
+// Models fits every model that the samples can support: the power law in n,
+// in m and, when n and m were varied independently, in both, followed by
+// n·log n and m·log m. Models that cannot be fitted are left out, with the
+// reason in the returned map.
+func Models(samples []Sample, level float64) ([]Fit, map[string]error) {
+	var fits []Fit
+	skipped := map[string]error{}
+
+	attempt := func(name string, f Fit, err error) {
+		if err != nil {
+			skipped[name] = err
+			return
+		}
+		fits = append(fits, f)
+	}
+
+	f, err := Power(samples, level, Nodes)
+	attempt("n^b", f, err)
+	f, err = Power(samples, level, Edges)
+	attempt("m^b", f, err)
+	f, err = Power(samples, level, Nodes, Edges)
+	attempt("n^b·m^c", f, err)
+	f, err = NLogNFit(samples, level, Nodes)
+	attempt("n·log n", f, err)
+	f, err = NLogNFit(samples, level, Edges)
+	attempt("m·log m", f, err)
+
+	return fits, skipped
+}
+
+// Best is the fit with the smallest residual standard error, or -1 when there
+// are none.
+func Best(fits []Fit) int {
+	best := -1
+	for i, f := range fits {
+		if best < 0 || f.ResidualSE < fits[best].ResidualSE {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,48 @@
+package fit
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestTooFewSamples(t *testing.T) {
+	samples := []Sample{{Nodes: 10, Edges: 100, Cost: 5}, {Nodes: 20, Edges: 400, Cost: 11}}
+	for n := 0; n <= len(samples); n++ {
+		fits, skipped := Models(samples[:n], 0.95)
+		if len(fits)+len(skipped) != 5 {
+			t.Errorf("%d samples: %d fits and %d skipped, want every one of the 5 models in either", n, len(fits), len(skipped))
+		}
+		for model, err := range skipped {
+			if n == 0 && !errors.Is(err, ErrTooFewSamples) {
+				t.Errorf("no samples: %s was skipped for %v", model, err)
+			}
+		}
+	}
+
+	// Two samples fit the one parameter n·log n but not the power laws
+	fits, skipped := Models(samples, 0.95)
+	for _, model := range []string{"n^b", "m^b", "n^b·m^c"} {
+		if !errors.Is(skipped[model], ErrTooFewSamples) {
+			t.Errorf("two samples: %s was skipped for %v", model, skipped[model])
+		}
+	}
+	if len(fits) != 2 {
+		t.Errorf("two samples fitted %d models, want n·log n and m·log m", len(fits))
+	}
+}
+
+func TestPowerRecoversExponent(t *testing.T) {
+	var samples []Sample
+	for _, n := range []float64{100, 200, 400, 800, 1600} {
+		samples = append(samples, Sample{Nodes: n, Edges: n * 10, Cost: 3 * math.Pow(n, 1.5) * (1 + 0.01*math.Sin(n))})
+	}
+	f, err := Power(samples, 0.95, Nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := f.Exponents[0]
+	if math.Abs(b.Value-1.5) > 0.02 || b.Lower > 1.5 || b.Upper < 1.5 {
+		t.Errorf("fitted exponent %.3f [%.3f, %.3f], want about 1.5", b.Value, b.Lower, b.Upper)
+	}
+}
@@ -0,0 +1,202 @@
+package fit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errSingular = errors.New("predictors are collinear")
+
+// ErrTooFewSamples is returned for a model with at least as many parameters
+// as there are samples, which leaves nothing to estimate the error from.
+var ErrTooFewSamples = errors.New("too few samples")
+
+func tooFew(samples, parameters int) error {
+	return fmt.Errorf("%w: %d for %d parameters, at least %d are needed", ErrTooFewSamples, samples, parameters, parameters+1)
+}
+
+// ols solves y = X·beta by least squares and returns beta, its covariance
+// matrix and the residual sum of squares.
+func ols(x [][]float64, y []float64) ([]float64, [][]float64, float64, error) {
+	if len(x) == 0 {
+		return nil, nil, 0, tooFew(0, 0)
+	}
+	n, k := len(x), len(x[0])
+	if n <= k {
+		return nil, nil, 0, tooFew(n, k)
+	}
+
+	// Normal equations X'X beta = X'y
+	xtx := make([][]float64, k)
+	xty := make([]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k)
+	}
+	for r := 0; r < n; r++ {
+		for i := 0; i < k; i++ {
+			xty[i] += x[r][i] * y[r]
+			for j := 0; j < k; j++ {
+				xtx[i][j] += x[r][i] * x[r][j]
+			}
+		}
+	}
+
+	inv, err := invert(xtx)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	beta := make([]float64, k)
+	for i := 0; i < k; i++ {
+		for j := 0; j < k; j++ {
+			beta[i] += inv[i][j] * xty[j]
+		}
+	}
+
+	rss := 0.0
+	for r := 0; r < n; r++ {
+		predicted := 0.0
+		for i := 0; i < k; i++ {
+			predicted += x[r][i] * beta[i]
+		}
+		rss += (y[r] - predicted) * (y[r] - predicted)
+	}
+
+	variance := rss / float64(n-k)
+	for i := range inv {
+		for j := range inv[i] {
+			inv[i][j] *= variance
+		}
+	}
+
+	return beta, inv, rss, nil
+}
+
+// invert is Gauss-Jordan elimination with partial pivoting.
+func invert(a [][]float64) ([][]float64, error) {
+	k := len(a)
+	m := make([][]float64, k)
+	for i := range a {
+		m[i] = make([]float64, 2*k)
+		copy(m[i], a[i])
+		m[i][k+i] = 1
+	}
+
+	scale := 0.0
+	for i := range a {
+		scale = math.Max(scale, math.Abs(a[i][i]))
+	}
+
+	for col := 0; col < k; col++ {
+		pivot := col
+		for r := col + 1; r < k; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(m[pivot][col]) <= 1e-10*scale {
+			return nil, errSingular
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		p := m[col][col]
+		for j := range m[col] {
+			m[col][j] /= p
+		}
+		for r := 0; r < k; r++ {
+			if r == col {
+				continue
+			}
+			f := m[r][col]
+			for j := range m[r] {
+				m[r][j] -= f * m[col][j]
+			}
+		}
+	}
+
+	inv := make([][]float64, k)
+	for i := range m {
+		inv[i] = m[i][k:]
+	}
+	return inv, nil
+}
+
+// tQuantile is the p quantile of Student's t distribution with df degrees of
+// freedom, found by bisection on the CDF.
+func tQuantile(p float64, df int) float64 {
+	lo, hi := 0.0, 1e3
+	for i := 0; i < 200; i++ {
+		mid := (lo + hi) / 2
+		if tCDF(mid, float64(df)) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+func tCDF(t, df float64) float64 {
+	x := df / (df + t*t)
+	tail := 0.5 * incompleteBeta(df/2, 0.5, x)
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// incompleteBeta is the regularised incomplete beta function I_x(a, b),
+// evaluated by its continued fraction (Numerical Recipes 6.4).
+func incompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab - lga - lgb + a*math.Log(x) + b*math.Log(1-x))
+
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+
+	for m := 1; m <= 300; m++ {
+		fm := float64(m)
+		for _, num := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,123 @@
+package flow
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var protocols = map[string]uint8{"ICMP": 1, "TCP": 6, "UDP": 17}
+
+// LegacyStart is when the first flow of a file without times starts.
+var LegacyStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// ReadCSV loads the simulated events written by sim/pcap summarize:
+//
+//	src, dst, sport, dport, proto, bytes[, packets, start, end]
+//
+// with start and end in Unix microseconds. Older files without the last three
+// columns have no times, so their flows are given a single packet at
+// LegacyStart plus a microsecond per row. That keeps them in file order and
+// in one window, and the same file always reads back the same.
+func ReadCSV(path string) ([]Flow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var flows []Flow
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := parseRecord(record, line-1)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		flows = append(flows, f)
+	}
+
+	return flows, nil
+}
+
+// parseRecord parses the row'th row of a file, counting from zero.
+func parseRecord(record []string, row int) (Flow, error) {
+	if len(record) != 6 && len(record) != 9 {
+		return Flow{}, fmt.Errorf("want 6 or 9 fields, got %d", len(record))
+	}
+	for i := range record {
+		record[i] = strings.TrimSpace(record[i])
+	}
+
+	var f Flow
+	if f.SourceIP = net.ParseIP(record[0]); f.SourceIP == nil {
+		return Flow{}, fmt.Errorf("invalid source IP %q", record[0])
+	}
+	if f.DestinationIP = net.ParseIP(record[1]); f.DestinationIP == nil {
+		return Flow{}, fmt.Errorf("invalid destination IP %q", record[1])
+	}
+
+	sport, err := strconv.ParseUint(record[2], 10, 16)
+	if err != nil {
+		return Flow{}, fmt.Errorf("source port: %v", err)
+	}
+	dport, err := strconv.ParseUint(record[3], 10, 16)
+	if err != nil {
+		return Flow{}, fmt.Errorf("destination port: %v", err)
+	}
+	f.SourcePort, f.DestinationPort = uint16(sport), uint16(dport)
+
+	if proto, ok := protocols[strings.ToUpper(record[4])]; ok {
+		f.Protocol = proto
+	} else if proto, err := strconv.ParseUint(record[4], 10, 8); err == nil {
+		f.Protocol = uint8(proto)
+	} else {
+		return Flow{}, fmt.Errorf("unknown protocol %q", record[4])
+	}
+
+	bytes, err := strconv.ParseUint(record[5], 10, 32)
+	if err != nil {
+		return Flow{}, fmt.Errorf("bytes: %v", err)
+	}
+	f.ByteCount = uint32(bytes)
+
+	if len(record) == 6 {
+		f.PacketCount = 1
+		f.StartTime = LegacyStart.Add(time.Duration(row) * time.Microsecond)
+		f.EndTime = f.StartTime
+		return f, nil
+	}
+
+	packets, err := strconv.ParseUint(record[6], 10, 32)
+	if err != nil {
+		return Flow{}, fmt.Errorf("packets: %v", err)
+	}
+	f.PacketCount = uint32(packets)
+
+	start, err := strconv.ParseInt(record[7], 10, 64)
+	if err != nil {
+		return Flow{}, fmt.Errorf("start: %v", err)
+	}
+	end, err := strconv.ParseInt(record[8], 10, 64)
+	if err != nil {
+		return Flow{}, fmt.Errorf("end: %v", err)
+	}
+	f.StartTime, f.EndTime = time.UnixMicro(start), time.UnixMicro(end)
+
+	return f, nil
+}
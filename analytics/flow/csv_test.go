@@ -0,0 +1,74 @@
+package flow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCSV(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flows.csv")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadCSV(t *testing.T) {
+	path := writeCSV(t, "10.0.0.1, 10.0.0.2, 51000, 443, TCP, 1500, 3, 1704067200000000, 1704067200250000\n"+
+		"10.0.0.2,10.0.0.1,443,51000,17,64,1,1704067201000000,1704067201000000\n")
+	flows, err := ReadCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("read %d flows, want 2", len(flows))
+	}
+	f := flows[0]
+	if f.SourceIP.String() != "10.0.0.1" || f.DestinationPort != 443 || f.Protocol != 6 || f.ByteCount != 1500 || f.PacketCount != 3 {
+		t.Errorf("read %+v", f)
+	}
+	if !f.StartTime.Equal(time.UnixMicro(1704067200000000)) || f.EndTime.Sub(f.StartTime) != 250*time.Millisecond {
+		t.Errorf("read times %v to %v", f.StartTime, f.EndTime)
+	}
+	if flows[1].Protocol != 17 {
+		t.Errorf("read protocol %d from a number, want 17", flows[1].Protocol)
+	}
+}
+
+// Rows without times read back the same every time, in file order.
+func TestReadCSVLegacyTimes(t *testing.T) {
+	path := writeCSV(t, "10.0.0.1,10.0.0.2,51000,443,TCP,1500\n10.0.0.3,10.0.0.2,51001,443,TCP,700\n")
+	first, err := ReadCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ReadCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range first {
+		want := LegacyStart.Add(time.Duration(i) * time.Microsecond)
+		if !f.StartTime.Equal(want) || !f.EndTime.Equal(want) || f.PacketCount != 1 {
+			t.Errorf("row %d starts %v with %d packets, want %v and 1", i, f.StartTime, f.PacketCount, want)
+		}
+		if !again[i].StartTime.Equal(f.StartTime) {
+			t.Errorf("row %d read at %v and then %v", i, f.StartTime, again[i].StartTime)
+		}
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	for _, content := range []string{
+		"10.0.0.1,10.0.0.2,51000,443,TCP\n",
+		"10.0.0.1,not-an-ip,51000,443,TCP,1500\n",
+		"10.0.0.1,10.0.0.2,70000,443,TCP,1500\n",
+		"10.0.0.1,10.0.0.2,51000,443,SCTP-ish,1500\n",
+	} {
+		if _, err := ReadCSV(writeCSV(t, content)); err == nil {
+			t.Errorf("read %q without an error", content)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package flow holds the flow record every analytic consumes and the synthetic
+// generator used in place of a capture.
+package flow
+
+import (
+	"math/rand"
+	"net"
+	"time"
+)
+
+type Flow struct {
+	SourceIP        net.IP
+	DestinationIP   net.IP
+	SourcePort      uint16
+	DestinationPort uint16
+	Protocol        uint8
+	ByteCount       uint32
+	PacketCount     uint32
+	StartTime       time.Time
+	EndTime         time.Time
+}
+
+// Generated flows are spread across the last whole Window before generation,
+// so that runs with the same seed fall into the same analysis windows.
+const (
+	Window        = time.Hour
+	MaxDuration   = 30 * time.Second
+	AvgPacketSize = 512
+)
+
+// WindowStart is the start of the window generated flows are placed in.
+func WindowStart() time.Time {
+	return time.Now().Truncate(Window).Add(-Window)
+}
+
+// RandomIP returns a random IPv4 address drawn from r.
+func RandomIP(r *rand.Rand) net.IP {
+	return net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+}
+
+// Generator produces synthetic flows from its own random source, so that the
+// same seed reproduces the same flows.
+type Generator struct {
+	rand *rand.Rand
+}
+
+func NewGenerator(r *rand.Rand) *Generator {
+	return &Generator{rand: r}
+}
+
+func (g *Generator) IPs(nodeCount int) []net.IP {
+	ips := make([]net.IP, nodeCount)
+	for i := 0; i < nodeCount; i++ {
+		ips[i] = RandomIP(g.rand)
+	}
+	return ips
+}
+
+// Flows returns edgeCount flows between random pairs of nodeCount hosts.
+func (g *Generator) Flows(nodeCount, edgeCount int) []Flow {
+	r := g.rand
+	ips := g.IPs(nodeCount)
+	flows := make([]Flow, edgeCount)
+	windowStart := WindowStart()
+
+	for i := 0; i < edgeCount; i++ {
+		srcIP := ips[r.Intn(nodeCount)]
+		dstIP := ips[r.Intn(nodeCount)]
+		for srcIP.Equal(dstIP) {
+			dstIP = ips[r.Intn(nodeCount)]
+		}
+
+		byteCount := r.Uint32() % 100000
+		startTime := windowStart.Add(time.Duration(r.Int63n(int64(Window))))
+
+		flows[i] = Flow{
+			SourceIP:        srcIP,
+			DestinationIP:   dstIP,
+			SourcePort:      uint16(r.Uint32() % 65536),
+			DestinationPort: uint16(r.Uint32() % 65536),
+			Protocol:        uint8(r.Intn(3)),
+			ByteCount:       byteCount,
+			PacketCount:     byteCount/AvgPacketSize + 1,
+			StartTime:       startTime,
+			EndTime:         startTime.Add(time.Duration(r.Int63n(int64(MaxDuration)))),
+		}
+	}
+
+	return flows
+}
@@ -0,0 +1,263 @@
+// Package graph writes flows out as a host graph for Gephi and Graphviz, one
+// node per host and one edge per communicating pair.
+package graph
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"analytics/flow"
+)
+
+// graphNode and graphEdge aggregate the flows between each pair of hosts into
+// the attributes that are written out for Gephi and Graphviz.
+type graphNode struct {
+	ip     string
+	subnet string
+	degree int
+	bytes  uint64
+}
+
+type graphEdge struct {
+	source string
+	target string
+	flows  int
+	bytes  uint64
+	ports  map[uint16]bool
+}
+
+type flowGraph struct {
+	nodes []*graphNode
+	edges []*graphEdge
+}
+
+func buildFlowGraph(flows []flow.Flow) *flowGraph {
+	nodes := make(map[string]*graphNode)
+	edges := make(map[string]*graphEdge)
+
+	node := func(f flow.Flow, source bool) *graphNode {
+		ip := f.DestinationIP
+		if source {
+			ip = f.SourceIP
+		}
+		n, ok := nodes[ip.String()]
+		if !ok {
+			n = &graphNode{ip: ip.String(), subnet: subnet(ip)}
+			nodes[n.ip] = n
+		}
+		return n
+	}
+
+	for _, f := range flows {
+		src := node(f, true)
+		dst := node(f, false)
+
+		key := src.ip + "->" + dst.ip
+		e, ok := edges[key]
+		if !ok {
+			e = &graphEdge{source: src.ip, target: dst.ip, ports: make(map[uint16]bool)}
+			edges[key] = e
+			src.degree++
+			dst.degree++
+		}
+		e.flows++
+		e.bytes += uint64(f.ByteCount)
+		e.ports[f.DestinationPort] = true
+
+		src.bytes += uint64(f.ByteCount)
+		dst.bytes += uint64(f.ByteCount)
+	}
+
+	g := &flowGraph{}
+	for _, n := range nodes {
+		g.nodes = append(g.nodes, n)
+	}
+	for _, e := range edges {
+		g.edges = append(g.edges, e)
+	}
+	sort.Slice(g.nodes, func(i, j int) bool { return g.nodes[i].ip < g.nodes[j].ip })
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i].source != g.edges[j].source {
+			return g.edges[i].source < g.edges[j].source
+		}
+		return g.edges[i].target < g.edges[j].target
+	})
+
+	return g
+}
+
+// subnet is the network an address is grouped into: its classful network for
+// IPv4 and its /64 for IPv6, which has no classes. It is empty for an address
+// that is neither.
+func subnet(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.Mask(ip.DefaultMask()).String()
+	}
+	if len(ip) == net.IPv6len {
+		return ip.Mask(net.CIDRMask(64, 128)).String()
+	}
+	return ""
+}
+
+// portList renders the destination ports seen on an edge in ascending order.
+func (e *graphEdge) portList() string {
+	ports := make([]int, 0, len(e.ports))
+	for port := range e.ports {
+		ports = append(ports, int(port))
+	}
+	sort.Ints(ports)
+
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(port)
+	}
+	return strings.Join(parts, " ")
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Export writes the flow graph to path, choosing GraphML, GEXF or DOT from the
+// file extension.
+func Export(path string, flows []flow.Flow) error {
+	var write func(io.Writer, *flowGraph) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".graphml":
+		write = writeGraphML
+	case ".gexf":
+		write = writeGEXF
+	case ".dot", ".gv":
+		write = writeDOT
+	default:
+		return fmt.Errorf("unknown graph format %q, use .graphml, .gexf or .dot", filepath.Ext(path))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := write(w, buildFlowGraph(flows)); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeGraphML(w io.Writer, g *flowGraph) error {
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`)
+	fmt.Fprintln(w, `  <key id="ip" for="node" attr.name="ip" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="subnet" for="node" attr.name="subnet" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <key id="degree" for="node" attr.name="degree" attr.type="int"/>`)
+	fmt.Fprintln(w, `  <key id="nbytes" for="node" attr.name="bytes" attr.type="long"/>`)
+	fmt.Fprintln(w, `  <key id="flows" for="edge" attr.name="flows" attr.type="int"/>`)
+	fmt.Fprintln(w, `  <key id="ebytes" for="edge" attr.name="bytes" attr.type="long"/>`)
+	fmt.Fprintln(w, `  <key id="ports" for="edge" attr.name="ports" attr.type="string"/>`)
+	fmt.Fprintln(w, `  <graph id="flows" edgedefault="directed">`)
+
+	for _, n := range g.nodes {
+		fmt.Fprintf(w, "    <node id=\"%s\">\n", xmlEscape(n.ip))
+		fmt.Fprintf(w, "      <data key=\"ip\">%s</data>\n", xmlEscape(n.ip))
+		fmt.Fprintf(w, "      <data key=\"subnet\">%s</data>\n", xmlEscape(n.subnet))
+		fmt.Fprintf(w, "      <data key=\"degree\">%d</data>\n", n.degree)
+		fmt.Fprintf(w, "      <data key=\"nbytes\">%d</data>\n", n.bytes)
+		fmt.Fprintln(w, "    </node>")
+	}
+
+	for i, e := range g.edges {
+		fmt.Fprintf(w, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, xmlEscape(e.source), xmlEscape(e.target))
+		fmt.Fprintf(w, "      <data key=\"flows\">%d</data>\n", e.flows)
+		fmt.Fprintf(w, "      <data key=\"ebytes\">%d</data>\n", e.bytes)
+		fmt.Fprintf(w, "      <data key=\"ports\">%s</data>\n", e.portList())
+		fmt.Fprintln(w, "    </edge>")
+	}
+
+	fmt.Fprintln(w, "  </graph>")
+	_, err := fmt.Fprintln(w, "</graphml>")
+	return err
+}
+
+func writeGEXF(w io.Writer, g *flowGraph) error {
+	fmt.Fprintln(w, `<?xml version="1.0" encoding="UTF-8"?>`)
+	fmt.Fprintln(w, `<gexf xmlns="http://gexf.net/1.2" version="1.2">`)
+	fmt.Fprintln(w, `  <graph mode="static" defaultedgetype="directed">`)
+	fmt.Fprintln(w, `    <attributes class="node">`)
+	fmt.Fprintln(w, `      <attribute id="0" title="ip" type="string"/>`)
+	fmt.Fprintln(w, `      <attribute id="1" title="subnet" type="string"/>`)
+	fmt.Fprintln(w, `      <attribute id="2" title="degree" type="integer"/>`)
+	fmt.Fprintln(w, `      <attribute id="3" title="bytes" type="long"/>`)
+	fmt.Fprintln(w, `    </attributes>`)
+	fmt.Fprintln(w, `    <attributes class="edge">`)
+	fmt.Fprintln(w, `      <attribute id="0" title="flows" type="integer"/>`)
+	fmt.Fprintln(w, `      <attribute id="1" title="bytes" type="long"/>`)
+	fmt.Fprintln(w, `      <attribute id="2" title="ports" type="string"/>`)
+	fmt.Fprintln(w, `    </attributes>`)
+
+	fmt.Fprintln(w, "    <nodes>")
+	for _, n := range g.nodes {
+		fmt.Fprintf(w, "      <node id=\"%s\" label=\"%s\">\n", xmlEscape(n.ip), xmlEscape(n.ip))
+		fmt.Fprintln(w, "        <attvalues>")
+		fmt.Fprintf(w, "          <attvalue for=\"0\" value=\"%s\"/>\n", xmlEscape(n.ip))
+		fmt.Fprintf(w, "          <attvalue for=\"1\" value=\"%s\"/>\n", xmlEscape(n.subnet))
+		fmt.Fprintf(w, "          <attvalue for=\"2\" value=\"%d\"/>\n", n.degree)
+		fmt.Fprintf(w, "          <attvalue for=\"3\" value=\"%d\"/>\n", n.bytes)
+		fmt.Fprintln(w, "        </attvalues>")
+		fmt.Fprintln(w, "      </node>")
+	}
+	fmt.Fprintln(w, "    </nodes>")
+
+	fmt.Fprintln(w, "    <edges>")
+	for i, e := range g.edges {
+		// Gephi draws edge thickness from the weight, so weight by flow count
+		fmt.Fprintf(w, "      <edge id=\"%d\" source=\"%s\" target=\"%s\" weight=\"%d\">\n", i, xmlEscape(e.source), xmlEscape(e.target), e.flows)
+		fmt.Fprintln(w, "        <attvalues>")
+		fmt.Fprintf(w, "          <attvalue for=\"0\" value=\"%d\"/>\n", e.flows)
+		fmt.Fprintf(w, "          <attvalue for=\"1\" value=\"%d\"/>\n", e.bytes)
+		fmt.Fprintf(w, "          <attvalue for=\"2\" value=\"%s\"/>\n", e.portList())
+		fmt.Fprintln(w, "        </attvalues>")
+		fmt.Fprintln(w, "      </edge>")
+	}
+	fmt.Fprintln(w, "    </edges>")
+
+	fmt.Fprintln(w, "  </graph>")
+	_, err := fmt.Fprintln(w, "</gexf>")
+	return err
+}
+
+// dotID quotes s as a DOT ID. Inside DOT's double quotes only the quote itself
+// is escaped; %q writes Go escapes for backslashes and unprintable characters,
+// which DOT would read literally.
+func dotID(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func writeDOT(w io.Writer, g *flowGraph) error {
+	fmt.Fprintln(w, "digraph flows {")
+
+	for _, n := range g.nodes {
+		fmt.Fprintf(w, "  %s [ip=%s, subnet=%s, degree=%d, bytes=%d];\n", dotID(n.ip), dotID(n.ip), dotID(n.subnet), n.degree, n.bytes)
+	}
+
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "  %s -> %s [flows=%d, bytes=%d, ports=%s];\n", dotID(e.source), dotID(e.target), e.flows, e.bytes, dotID(e.portList()))
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
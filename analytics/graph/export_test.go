@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"analytics/flow"
+)
+
+func TestDOTID(t *testing.T) {
+	for s, want := range map[string]string{
+		"10.0.0.1":    `"10.0.0.1"`,
+		"80 443":      `"80 443"`,
+		`say "hi"`:    `"say \"hi\""`,
+		`C:\flows`:    `"C:\flows"`,
+		"naïve\tnode": "\"naïve\tnode\"",
+	} {
+		if got := dotID(s); got != want {
+			t.Errorf("dotID(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	flows := []flow.Flow{
+		{SourceIP: net.ParseIP("10.0.0.1"), DestinationIP: net.ParseIP("10.0.0.2"), DestinationPort: 443, ByteCount: 100},
+		{SourceIP: net.ParseIP("10.0.0.1"), DestinationIP: net.ParseIP("10.0.0.2"), DestinationPort: 80, ByteCount: 50},
+	}
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "flows.dot")
+	if err := Export(path, flows); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `  "10.0.0.1" -> "10.0.0.2" [flows=2, bytes=150, ports="80 443"];`
+	if !strings.Contains(string(data), want) {
+		t.Errorf("DOT output has no line\n%s\nin\n%s", want, data)
+	}
+
+	for _, name := range []string{"flows.graphml", "flows.gexf"} {
+		if err := Export(filepath.Join(dir, name), flows); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if err := Export(filepath.Join(dir, "flows.png"), flows); err == nil {
+		t.Error("exported to an unknown format")
+	}
+}
+
+func TestSubnet(t *testing.T) {
+	for ip, want := range map[string]string{
+		"10.1.2.3":             "10.0.0.0",
+		"172.16.5.4":           "172.16.0.0",
+		"192.168.1.20":         "192.168.1.0",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::",
+		"::ffff:10.1.2.3":      "10.0.0.0",
+	} {
+		if got := subnet(net.ParseIP(ip)); got != want {
+			t.Errorf("subnet(%s) = %s, want %s", ip, got, want)
+		}
+	}
+	if got := subnet(nil); got != "" {
+		t.Errorf("subnet(nil) = %q, want it empty", got)
+	}
+}
@@ -0,0 +1,333 @@
+package heavyhitter
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+	"unsafe"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+
+	"github.com/rs/zerolog"
+)
+
+// HeavyHitters finds the top talkers of every window in bounded memory.
+// Flows are counted into their window's sketches as they are ingested and
+// not kept. A window takes flows until flows arrive for the window after the
+// next, when it is closed and only its heavy hitters are kept.
+type HeavyHitters struct {
+	// Flows are grouped into tumbling windows of this size by start time
+	windowSize time.Duration
+	// Number of talkers reported per dimension
+	topK int
+	// Counters kept per sketch; the error on any count is at most total/capacity
+	capacity int
+	// Closed windows whose heavy hitters are kept
+	retain int
+
+	// open holds the sketches of the windows still taking flows, by start
+	open map[int64]*WindowSketches
+	// newest is the start of the latest window flows have arrived for
+	newest time.Time
+	// closed holds the heavy hitters of the latest retain windows that were
+	// closed, and late counts the flows that arrived for any closed window
+	// afterwards
+	closed []WindowTop
+	late   int
+
+	windows     []WindowTop
+	sketchBytes int
+}
+
+// WindowTop is the heavy hitters of one window.
+type WindowTop struct {
+	Start   time.Time
+	Hitters []HeavyHitter
+}
+
+func init() {
+	analytic.Register("heavyhitter", func() analytic.Analytic { return &HeavyHitters{} })
+}
+
+func (h *HeavyHitters) Init(cfg *config.Config) error {
+	h.windowSize = time.Duration(cfg.HeavyHitter.Window)
+	h.topK = cfg.HeavyHitter.TopK
+	h.capacity = cfg.HeavyHitter.Capacity
+	h.retain = cfg.HeavyHitter.Retain
+	h.open = make(map[int64]*WindowSketches)
+	return nil
+}
+
+// Ingest counts each flow into its window's sketches, taking the batch in
+// start time order so that its flows are not late for each other.
+func (h *HeavyHitters) Ingest(flows []flow.Flow) error {
+	order := make([]int, len(flows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return flows[order[i]].StartTime.Before(flows[order[j]].StartTime) })
+
+	for _, i := range order {
+		f := flows[i]
+		start := f.StartTime.Truncate(h.windowSize)
+		if start.After(h.newest) {
+			h.newest = start
+			h.closeBefore(start.Add(-h.windowSize))
+		}
+
+		w, ok := h.open[start.UnixNano()]
+		if !ok {
+			if start.Before(h.newest.Add(-h.windowSize)) {
+				h.late++
+				continue
+			}
+			w = NewWindowSketches(start, h.capacity)
+			h.open[start.UnixNano()] = w
+		}
+		w.Add(f)
+	}
+	return nil
+}
+
+// closeBefore closes the open windows starting before cutoff, keeping their
+// heavy hitters and dropping their sketches, and forgets the oldest closed
+// windows past the retained count.
+func (h *HeavyHitters) closeBefore(cutoff time.Time) {
+	for key, w := range h.open {
+		if w.Start.Before(cutoff) {
+			h.closed = append(h.closed, WindowTop{Start: w.Start, Hitters: w.TopK(h.topK)})
+			delete(h.open, key)
+		}
+	}
+	sort.Slice(h.closed, func(i, j int) bool { return h.closed[i].Start.Before(h.closed[j].Start) })
+	if drop := len(h.closed) - h.retain; drop > 0 {
+		h.closed = h.closed[:copy(h.closed, h.closed[drop:])]
+	}
+}
+
+// Run finds the heavy hitters of the open windows, after those of the closed
+// ones, and the memory their sketches hold.
+func (h *HeavyHitters) Run() error {
+	h.windows = append(h.windows[:0], h.closed...)
+	h.sketchBytes = 0
+	for _, w := range h.open {
+		h.windows = append(h.windows, WindowTop{Start: w.Start, Hitters: w.TopK(h.topK)})
+		h.sketchBytes += w.MemoryBytes()
+	}
+	sort.Slice(h.windows, func(i, j int) bool { return h.windows[i].Start.Before(h.windows[j].Start) })
+	return nil
+}
+
+// Report adds the heavy hitters of the latest window to the tick's event.
+func (h *HeavyHitters) Report(e *zerolog.Event) {
+	e.Int("windows", len(h.windows)).Int("late", h.late).Int("sketchbytes", h.sketchBytes)
+	if len(h.windows) == 0 {
+		return
+	}
+
+	latest := h.windows[len(h.windows)-1]
+	top := zerolog.Arr()
+	for _, hitter := range latest.Hitters {
+		top.Dict(zerolog.Dict().Str("dimension", hitter.Dimension).Str("key", hitter.Key).Uint64("count", hitter.Count).Uint64("error", hitter.Error).Bool("guaranteed", hitter.Guaranteed))
+	}
+	e.Time("window", latest.Start).Array("top", top)
+}
+
+// ssEntry is a Space-Saving counter. Count over-estimates the true weight of
+// the key by at most Error.
+type ssEntry struct {
+	Key   string
+	Count uint64
+	Error uint64
+	index int
+}
+
+// SpaceSaving tracks the heaviest keys of a weighted stream in a fixed number
+// of counters (Metwally et al., 2005). When a new key arrives and the sketch is
+// full it evicts the smallest counter and inherits its count as error.
+type SpaceSaving struct {
+	capacity int
+	entries  map[string]*ssEntry
+	minHeap  ssHeap
+}
+
+type ssHeap []*ssEntry
+
+func (h ssHeap) Len() int           { return len(h) }
+func (h ssHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *ssHeap) Push(x interface{}) {
+	e := x.(*ssEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *ssHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+func NewSpaceSaving(capacity int) *SpaceSaving {
+	return &SpaceSaving{
+		capacity: capacity,
+		entries:  make(map[string]*ssEntry, capacity),
+		minHeap:  make(ssHeap, 0, capacity),
+	}
+}
+
+func (s *SpaceSaving) Add(key string, weight uint64) {
+	if e, ok := s.entries[key]; ok {
+		e.Count += weight
+		heap.Fix(&s.minHeap, e.index)
+		return
+	}
+
+	if len(s.minHeap) < s.capacity {
+		e := &ssEntry{Key: key, Count: weight}
+		s.entries[key] = e
+		heap.Push(&s.minHeap, e)
+		return
+	}
+
+	// Replace the smallest counter, which bounds how much the new key could
+	// have been seen before
+	e := s.minHeap[0]
+	delete(s.entries, e.Key)
+	e.Key = key
+	e.Error = e.Count
+	e.Count += weight
+	s.entries[key] = e
+	heap.Fix(&s.minHeap, 0)
+}
+
+// Top returns the k largest counters, heaviest first.
+func (s *SpaceSaving) Top(k int) []ssEntry {
+	top := make([]ssEntry, 0, len(s.minHeap))
+	for _, e := range s.minHeap {
+		top = append(top, *e)
+	}
+	sort.Slice(top, func(i, j int) bool { return top[i].Count > top[j].Count })
+
+	if len(top) > k {
+		top = top[:k]
+	}
+	return top
+}
+
+// MemoryBytes estimates the memory held by the sketch: the counters, their
+// keys, the heap slice and one map bucket slot per counter.
+func (s *SpaceSaving) MemoryBytes() int {
+	entrySize := int(unsafe.Sizeof(ssEntry{}))
+	pointerSize := int(unsafe.Sizeof(&ssEntry{}))
+	keySize := int(unsafe.Sizeof(""))
+
+	size := int(unsafe.Sizeof(*s)) + cap(s.minHeap)*pointerSize
+	for key := range s.entries {
+		size += entrySize + len(key) + keySize + pointerSize
+	}
+	return size
+}
+
+type HeavyHitter struct {
+	Dimension string
+	Key       string
+	Count     uint64
+	Error     uint64
+	// Guaranteed is set when the key is certainly in the true top-K
+	Guaranteed bool
+}
+
+// WindowSketches holds the six sketches kept for one window.
+type WindowSketches struct {
+	Start       time.Time
+	SourceBytes *SpaceSaving
+	SourceFlows *SpaceSaving
+	DestBytes   *SpaceSaving
+	DestFlows   *SpaceSaving
+	PairBytes   *SpaceSaving
+	PairFlows   *SpaceSaving
+}
+
+func NewWindowSketches(start time.Time, capacity int) *WindowSketches {
+	return &WindowSketches{
+		Start:       start,
+		SourceBytes: NewSpaceSaving(capacity),
+		SourceFlows: NewSpaceSaving(capacity),
+		DestBytes:   NewSpaceSaving(capacity),
+		DestFlows:   NewSpaceSaving(capacity),
+		PairBytes:   NewSpaceSaving(capacity),
+		PairFlows:   NewSpaceSaving(capacity),
+	}
+}
+
+func (w *WindowSketches) Add(f flow.Flow) {
+	src := f.SourceIP.String()
+	dst := f.DestinationIP.String()
+	pair := src + "->" + dst
+	bytes := uint64(f.ByteCount)
+
+	w.SourceBytes.Add(src, bytes)
+	w.SourceFlows.Add(src, 1)
+	w.DestBytes.Add(dst, bytes)
+	w.DestFlows.Add(dst, 1)
+	w.PairBytes.Add(pair, bytes)
+	w.PairFlows.Add(pair, 1)
+}
+
+type dimension struct {
+	name   string
+	sketch *SpaceSaving
+}
+
+func (w *WindowSketches) dimensions() []dimension {
+	return []dimension{
+		{"src_bytes", w.SourceBytes},
+		{"src_flows", w.SourceFlows},
+		{"dst_bytes", w.DestBytes},
+		{"dst_flows", w.DestFlows},
+		{"pair_bytes", w.PairBytes},
+		{"pair_flows", w.PairFlows},
+	}
+}
+
+func (w *WindowSketches) MemoryBytes() int {
+	size := 0
+	for _, d := range w.dimensions() {
+		size += d.sketch.MemoryBytes()
+	}
+	return size
+}
+
+func (w *WindowSketches) TopK(k int) []HeavyHitter {
+	var hitters []HeavyHitter
+
+	for _, d := range w.dimensions() {
+		// A key is certainly a top-K key if its lowest possible count beats the
+		// highest possible count of the first key outside the top-K
+		top := d.sketch.Top(k + 1)
+		var runnerUp uint64
+		if len(top) > k {
+			runnerUp = top[k].Count
+			top = top[:k]
+		}
+
+		for _, e := range top {
+			hitters = append(hitters, HeavyHitter{
+				Dimension:  d.name,
+				Key:        e.Key,
+				Count:      e.Count,
+				Error:      e.Error,
+				Guaranteed: e.Count-e.Error >= runnerUp,
+			})
+		}
+	}
+
+	return hitters
+}
@@ -0,0 +1,125 @@
+package heavyhitter
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"analytics/config"
+	"analytics/flow"
+)
+
+func TestSpaceSavingTopOrder(t *testing.T) {
+	s := NewSpaceSaving(4)
+	for key, weight := range map[string]uint64{"a": 50, "b": 10, "c": 30} {
+		s.Add(key, weight)
+	}
+	s.Add("b", 30)
+
+	top := s.Top(2)
+	if len(top) != 2 || top[0].Key != "a" || top[1].Key != "b" || top[1].Count != 40 {
+		t.Errorf("top 2 is %+v, want a at 50 then b at 40", top)
+	}
+	for _, e := range top {
+		if e.Error != 0 {
+			t.Errorf("%s has error %d before anything was evicted", e.Key, e.Error)
+		}
+	}
+}
+
+// An evicting key inherits the smallest count as its error, so its count
+// over-estimates its true weight by no more than that.
+func TestSpaceSavingEvictionBounds(t *testing.T) {
+	s := NewSpaceSaving(2)
+	s.Add("a", 100)
+	s.Add("b", 7)
+	s.Add("c", 5)
+
+	top := s.Top(2)
+	if top[0].Key != "a" || top[0].Count != 100 || top[0].Error != 0 {
+		t.Errorf("heaviest is %+v, want a untouched", top[0])
+	}
+	c := top[1]
+	if c.Key != "c" || c.Count != 12 || c.Error != 7 {
+		t.Fatalf("evicting b gave %+v, want c counted 12 with an error of 7", c)
+	}
+	if c.Count-c.Error > 5 || c.Count < 5 {
+		t.Errorf("c's count %d less error %d does not bound its true weight of 5", c.Count, c.Error)
+	}
+
+	// Every true weight lies within its counter's bounds, whatever the
+	// interleaving
+	truth := map[string]uint64{}
+	s = NewSpaceSaving(8)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("k%d", i*i%37)
+		weight := uint64(i%13 + 1)
+		truth[key] += weight
+		s.Add(key, weight)
+	}
+	for _, e := range s.Top(8) {
+		if e.Count < truth[e.Key] || e.Count-e.Error > truth[e.Key] {
+			t.Errorf("%s counted %d with error %d, but weighs %d", e.Key, e.Count, e.Error, truth[e.Key])
+		}
+	}
+}
+
+// A key is guaranteed to be in the top K when its lowest possible count
+// reaches the highest possible count of the first key outside it.
+func TestGuaranteed(t *testing.T) {
+	w := NewWindowSketches(time.Time{}, 3)
+	add := func(src string, bytes uint32) {
+		w.Add(flow.Flow{SourceIP: net.ParseIP(src), DestinationIP: net.ParseIP("10.0.0.254"), ByteCount: bytes})
+	}
+	add("10.0.0.1", 1000)
+	add("10.0.0.2", 300)
+	add("10.0.0.3", 200)
+	// Evicts 10.0.0.3, leaving 10.0.0.4 at 400 with an error of 200
+	add("10.0.0.4", 200)
+
+	got := map[string]HeavyHitter{}
+	for _, h := range w.TopK(2) {
+		if h.Dimension == "src_bytes" {
+			got[h.Key] = h
+		}
+	}
+	if len(got) != 2 {
+		t.Fatalf("top 2 source bytes are %+v", got)
+	}
+	if h := got["10.0.0.1"]; !h.Guaranteed {
+		t.Errorf("10.0.0.1 at 1000 with no error is not guaranteed: %+v", h)
+	}
+	if h := got["10.0.0.4"]; h.Count != 400 || h.Error != 200 || h.Guaranteed {
+		t.Errorf("10.0.0.4 at 400 less 200 error is guaranteed over 10.0.0.2 at 300: %+v", h)
+	}
+}
+
+// Closed windows beyond the retained count are forgotten, oldest first, so a
+// long run holds a bounded history.
+func TestClosedWindowsRetained(t *testing.T) {
+	cfg := config.Default()
+	cfg.HeavyHitter.Window = config.Duration(time.Minute)
+	cfg.HeavyHitter.Retain = 3
+	h := &HeavyHitters{}
+	if err := h.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		h.Ingest([]flow.Flow{{SourceIP: net.IPv4(10, 0, 0, byte(i)), DestinationIP: net.IPv4(10, 0, 1, 1), ByteCount: 100, StartTime: at, EndTime: at}})
+	}
+	if err := h.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three closed windows and the two still open
+	if len(h.closed) != 3 || len(h.windows) != 5 {
+		t.Fatalf("kept %d closed windows and reported %d, want 3 and 5", len(h.closed), len(h.windows))
+	}
+	if first := h.windows[0].Start; !first.Equal(start.Add(5 * time.Minute)) {
+		t.Errorf("oldest window kept starts %v, want the sixth", first)
+	}
+}
@@ -0,0 +1,114 @@
+// Package metrics exports the runner's counters to Prometheus on /metrics,
+// alongside the Go runtime and process CPU and memory collectors.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	computeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "analytic_compute_duration_seconds",
+		Help: "Wall clock time of each analytic Run.",
+		// 100µs up to ~26s
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 19),
+	}, []string{"analytic"})
+
+	computeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "analytic_compute_failures_total",
+		Help: "Runs that returned an error.",
+	}, []string{"analytic"})
+
+	flowsIngested = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "analytic_flows_ingested_total",
+		Help: "Flows handed to the analytic.",
+	}, []string{"analytic"})
+
+	detections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "analytic_detections",
+		Help: "Detections raised by the latest run. The analytics recompute over the data they hold on every run, so a run's count includes those already raised.",
+	}, []string{"analytic"})
+
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "analytic_queue_depth",
+		Help: "Scheduled runs that were due but had not started when the last run finished, for the open loop schedules.",
+	}, []string{"analytic"})
+
+	scheduleLag = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "analytic_schedule_lag_seconds",
+		Help:    "How long after its scheduled time each run started.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 19),
+	}, []string{"analytic"})
+
+	missedDeadlines = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "analytic_missed_deadlines_total",
+		Help: "Runs that finished more than one period after they were scheduled.",
+	}, []string{"analytic"})
+
+	registry = prometheus.NewRegistry()
+)
+
+func init() {
+	registry.MustRegister(
+		computeDuration,
+		computeFailures,
+		flowsIngested,
+		detections,
+		queueDepth,
+		scheduleLag,
+		missedDeadlines,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Serve starts the /metrics endpoint on addr in the background. Failing to
+// listen is logged rather than stopping the experiment.
+func Serve(addr string) {
+	mux := handler()
+	go func() {
+		log.Info().Str("addr", addr).Msg("Serving metrics")
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("Error: metrics endpoint stopped")
+		}
+	}()
+}
+
+func handler() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+func ObserveCompute(analytic string, elapsed time.Duration) {
+	computeDuration.WithLabelValues(analytic).Observe(elapsed.Seconds())
+}
+
+func ComputeFailed(analytic string) {
+	computeFailures.WithLabelValues(analytic).Inc()
+}
+
+func FlowsIngested(analytic string, count int) {
+	flowsIngested.WithLabelValues(analytic).Add(float64(count))
+}
+
+func SetDetections(analytic string, count int) {
+	detections.WithLabelValues(analytic).Set(float64(count))
+}
+
+func ObserveLag(analytic string, lag time.Duration, missed bool) {
+	scheduleLag.WithLabelValues(analytic).Observe(lag.Seconds())
+	if missed {
+		missedDeadlines.WithLabelValues(analytic).Inc()
+	}
+}
+
+func SetQueueDepth(analytic string, depth int) {
+	queueDepth.WithLabelValues(analytic).Set(float64(depth))
+}
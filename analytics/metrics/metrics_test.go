@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrape(t *testing.T) {
+	ObserveCompute("scrape-test", 3*time.Millisecond)
+	ObserveCompute("scrape-test", 40*time.Millisecond)
+	ComputeFailed("scrape-test")
+	FlowsIngested("scrape-test", 1200)
+	SetDetections("scrape-test", 9)
+	SetDetections("scrape-test", 7)
+	ObserveLag("scrape-test", time.Millisecond, true)
+	SetQueueDepth("scrape-test", 2)
+
+	server := httptest.NewServer(handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/metrics answered %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(body)
+
+	for _, want := range []string{
+		"# TYPE analytic_compute_duration_seconds histogram",
+		`analytic_compute_duration_seconds_bucket{analytic="scrape-test",le="0.0016"} 0`,
+		`analytic_compute_duration_seconds_bucket{analytic="scrape-test",le="0.0032"} 1`,
+		`analytic_compute_duration_seconds_bucket{analytic="scrape-test",le="0.0512"} 2`,
+		`analytic_compute_duration_seconds_bucket{analytic="scrape-test",le="+Inf"} 2`,
+		`analytic_compute_duration_seconds_count{analytic="scrape-test"} 2`,
+		`analytic_compute_failures_total{analytic="scrape-test"} 1`,
+		`analytic_flows_ingested_total{analytic="scrape-test"} 1200`,
+		`analytic_detections{analytic="scrape-test"} 7`,
+		`analytic_schedule_lag_seconds_count{analytic="scrape-test"} 1`,
+		`analytic_missed_deadlines_total{analytic="scrape-test"} 1`,
+		`analytic_queue_depth{analytic="scrape-test"} 2`,
+		"go_goroutines",
+		"process_resident_memory_bytes",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("/metrics has no %s", want)
+		}
+	}
+}
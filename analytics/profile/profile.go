@@ -0,0 +1,161 @@
+// Package profile exposes net/http/pprof and captures CPU, heap and execution
+// trace profiles of a chosen range of iterations into the results directory.
+package profile
+
+import (
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"analytics/config"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Serve starts the pprof endpoint on addr in the background. Failing to
+// listen is logged rather than stopping the experiment.
+func Serve(addr string) {
+	go func() {
+		log.Info().Str("addr", addr).Msg("Serving pprof")
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Error().Err(err).Str("addr", addr).Msg("Error: pprof endpoint stopped")
+		}
+	}()
+}
+
+// Capture profiles iterations from..to of a run. Before and After are called
+// around every iteration and do nothing outside that range.
+type Capture struct {
+	cfg   config.Profile
+	dir   string
+	runID string
+
+	cpu   *os.File
+	trace *os.File
+}
+
+func NewCapture(cfg config.Profile, dir, runID string) *Capture {
+	if cfg.To < cfg.From {
+		cfg.To = cfg.From
+	}
+	return &Capture{cfg: cfg, dir: dir, runID: runID}
+}
+
+func (c *Capture) path(kind, ext string) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%s.%s", c.runID, kind, ext))
+}
+
+// Before starts the CPU profile and execution trace ahead of iteration From.
+func (c *Capture) Before(iteration int) error {
+	if c.cfg.From == 0 || iteration != c.cfg.From {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	if c.cfg.CPU {
+		f, err := os.Create(c.path("cpu", "pprof"))
+		if err != nil {
+			return err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		c.cpu = f
+	}
+
+	if c.cfg.Trace {
+		f, err := os.Create(c.path("trace", "out"))
+		if err != nil {
+			return err
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			return err
+		}
+		c.trace = f
+	}
+
+	log.Info().Str("run", c.runID).Int("from", c.cfg.From).Int("to", c.cfg.To).Msg("Profiling started")
+	return nil
+}
+
+// After stops the CPU profile and trace once iteration To has run and writes
+// the heap profile.
+func (c *Capture) After(iteration int) error {
+	if c.cfg.From == 0 || iteration != c.cfg.To {
+		return nil
+	}
+
+	files, err := c.stop()
+	if err != nil {
+		return err
+	}
+
+	if c.cfg.Heap {
+		f, err := os.Create(c.path("heap", "pprof"))
+		if err != nil {
+			return err
+		}
+		// The heap profile is only as current as the last GC
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		files = append(files, f.Name())
+	}
+
+	log.Info().Str("run", c.runID).Strs("files", files).Msg("Profiling finished")
+	return nil
+}
+
+// Close stops a CPU profile or trace that is still running because the run
+// ended before iteration To, so that what was captured is still readable.
+func (c *Capture) Close() error {
+	if c.cpu == nil && c.trace == nil {
+		return nil
+	}
+
+	files, err := c.stop()
+	if err != nil {
+		return err
+	}
+	log.Info().Str("run", c.runID).Strs("files", files).Msg("Profiling stopped early")
+	return nil
+}
+
+func (c *Capture) stop() ([]string, error) {
+	var files []string
+
+	if c.cpu != nil {
+		pprof.StopCPUProfile()
+		if err := c.cpu.Close(); err != nil {
+			return files, err
+		}
+		files = append(files, c.cpu.Name())
+		c.cpu = nil
+	}
+
+	if c.trace != nil {
+		trace.Stop()
+		if err := c.trace.Close(); err != nil {
+			return files, err
+		}
+		files = append(files, c.trace.Name())
+		c.trace = nil
+	}
+
+	return files, nil
+}
@@ -0,0 +1,49 @@
+package resources
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ResetPeakRSS starts the process's peak resident set again from its current
+// resident set, so that PeakRSS covers only what runs after it. ru_maxrss
+// cannot be reset, but the kernel's VmHWM can be, by writing 5 to
+// /proc/self/clear_refs.
+func ResetPeakRSS() error {
+	return os.WriteFile("/proc/self/clear_refs", []byte("5"), 0)
+}
+
+// PeakRSS is the process's peak resident set in bytes since it started or
+// ResetPeakRSS was last called, read from VmHWM in /proc/self/status.
+func PeakRSS() (uint64, error) {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !bytes.HasPrefix(line, []byte("VmHWM:")) {
+			continue
+		}
+		// The value is in kilobytes, as "VmHWM:	  123456 kB"
+		fields := bytes.Fields(line[len("VmHWM:"):])
+		if len(fields) != 2 || string(fields[1]) != "kB" {
+			return 0, fmt.Errorf("/proc/self/status: unexpected VmHWM line %q", line)
+		}
+		kb, err := strconv.ParseUint(string(fields[0]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("/proc/self/status: VmHWM: %v", err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("/proc/self/status has no VmHWM")
+}
@@ -0,0 +1,45 @@
+package resources
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestPeakRSSResets(t *testing.T) {
+	if err := ResetPeakRSS(); err != nil {
+		t.Skipf("cannot reset the peak resident set here: %v", err)
+	}
+	before, err := PeakRSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Touch every page so that it is resident
+	buf := make([]byte, 64<<20)
+	for i := 0; i < len(buf); i += 4096 {
+		buf[i] = 1
+	}
+	grown, err := PeakRSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.KeepAlive(buf)
+	if grown < before+32<<20 {
+		t.Fatalf("peak grew from %d to %d bytes after touching 64MiB", before, grown)
+	}
+
+	// Once the memory is handed back, a reset peak no longer includes it
+	buf = nil
+	debug.FreeOSMemory()
+	if err := ResetPeakRSS(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := PeakRSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after > grown-32<<20 {
+		t.Errorf("peak was %d bytes after a reset, down from %d with 64MiB freed", after, grown)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package resources
+
+import "errors"
+
+var errNoPeakRSS = errors.New("the peak resident set can only be measured on Linux")
+
+func ResetPeakRSS() error {
+	return errNoPeakRSS
+}
+
+func PeakRSS() (uint64, error) {
+	return 0, errNoPeakRSS
+}
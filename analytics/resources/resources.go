@@ -0,0 +1,143 @@
+// Package resources measures what a computation costs the process: CPU time
+// from getrusage and allocation and GC activity from runtime/metrics. It lets
+// every tick carry its own resource cost instead of relying on docker stats.
+package resources
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	allocBytes   = "/gc/heap/allocs:bytes"
+	allocObjects = "/gc/heap/allocs:objects"
+	gcCycles     = "/gc/cycles/total:gc-cycles"
+	gcPauses     = "/gc/pauses:seconds"
+	heapObjects  = "/memory/classes/heap/objects:bytes"
+	heapGoal     = "/gc/heap/goal:bytes"
+)
+
+// Snapshot is the process's cumulative resource counters at one instant.
+type Snapshot struct {
+	cpuUser time.Duration
+	cpuSys  time.Duration
+	maxRSS  uint64
+	samples []metrics.Sample
+}
+
+// Usage is the difference between two snapshots.
+type Usage struct {
+	CPUUser      time.Duration
+	CPUSys       time.Duration
+	AllocBytes   uint64
+	AllocObjects uint64
+	GCCycles     uint64
+	// GCPause is estimated from the midpoints of the pause histogram buckets
+	GCPause time.Duration
+	// PeakHeap is the larger of the live heap at either end of the interval
+	// and, if a collection ran, the heap goal it was triggered at
+	PeakHeap uint64
+	// MaxRSS is the peak resident set of the process so far, not just the
+	// interval
+	MaxRSS uint64
+}
+
+// Take reads the counters now.
+func Take() Snapshot {
+	s := Snapshot{
+		samples: []metrics.Sample{
+			{Name: allocBytes},
+			{Name: allocObjects},
+			{Name: gcCycles},
+			{Name: gcPauses},
+			{Name: heapObjects},
+			{Name: heapGoal},
+		},
+	}
+	metrics.Read(s.samples)
+	s.cpuUser, s.cpuSys, s.maxRSS = rusage()
+	return s
+}
+
+func (s Snapshot) uint64(i int) uint64 {
+	if s.samples[i].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return s.samples[i].Value.Uint64()
+}
+
+func (s Snapshot) pauses() *metrics.Float64Histogram {
+	if s.samples[3].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil
+	}
+	return s.samples[3].Value.Float64Histogram()
+}
+
+// Since returns the resources used between start and s.
+func (s Snapshot) Since(start Snapshot) Usage {
+	u := Usage{
+		CPUUser:      s.cpuUser - start.cpuUser,
+		CPUSys:       s.cpuSys - start.cpuSys,
+		AllocBytes:   s.uint64(0) - start.uint64(0),
+		AllocObjects: s.uint64(1) - start.uint64(1),
+		GCCycles:     s.uint64(2) - start.uint64(2),
+		GCPause:      pauseDelta(start.pauses(), s.pauses()),
+		PeakHeap:     start.uint64(4),
+		MaxRSS:       s.maxRSS,
+	}
+
+	if heap := s.uint64(4); heap > u.PeakHeap {
+		u.PeakHeap = heap
+	}
+	if u.GCCycles > 0 {
+		if goal := start.uint64(5); goal > u.PeakHeap {
+			u.PeakHeap = goal
+		}
+	}
+
+	return u
+}
+
+// pauseDelta sums the pauses recorded between two readings of the pause
+// histogram, taking each pause as the midpoint of its bucket.
+func pauseDelta(before, after *metrics.Float64Histogram) time.Duration {
+	if after == nil {
+		return 0
+	}
+
+	seconds := 0.0
+	for i, count := range after.Counts {
+		if before != nil && i < len(before.Counts) {
+			count -= before.Counts[i]
+		}
+		if count == 0 {
+			continue
+		}
+
+		low, high := after.Buckets[i], after.Buckets[i+1]
+		if math.IsInf(low, -1) {
+			low = 0
+		}
+		if math.IsInf(high, 1) {
+			high = low
+		}
+		seconds += float64(count) * (low + high) / 2
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Log adds the usage to e, with times in microseconds like elapsed.
+func (u Usage) Log(e *zerolog.Event) *zerolog.Event {
+	return e.Int64("cpuuser", u.CPUUser.Microseconds()).
+		Int64("cpusys", u.CPUSys.Microseconds()).
+		Uint64("allocbytes", u.AllocBytes).
+		Uint64("allocobjects", u.AllocObjects).
+		Uint64("gccycles", u.GCCycles).
+		Int64("gcpause", u.GCPause.Microseconds()).
+		Uint64("heappeak", u.PeakHeap).
+		Uint64("maxrss", u.MaxRSS)
+}
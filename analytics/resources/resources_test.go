@@ -0,0 +1,63 @@
+package resources
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+var sink [][]byte
+
+// Allocating and collecting between readings shows up in the usage, and a
+// later reading from the same start never shows less.
+func TestSince(t *testing.T) {
+	start := Take()
+	for i := 0; i < 1000; i++ {
+		sink = append(sink, make([]byte, 1024))
+	}
+	runtime.GC()
+	mid := Take()
+	sink = nil
+	runtime.GC()
+	end := Take()
+
+	first, whole := mid.Since(start), end.Since(start)
+	if first.AllocBytes < 1000*1024 || first.AllocObjects < 1000 {
+		t.Errorf("allocated %d bytes in %d objects, want at least 1000 1KiB slices", first.AllocBytes, first.AllocObjects)
+	}
+	if first.GCCycles < 1 || whole.GCCycles < 2 {
+		t.Errorf("counted %d and then %d collections, want at least 1 and 2", first.GCCycles, whole.GCCycles)
+	}
+	if first.GCPause <= 0 {
+		t.Errorf("a forced collection paused for %s", first.GCPause)
+	}
+	if first.PeakHeap < 1000*1024 || first.MaxRSS == 0 {
+		t.Errorf("peak heap %d and max RSS %d", first.PeakHeap, first.MaxRSS)
+	}
+
+	if whole.AllocBytes < first.AllocBytes || whole.AllocObjects < first.AllocObjects || whole.GCPause < first.GCPause || whole.CPUUser+whole.CPUSys < first.CPUUser+first.CPUSys {
+		t.Errorf("usage to the end %+v is less than to the middle %+v", whole, first)
+	}
+}
+
+// Each new pause counts at its bucket's midpoint, the open ended buckets at
+// their finite bound.
+func TestPauseDelta(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 0.001, 0.003, math.Inf(1)}
+	before := &metrics.Float64Histogram{Counts: []uint64{0, 4, 1}, Buckets: buckets}
+	after := &metrics.Float64Histogram{Counts: []uint64{1, 6, 3}, Buckets: buckets}
+
+	// 1 pause at 0.5ms, 2 at 2ms and 2 at 3ms
+	want := 500*time.Microsecond + 2*2*time.Millisecond + 2*3*time.Millisecond
+	if got := pauseDelta(before, after); got < want-time.Microsecond || got > want+time.Microsecond {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := pauseDelta(nil, before); got < 11*time.Millisecond-time.Microsecond || got > 11*time.Millisecond+time.Microsecond {
+		t.Errorf("with no earlier reading got %s, want every pause counted, 11ms", got)
+	}
+	if got := pauseDelta(before, nil); got != 0 {
+		t.Errorf("with no later reading got %s, want 0", got)
+	}
+}
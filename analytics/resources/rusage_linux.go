@@ -0,0 +1,18 @@
+package resources
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusage returns the process's user and system CPU time and its peak RSS in
+// bytes.
+func rusage() (time.Duration, time.Duration, uint64) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, 0, 0
+	}
+
+	// Linux reports ru_maxrss in kilobytes
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano()), uint64(ru.Maxrss) * 1024
+}
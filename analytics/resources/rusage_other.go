@@ -0,0 +1,11 @@
+//go:build !linux
+
+package resources
+
+import "time"
+
+// rusage is only implemented for Linux, where the containers run. Elsewhere
+// the CPU and RSS fields are zero.
+func rusage() (time.Duration, time.Duration, uint64) {
+	return 0, 0, 0
+}
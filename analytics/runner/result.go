@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"sort"
+	"time"
+
+	"analytics/resources"
+
+	"github.com/rs/zerolog"
+)
+
+// Iteration is the measurement of one run of the analytic.
+type Iteration struct {
+	Scheduled time.Time
+	Start     time.Time
+	Elapsed   time.Duration
+	// Lag is how long after Scheduled the run started
+	Lag time.Duration
+	// Missed is set when the run finished more than one period after it was
+	// scheduled
+	Missed bool
+	Usage  resources.Usage
+	Err    error
+}
+
+// Result is every run the runner made and why it stopped.
+type Result struct {
+	Stopped    string
+	Iterations []Iteration
+	// Dropped counts the open loop runs dropped from a full backlog
+	Dropped int
+}
+
+// Stats summarises a Result: the count and the mean, p50, p95, p99 and max
+// elapsed time of the successful runs, and the missed deadlines and the mean
+// and max start lag of all runs.
+type Stats struct {
+	Count    int
+	Failures int
+	Mean     time.Duration
+	P50      time.Duration
+	P95      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+	Missed   int
+	MeanLag  time.Duration
+	MaxLag   time.Duration
+}
+
+// Percentile is the nearest-rank percentile of the sorted durations.
+func Percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func (r *Result) Stats() Stats {
+	var s Stats
+	var elapsed []time.Duration
+	var total, lag time.Duration
+
+	for _, it := range r.Iterations {
+		lag += it.Lag
+		if it.Lag > s.MaxLag {
+			s.MaxLag = it.Lag
+		}
+		if it.Missed {
+			s.Missed++
+		}
+
+		if it.Err != nil {
+			s.Failures++
+			continue
+		}
+		elapsed = append(elapsed, it.Elapsed)
+		total += it.Elapsed
+	}
+	sort.Slice(elapsed, func(i, j int) bool { return elapsed[i] < elapsed[j] })
+
+	s.Count = len(elapsed)
+	if s.Count > 0 {
+		s.Mean = total / time.Duration(s.Count)
+		s.Max = elapsed[s.Count-1]
+	}
+	s.P50 = Percentile(elapsed, 50)
+	s.P95 = Percentile(elapsed, 95)
+	s.P99 = Percentile(elapsed, 99)
+	if len(r.Iterations) > 0 {
+		s.MeanLag = lag / time.Duration(len(r.Iterations))
+	}
+
+	return s
+}
+
+// Log adds the stats to e, in microseconds like each tick's elapsed.
+func (s Stats) Log(e *zerolog.Event) *zerolog.Event {
+	return e.Int("count", s.Count).
+		Int("failures", s.Failures).
+		Int64("mean", s.Mean.Microseconds()).
+		Int64("p50", s.P50.Microseconds()).
+		Int64("p95", s.P95.Microseconds()).
+		Int64("p99", s.P99.Microseconds()).
+		Int64("max", s.Max.Microseconds()).
+		Int("missed", s.Missed).
+		Int64("meanlag", s.MeanLag.Microseconds()).
+		Int64("maxlag", s.MaxLag.Microseconds())
+}
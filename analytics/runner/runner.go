@@ -0,0 +1,183 @@
+// Package runner drives a registered analytic: it feeds it flows and times a
+// call to Run on every tick, logging the result along with the CPU, allocation
+// and GC cost of the call.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+	"analytics/metrics"
+	"analytics/profile"
+	"analytics/resources"
+	"analytics/seed"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Run sets up the configured analytic and then runs it on cfg.Schedule every
+// cfg.Frequency until cfg.Iterations runs have been made, cfg.Duration has passed or ctx is
+// cancelled. A run in progress is always allowed to finish, and a summary of
+// the elapsed times is logged before returning the measurement of every run.
+func Run(ctx context.Context, cfg *config.Config) (*Result, error) {
+	name := cfg.Analytic
+
+	a, err := analytic.New(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.Init(cfg); err != nil {
+		return nil, err
+	}
+
+	flows, err := input(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Ingest(flows); err != nil {
+		return nil, err
+	}
+	metrics.FlowsIngested(name, len(flows))
+
+	if cfg.MetricsAddr != "" {
+		metrics.Serve(cfg.MetricsAddr)
+	}
+	if cfg.Profile.Addr != "" {
+		profile.Serve(cfg.Profile.Addr)
+	}
+	capture := profile.NewCapture(cfg.Profile, cfg.Results, cfg.RunID)
+	defer capture.Close()
+
+	// Runs made before a sampler has its first sample of the process are not
+	// covered by it, so they wait out the warm-up. A stop during it is seen
+	// by the loop before the first run
+	if cfg.Warmup > 0 {
+		log.Info().Str("analytic", name).Str("run", cfg.RunID).Dur("warmup", time.Duration(cfg.Warmup)).Msg("Warming up")
+		warmup := time.NewTimer(time.Duration(cfg.Warmup))
+		select {
+		case <-ctx.Done():
+			warmup.Stop()
+		case <-warmup.C:
+		}
+	}
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Duration))
+		defer cancel()
+	}
+
+	freq := time.Duration(cfg.Frequency)
+	sched, err := newSchedule(cfg.Schedule, freq, seed.New(cfg.Seed, "schedule"), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	scheduled := sched.next(time.Now())
+
+	result := &Result{Stopped: "iterations"}
+
+loop:
+	for iteration := 1; cfg.Iterations == 0 || iteration <= cfg.Iterations; iteration++ {
+		// A stop that came during the last run is seen here, before arming
+		// the timer, as select picks at random when the timer is due too
+		if err := ctx.Err(); err != nil {
+			result.Stopped = stopReason(err)
+			break
+		}
+		wait := time.NewTimer(time.Until(scheduled))
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			result.Stopped = stopReason(ctx.Err())
+			break loop
+		case <-wait.C:
+		}
+
+		if err := capture.Before(iteration); err != nil {
+			log.Error().Err(err).Str("run", cfg.RunID).Int("iteration", iteration).Msg("Error: Could not start profiling")
+		}
+
+		before := resources.Take()
+		start := time.Now()
+		err := a.Run()
+		elapsed := time.Since(start)
+		usage := resources.Take().Since(before)
+		elapsedMS := elapsed.Microseconds()
+		finished := start.Add(elapsed)
+
+		if err := capture.After(iteration); err != nil {
+			log.Error().Err(err).Str("run", cfg.RunID).Int("iteration", iteration).Msg("Error: Could not write profiles")
+		}
+
+		// A run misses its deadline when it finishes more than one period
+		// after it was scheduled to start
+		lag := start.Sub(scheduled)
+		missed := finished.After(scheduled.Add(freq))
+		result.Iterations = append(result.Iterations, Iteration{
+			Scheduled: scheduled,
+			Start:     start,
+			Elapsed:   elapsed,
+			Lag:       lag,
+			Missed:    missed,
+			Usage:     usage,
+			Err:       err,
+		})
+		metrics.ObserveLag(name, lag, missed)
+		metrics.SetQueueDepth(name, sched.backlog(finished))
+
+		runScheduled := scheduled
+		scheduled = sched.next(finished)
+
+		if err != nil {
+			metrics.ComputeFailed(name)
+			log.Error().Err(err).Str("analytic", name).Time("start", start).Time("scheduled", runScheduled).Int64("lag", lag.Microseconds()).Int("iteration", iteration).Msg("Error: Computation failed")
+			continue
+		}
+		e := log.Info().Str("analytic", name).Str("run", cfg.RunID).Int("iteration", iteration).Time("start", start).Time("scheduled", runScheduled).Int64("lag", lag.Microseconds()).Bool("missed", missed).Int("nodes", cfg.Nodes).Int("edgesamplesize", cfg.EdgeSampleSize)
+		a.Report(e)
+		if d, ok := a.(analytic.Detector); ok {
+			e.Int("detections", d.Detections())
+			metrics.SetDetections(name, d.Detections())
+		}
+		metrics.ObserveCompute(name, elapsed)
+		usage.Log(e)
+		e.Int64("elapsed", elapsedMS).Msgf("Computation with node count %d and edge sample %d took %s\n", cfg.Nodes, cfg.EdgeSampleSize, elapsed)
+	}
+
+	result.Dropped = sched.dropped
+	result.Stats().Log(log.Info().Str("analytic", name).Str("run", cfg.RunID).Str("stopped", result.Stopped).Int("dropped", result.Dropped).Str("schedule", cfg.Schedule).Int64("seed", cfg.Seed).Int("nodes", cfg.Nodes).Int("edgesamplesize", cfg.EdgeSampleSize)).Msg("Run summary")
+	return result, nil
+}
+
+// input returns the flows to hand the analytic from the configured source.
+func input(cfg *config.Config) ([]flow.Flow, error) {
+	switch cfg.Input.Source {
+	case config.SourceGenerate:
+		return flow.NewGenerator(seed.New(cfg.Seed, "input")).Flows(cfg.Nodes, cfg.EdgeSampleSize), nil
+	case config.SourceCSV:
+		flows, err := flow.ReadCSV(cfg.Input.Path)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("path", cfg.Input.Path).Int("flows", len(flows)).Msg("Read flows")
+		return flows, nil
+	case config.SourceNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown input source %q", cfg.Input.Source)
+}
+
+// stopReason is what stopped a run whose context ended with err: its
+// duration, or a signal.
+func stopReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "duration"
+	}
+	return "signal"
+}
@@ -0,0 +1,93 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"analytics/config"
+
+	_ "analytics/baseline"
+)
+
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Analytic = "baseline"
+	cfg.Nodes = 10
+	cfg.EdgeSampleSize = 20
+	cfg.Frequency = config.Duration(time.Microsecond)
+	cfg.Seed = 1
+	cfg.RunID = "runner-test"
+	return cfg
+}
+
+// A run stopped before its next tick makes no more computes, even when the
+// tick is already due.
+func TestStopBeforeTick(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := Run(ctx, testConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Iterations) != 0 || result.Stopped != "signal" {
+			t.Fatalf("a cancelled run made %d computes and stopped on %q", len(result.Iterations), result.Stopped)
+		}
+	}
+}
+
+func TestStopReasons(t *testing.T) {
+	cfg := testConfig()
+	cfg.Iterations = 3
+	result, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Iterations) != 3 || result.Stopped != "iterations" {
+		t.Errorf("a 3 iteration run made %d computes and stopped on %q", len(result.Iterations), result.Stopped)
+	}
+
+	cfg = testConfig()
+	cfg.Frequency = config.Duration(10 * time.Millisecond)
+	cfg.Duration = config.Duration(35 * time.Millisecond)
+	result, err = Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Iterations) == 0 || len(result.Iterations) > 4 || result.Stopped != "duration" {
+		t.Errorf("a 35ms run every 10ms made %d computes and stopped on %q", len(result.Iterations), result.Stopped)
+	}
+}
+
+// The first run waits out the warm-up, and the duration is counted from its
+// end rather than taken out of it.
+func TestWarmup(t *testing.T) {
+	cfg := testConfig()
+	cfg.Warmup = config.Duration(50 * time.Millisecond)
+	cfg.Frequency = config.Duration(10 * time.Millisecond)
+	cfg.Duration = config.Duration(35 * time.Millisecond)
+	started := time.Now()
+	result, err := Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Iterations) == 0 || result.Stopped != "duration" {
+		t.Fatalf("a run with a warm-up made %d computes and stopped on %q", len(result.Iterations), result.Stopped)
+	}
+	if first := result.Iterations[0].Start.Sub(started); first < 50*time.Millisecond {
+		t.Errorf("first run started %s in, during the 50ms warm-up", first)
+	}
+
+	// A stop during the warm-up ends the run without a compute
+	cfg.Warmup = config.Duration(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	result, err = Run(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Iterations) != 0 || result.Stopped != "signal" {
+		t.Errorf("a run stopped while warming up made %d computes and stopped on %q", len(result.Iterations), result.Stopped)
+	}
+}
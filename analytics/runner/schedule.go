@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"analytics/config"
+)
+
+// schedule decides when each run should start. The fixed-rate and Poisson
+// modes are open loop: runs arrive on their own clock whatever the analytic is
+// doing, and late runs are started back to back until they catch up. The
+// fixed-delay and continuous modes are closed loop and wait on the previous
+// run finishing.
+//
+// An open loop backlog is kept to maxBacklog runs. Past that the analytic is
+// not catching up, and the oldest due runs are dropped and counted instead.
+type schedule struct {
+	mode string
+	freq time.Duration
+	rand *rand.Rand
+
+	// arrivals are the open loop start times generated but not yet used, in
+	// order, and last is the latest generated
+	arrivals []time.Time
+	last     time.Time
+	// dropped counts the arrivals dropped from a full backlog
+	dropped int
+}
+
+// maxBacklog is the most open loop runs kept waiting.
+const maxBacklog = 10000
+
+func newSchedule(mode string, freq time.Duration, r *rand.Rand, start time.Time) (*schedule, error) {
+	switch mode {
+	case config.ScheduleFixedRate, config.ScheduleFixedDelay, config.ScheduleContinuous, config.SchedulePoisson:
+	default:
+		return nil, fmt.Errorf("unknown schedule %q", mode)
+	}
+	return &schedule{mode: mode, freq: freq, rand: r, last: start}, nil
+}
+
+func (s *schedule) openLoop() bool {
+	return s.mode == config.ScheduleFixedRate || s.mode == config.SchedulePoisson
+}
+
+// arrive generates the next open loop start time.
+func (s *schedule) arrive() time.Time {
+	interval := s.freq
+	if s.mode == config.SchedulePoisson {
+		interval = time.Duration(s.rand.ExpFloat64() * float64(s.freq))
+	}
+	s.last = s.last.Add(interval)
+	if len(s.arrivals) == maxBacklog {
+		s.arrivals = s.arrivals[1:]
+		s.dropped++
+	}
+	s.arrivals = append(s.arrivals, s.last)
+	return s.last
+}
+
+// next returns when the next run is scheduled to start, given that the
+// previous one finished at finished.
+func (s *schedule) next(finished time.Time) time.Time {
+	switch s.mode {
+	case config.ScheduleFixedDelay:
+		return finished.Add(s.freq)
+	case config.ScheduleContinuous:
+		return finished
+	}
+
+	if len(s.arrivals) == 0 {
+		s.arrive()
+	}
+	next := s.arrivals[0]
+	s.arrivals = s.arrivals[1:]
+	return next
+}
+
+// backlog is the number of open loop runs that are due at now but have not
+// started. Closed loop schedules never have a backlog.
+func (s *schedule) backlog(now time.Time) int {
+	if !s.openLoop() {
+		return 0
+	}
+
+	for !s.last.After(now) {
+		s.arrive()
+	}
+	due := 0
+	for _, t := range s.arrivals {
+		if t.After(now) {
+			break
+		}
+		due++
+	}
+	return due
+}
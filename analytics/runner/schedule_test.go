@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"analytics/config"
+)
+
+var scheduleStart = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func at(offset time.Duration) time.Time { return scheduleStart.Add(offset) }
+
+// poissonSteps works out what a Poisson schedule seeded with seed should
+// report when runs finish at finished: the runs due but not started, and the
+// next start, taking the arrivals in order.
+func poissonSteps(seed int64, freq time.Duration, finished []time.Duration) (backlog []int, next []time.Duration) {
+	r := rand.New(rand.NewSource(seed))
+	var arrivals []time.Duration
+	var last time.Duration
+	for len(arrivals) < 100 {
+		last += time.Duration(r.ExpFloat64() * float64(freq))
+		arrivals = append(arrivals, last)
+	}
+
+	used := 0
+	for _, f := range finished {
+		due := 0
+		for _, a := range arrivals[used:] {
+			if a > f {
+				break
+			}
+			due++
+		}
+		backlog = append(backlog, due)
+		next = append(next, arrivals[used])
+		used++
+	}
+	return backlog, next
+}
+
+// Each step is a run finishing: the backlog is read and the next start
+// taken, as the runner does. The third run overruns by two periods.
+func TestScheduleNext(t *testing.T) {
+	const freq = time.Second
+	finished := []time.Duration{0, 1200 * time.Millisecond, 4500 * time.Millisecond, 4600 * time.Millisecond, 4700 * time.Millisecond}
+	poissonBacklog, poissonNext := poissonSteps(7, freq, finished)
+
+	tests := []struct {
+		mode    string
+		backlog []int
+		next    []time.Duration
+	}{
+		{config.ScheduleFixedRate, []int{0, 0, 2, 1, 0}, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second, 5 * time.Second}},
+		{config.ScheduleFixedDelay, []int{0, 0, 0, 0, 0}, []time.Duration{time.Second, 2200 * time.Millisecond, 5500 * time.Millisecond, 5600 * time.Millisecond, 5700 * time.Millisecond}},
+		{config.ScheduleContinuous, []int{0, 0, 0, 0, 0}, finished},
+		{config.SchedulePoisson, poissonBacklog, poissonNext},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s, err := newSchedule(tt.mode, freq, rand.New(rand.NewSource(7)), scheduleStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, f := range finished {
+				if got := s.backlog(at(f)); got != tt.backlog[i] {
+					t.Errorf("step %d: backlog at %s is %d, want %d", i, f, got, tt.backlog[i])
+				}
+				if got := s.next(at(f)); !got.Equal(at(tt.next[i])) {
+					t.Errorf("step %d: next after %s is %s, want %s", i, f, got.Sub(scheduleStart), tt.next[i])
+				}
+			}
+		})
+	}
+
+	if _, err := newSchedule("sometimes", freq, nil, scheduleStart); err == nil {
+		t.Error("an unknown schedule was accepted")
+	}
+}
+
+func TestPoissonMean(t *testing.T) {
+	const freq = 10 * time.Millisecond
+	const n = 100000
+	s, err := newSchedule(config.SchedulePoisson, freq, rand.New(rand.NewSource(1)), scheduleStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous, long := scheduleStart, 0
+	for i := 0; i < n; i++ {
+		next := s.next(previous)
+		if next.Before(previous) {
+			t.Fatalf("arrival %d at %s is before the one before it", i, next.Sub(scheduleStart))
+		}
+		if next.Sub(previous) > freq {
+			long++
+		}
+		previous = next
+	}
+
+	// The standard error of the mean of n exponential intervals is the
+	// period over the square root of n, about 0.3% here
+	mean := previous.Sub(scheduleStart) / n
+	if math.Abs(float64(mean-freq)) > 0.01*float64(freq) {
+		t.Errorf("mean interval %s, want %s", mean, freq)
+	}
+	// An exponential interval is longer than its mean with probability 1/e
+	if frac := float64(long) / n; math.Abs(frac-1/math.E) > 0.01 {
+		t.Errorf("%.3f of intervals are longer than the period, want %.3f", frac, 1/math.E)
+	}
+}
+
+// A run that stalls for a minute at a millisecond period leaves maxBacklog
+// runs waiting, not sixty thousand, and counts the rest as dropped.
+func TestBacklogBound(t *testing.T) {
+	s, err := newSchedule(config.ScheduleFixedRate, time.Millisecond, nil, scheduleStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Arrivals are generated up to the first after the stall ends
+	const arrived = 60001
+	if due := s.backlog(at(time.Minute)); due != maxBacklog-1 {
+		t.Errorf("backlog %d, want %d", due, maxBacklog-1)
+	}
+	if len(s.arrivals) != maxBacklog || s.dropped != arrived-maxBacklog {
+		t.Errorf("kept %d arrivals and dropped %d, want %d and %d", len(s.arrivals), s.dropped, maxBacklog, arrived-maxBacklog)
+	}
+	if next, want := s.next(at(time.Minute)), at((arrived-maxBacklog+1)*time.Millisecond); !next.Equal(want) {
+		t.Errorf("next run at %s, want the oldest kept at %s", next.Sub(scheduleStart), want.Sub(scheduleStart))
+	}
+}
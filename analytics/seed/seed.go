@@ -0,0 +1,16 @@
+// Package seed hands each component of a run its own random source derived
+// from the run's seed, so that one component drawing more or fewer numbers
+// does not change what the others see.
+package seed
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// New returns the random source for the named component of a run.
+func New(seed int64, component string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(component))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
@@ -0,0 +1,45 @@
+package seed
+
+import "testing"
+
+func draws(seed int64, component string) [4]int64 {
+	r := New(seed, component)
+	var d [4]int64
+	for i := range d {
+		d[i] = r.Int63()
+	}
+	return d
+}
+
+func TestNew(t *testing.T) {
+	components := []string{"graph", "flows", "workload", "schedule", "klddos"}
+
+	seen := map[[4]int64]string{}
+	for _, c := range components {
+		d := draws(888, c)
+		if again := draws(888, c); again != d {
+			t.Errorf("%s drew %v then %v from the same seed", c, d, again)
+		}
+		if other, ok := seen[d]; ok {
+			t.Errorf("%s and %s drew the same numbers", c, other)
+		}
+		seen[d] = c
+
+		if draws(889, c) == d {
+			t.Errorf("%s drew the same numbers from seeds 888 and 889", c)
+		}
+	}
+
+	// Drawing more from one component leaves what another sees alone
+	graph, flows := New(888, "graph"), New(888, "flows")
+	var got [4]int64
+	for i := range got {
+		for j := 0; j <= i*100; j++ {
+			graph.Int63()
+		}
+		got[i] = flows.Int63()
+	}
+	if want := draws(888, "flows"); got != want {
+		t.Errorf("flows drew %v alongside graph, want %v", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package superspreader
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"analytics/flow"
+)
+
+// Site holds the sketches of the flows one sensor observed, a SpreadSketches
+// per window. Sites sketched with the same precision and window merge
+// losslessly, and MarshalBinary writes one out for a runner elsewhere to merge
+// with its own.
+type Site struct {
+	p       uint8
+	window  time.Duration
+	Windows map[int64]*SpreadSketches
+}
+
+func NewSite(p uint8, window time.Duration) *Site {
+	return &Site{p: p, window: window, Windows: make(map[int64]*SpreadSketches)}
+}
+
+// Add sketches the flow into its window.
+func (s *Site) Add(f flow.Flow) {
+	key := f.StartTime.Truncate(s.window).UnixNano()
+	w, ok := s.Windows[key]
+	if !ok {
+		w = NewSpreadSketches(s.p)
+		s.Windows[key] = w
+	}
+	w.Add(f)
+}
+
+func (s *Site) Merge(other *Site) error {
+	if s.p != other.p || s.window != other.window {
+		return fmt.Errorf("superspreader: cannot merge a site sketched at precision %d over %s windows into one at precision %d over %s", other.p, other.window, s.p, s.window)
+	}
+	for key, w := range other.Windows {
+		merged, ok := s.Windows[key]
+		if !ok {
+			merged = NewSpreadSketches(s.p)
+			s.Windows[key] = merged
+		}
+		if err := merged.Merge(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Site) MemoryBytes() int {
+	size := 0
+	for _, w := range s.Windows {
+		size += w.MemoryBytes()
+	}
+	return size
+}
+
+// siteMagic starts every encoded Site, followed by siteVersion.
+const (
+	siteMagic   = "SSPR"
+	siteVersion = 1
+)
+
+var errTruncated = errors.New("superspreader: sketch encoding is truncated")
+
+// MarshalBinary writes the magic and version, the precision and window, and
+// then every window's start and sketches, earliest first.
+func (s *Site) MarshalBinary() ([]byte, error) {
+	keys := make([]int64, 0, len(s.Windows))
+	for key := range s.Windows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	data := append([]byte(siteMagic), siteVersion, s.p)
+	data = appendVarint(data, int64(s.window))
+	data = appendUvarint(data, uint64(len(keys)))
+	for _, key := range keys {
+		w, err := s.Windows[key].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = appendVarint(data, key)
+		data = appendUvarint(data, uint64(len(w)))
+		data = append(data, w...)
+	}
+	return data, nil
+}
+
+func (s *Site) UnmarshalBinary(data []byte) error {
+	d := &decoder{data: data}
+	if magic := d.next(uint64(len(siteMagic))); d.err == nil && string(magic) != siteMagic {
+		return errors.New("superspreader: not a site's sketches")
+	}
+	if version := d.next(1); d.err == nil && version[0] != siteVersion {
+		return fmt.Errorf("superspreader: sketches are version %d, only %d is read", version[0], siteVersion)
+	}
+	p := d.next(1)
+	window := d.varint()
+	count := d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+	if !validPrecision(p[0]) || window <= 0 {
+		return fmt.Errorf("superspreader: sketches have precision %d and window %s", p[0], time.Duration(window))
+	}
+
+	site := NewSite(p[0], time.Duration(window))
+	for i := uint64(0); i < count; i++ {
+		key := d.varint()
+		encoded := d.next(d.uvarint())
+		if d.err != nil {
+			return d.err
+		}
+		w := &SpreadSketches{}
+		if err := w.UnmarshalBinary(encoded); err != nil {
+			return err
+		}
+		if w.p != site.p {
+			return fmt.Errorf("superspreader: window %s has precision %d in a site of precision %d", time.Unix(0, key).UTC(), w.p, site.p)
+		}
+		site.Windows[key] = w
+	}
+	if len(d.data) > 0 {
+		return fmt.Errorf("superspreader: %d bytes follow the sketches", len(d.data))
+	}
+	*s = *site
+	return nil
+}
+
+// MarshalBinary writes the precision, then the sources' and destinations'
+// sketches, each as a count followed by every host and its registers in host
+// order.
+func (s *SpreadSketches) MarshalBinary() ([]byte, error) {
+	data := []byte{s.p}
+	for _, sketches := range []map[string]*HyperLogLog{s.Out, s.In} {
+		hosts := make([]string, 0, len(sketches))
+		for host := range sketches {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+
+		data = appendUvarint(data, uint64(len(hosts)))
+		for _, host := range hosts {
+			data = appendUvarint(data, uint64(len(host)))
+			data = append(data, host...)
+			data = append(data, sketches[host].registers...)
+		}
+	}
+	return data, nil
+}
+
+func (s *SpreadSketches) UnmarshalBinary(data []byte) error {
+	d := &decoder{data: data}
+	p := d.next(1)
+	if d.err != nil {
+		return d.err
+	}
+	if !validPrecision(p[0]) {
+		return fmt.Errorf("superspreader: spread sketches have precision %d", p[0])
+	}
+
+	sketches := NewSpreadSketches(p[0])
+	for _, into := range []map[string]*HyperLogLog{sketches.Out, sketches.In} {
+		count := d.uvarint()
+		for i := uint64(0); i < count && d.err == nil; i++ {
+			host := string(d.next(d.uvarint()))
+			registers := d.next(1 << p[0])
+			if d.err == nil {
+				into[host] = &HyperLogLog{p: p[0], registers: append([]uint8(nil), registers...)}
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) > 0 {
+		return fmt.Errorf("superspreader: %d bytes follow the spread sketches", len(d.data))
+	}
+	*s = *sketches
+	return nil
+}
+
+// MarshalBinary writes the precision followed by the registers.
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	return append([]byte{h.p}, h.registers...), nil
+}
+
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || !validPrecision(data[0]) || len(data) != 1+1<<data[0] {
+		return errors.New("hyperloglog: encoding is not a precision followed by its 2^p registers")
+	}
+	h.p = data[0]
+	h.registers = append([]uint8(nil), data[1:]...)
+	return nil
+}
+
+// validPrecision is the precision range superspreader.precision allows.
+func validPrecision(p uint8) bool {
+	return p >= 4 && p <= 16
+}
+
+// decoder reads an encoding front to back, keeping the first error so the
+// reads can be checked once at the end.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) next(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.data)) < n {
+		d.err = errTruncated
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func appendUvarint(data []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendVarint(data []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutVarint(buf[:], v)]...)
+}
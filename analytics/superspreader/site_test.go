@@ -0,0 +1,86 @@
+package superspreader
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"analytics/flow"
+)
+
+func testFlows(r *rand.Rand, n int) []flow.Flow {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	flows := make([]flow.Flow, n)
+	for i := range flows {
+		at := start.Add(time.Duration(r.Int63n(int64(time.Hour))))
+		flows[i] = flow.Flow{
+			SourceIP:      net.IPv4(10, 0, byte(r.Intn(4)), byte(r.Intn(256))),
+			DestinationIP: net.IPv4(192, 168, byte(r.Intn(4)), byte(r.Intn(256))),
+			StartTime:     at,
+			EndTime:       at,
+		}
+	}
+	return flows
+}
+
+func TestSiteRoundTrip(t *testing.T) {
+	site := NewSite(10, 5*time.Minute)
+	for _, f := range testFlows(rand.New(rand.NewSource(1)), 2000) {
+		site.Add(f)
+	}
+
+	data, err := site.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &Site{}
+	if err := read.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(site, read) {
+		t.Fatalf("read back a different site: %d windows, want %d", len(read.Windows), len(site.Windows))
+	}
+
+	for _, cut := range []int{0, 3, len(data) / 2, len(data) - 1} {
+		if err := (&Site{}).UnmarshalBinary(data[:cut]); err == nil {
+			t.Errorf("reading the first %d of %d bytes succeeded", cut, len(data))
+		}
+	}
+}
+
+// Merging sites that each saw part of the flows, one of them read back from
+// its encoding, sketches the same as one site seeing them all.
+func TestSiteMergeAcrossProcesses(t *testing.T) {
+	flows := testFlows(rand.New(rand.NewSource(2)), 3000)
+	whole := NewSite(8, time.Minute)
+	local, remote := NewSite(8, time.Minute), NewSite(8, time.Minute)
+	for i, f := range flows {
+		whole.Add(f)
+		if i%3 == 0 {
+			remote.Add(f)
+		} else {
+			local.Add(f)
+		}
+	}
+
+	data, err := remote.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported := &Site{}
+	if err := imported.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Merge(imported); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(whole, local) {
+		t.Fatal("merged sites differ from one site seeing every flow")
+	}
+
+	if err := local.Merge(NewSite(9, time.Minute)); err == nil {
+		t.Error("merged a site of another precision")
+	}
+}
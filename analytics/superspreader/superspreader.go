@@ -0,0 +1,384 @@
+package superspreader
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"analytics/analytic"
+	"analytics/config"
+	"analytics/flow"
+	"analytics/seed"
+
+	"github.com/rs/zerolog"
+)
+
+// Superspreaders flags hosts that contact, or are contacted by, an unusually
+// large number of distinct peers, from sketches merged across sites. Each
+// flow is sketched at the site that observed it as it is ingested and not
+// kept, and sites run by other runners can be merged in from their exports.
+type Superspreaders struct {
+	// Window size, site count, HLL precision (2^p one byte registers per host,
+	// ~3% standard error at 10) and the distinct peer threshold, along with
+	// the shape of the generated attacks
+	cfg  config.Superspreader
+	rand *rand.Rand
+
+	// sites are the sensors simulated here, and imported those read from
+	// other runners' exports
+	sites    []*Site
+	imported []*Site
+
+	windows     []WindowResult
+	total       WindowResult
+	sketchBytes int
+}
+
+func init() {
+	analytic.Register("superspreader", func() analytic.Analytic { return &Superspreaders{} })
+}
+
+// Init seeds the traffic with worm scanners and DDoS victims, and reads the
+// sketches of the sites to import.
+func (s *Superspreaders) Init(cfg *config.Config) error {
+	s.cfg = cfg.Superspreader
+	s.rand = seed.New(cfg.Seed, "superspreader")
+	s.sites = make([]*Site, s.cfg.Sites)
+	for i := range s.sites {
+		s.sites[i] = NewSite(uint8(s.cfg.Precision), time.Duration(s.cfg.Window))
+	}
+	s.observe(generateAttacks(s.rand, cfg.Nodes, s.cfg))
+
+	for _, path := range s.cfg.Import {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		site := &Site{}
+		if err := site.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if site.p != s.sites[0].p || site.window != s.sites[0].window {
+			return fmt.Errorf("%s: sketched at precision %d over %s windows, not %d over %s as superspreader.precision and superspreader.window are", path, site.p, site.window, s.cfg.Precision, time.Duration(s.cfg.Window))
+		}
+		s.imported = append(s.imported, site)
+	}
+	return nil
+}
+
+// Ingest sketches each flow at the site that observed it, then writes the
+// sites' sketches out when they are exported.
+func (s *Superspreaders) Ingest(flows []flow.Flow) error {
+	s.observe(flows)
+	if s.cfg.Export == "" {
+		return nil
+	}
+
+	merged := NewSite(uint8(s.cfg.Precision), time.Duration(s.cfg.Window))
+	for _, site := range s.sites {
+		if err := merged.Merge(site); err != nil {
+			return err
+		}
+	}
+	data, err := merged.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.cfg.Export, data, 0o644)
+}
+
+// observe assigns each flow to the sensor that observed it.
+func (s *Superspreaders) observe(flows []flow.Flow) {
+	for _, f := range flows {
+		s.sites[s.rand.Intn(len(s.sites))].Add(f)
+	}
+}
+
+// Run merges the sites into a per-window view and the windows into a
+// whole-run view, and flags the outliers in each.
+func (s *Superspreaders) Run() error {
+	merged := NewSite(uint8(s.cfg.Precision), time.Duration(s.cfg.Window))
+	for _, sites := range [][]*Site{s.sites, s.imported} {
+		for _, site := range sites {
+			if err := merged.Merge(site); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]int64, 0, len(merged.Windows))
+	for key := range merged.Windows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	run := NewSpreadSketches(merged.p)
+	s.windows = s.windows[:0]
+	for _, key := range keys {
+		w := merged.Windows[key]
+		s.windows = append(s.windows, WindowResult{
+			Start:          time.Unix(0, key),
+			Superspreaders: outliers(w.Out, s.cfg.Threshold),
+			Supersinks:     outliers(w.In, s.cfg.Threshold),
+		})
+		if err := run.Merge(w); err != nil {
+			return err
+		}
+	}
+
+	s.total = WindowResult{
+		Superspreaders: outliers(run.Out, s.cfg.Threshold),
+		Supersinks:     outliers(run.In, s.cfg.Threshold),
+	}
+	if len(keys) > 0 {
+		s.total.Start = time.Unix(0, keys[0])
+	}
+	s.sketchBytes = run.MemoryBytes()
+	return nil
+}
+
+// Report lists every host flagged with the distinct peers it was flagged at,
+// those flagged in a window with the window's start and those flagged over
+// the whole run without one, since a slow scan can stay under the threshold
+// in every window.
+func (s *Superspreaders) Report(e *zerolog.Event) {
+	detected := zerolog.Arr()
+	add := func(w WindowResult, window bool) {
+		for _, spreader := range w.Superspreaders {
+			d := zerolog.Dict().Str("src", spreader.Host).Uint64("distinct", spreader.Distinct)
+			if window {
+				d.Time("window", w.Start)
+			}
+			detected.Dict(d)
+		}
+		for _, sink := range w.Supersinks {
+			d := zerolog.Dict().Str("dst", sink.Host).Uint64("distinct", sink.Distinct)
+			if window {
+				d.Time("window", w.Start)
+			}
+			detected.Dict(d)
+		}
+	}
+	for _, w := range s.windows {
+		add(w, true)
+	}
+	add(s.total, false)
+
+	e.Int("windows", len(s.windows)).Int("sites", len(s.sites)+len(s.imported)).Int("superspreaders", len(s.total.Superspreaders)).Int("supersinks", len(s.total.Supersinks)).Int("sketchbytes", s.sketchBytes).Array("detected", detected)
+}
+
+// Detections counts the hosts flagged across the whole run, not per window.
+func (s *Superspreaders) Detections() int {
+	return len(s.total.Superspreaders) + len(s.total.Supersinks)
+}
+
+var errPrecisionMismatch = errors.New("hyperloglog: cannot merge sketches of different precision")
+
+// HyperLogLog estimates the number of distinct items added to it in 2^p
+// registers (Flajolet et al., 2007). Sketches with the same precision merge
+// losslessly, so per-window and per-site sketches can be combined.
+type HyperLogLog struct {
+	p         uint8
+	registers []uint8
+}
+
+func NewHyperLogLog(p uint8) *HyperLogLog {
+	return &HyperLogLog{p: p, registers: make([]uint8, 1<<p)}
+}
+
+// hash64 is FNV-1a followed by the splitmix64 finaliser, since FNV alone does
+// not spread short keys such as IPv4 addresses across the high bits.
+func hash64(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	x := h.Sum64()
+
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *HyperLogLog) Add(data []byte) {
+	x := hash64(data)
+	idx := x >> (64 - h.p)
+	// Rank of the first set bit in the remaining bits, capped so an all-zero
+	// remainder still fits
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Linear counting is more accurate while many registers are still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.p != other.p {
+		return errPrecisionMismatch
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+func (h *HyperLogLog) MemoryBytes() int {
+	return len(h.registers)
+}
+
+// SpreadSketches keeps a distinct-destination sketch per source and a
+// distinct-source sketch per destination.
+type SpreadSketches struct {
+	p   uint8
+	Out map[string]*HyperLogLog
+	In  map[string]*HyperLogLog
+}
+
+func NewSpreadSketches(p uint8) *SpreadSketches {
+	return &SpreadSketches{
+		p:   p,
+		Out: make(map[string]*HyperLogLog),
+		In:  make(map[string]*HyperLogLog),
+	}
+}
+
+func addTo(sketches map[string]*HyperLogLog, key string, item []byte, p uint8) {
+	h, ok := sketches[key]
+	if !ok {
+		h = NewHyperLogLog(p)
+		sketches[key] = h
+	}
+	h.Add(item)
+}
+
+func (s *SpreadSketches) Add(f flow.Flow) {
+	addTo(s.Out, f.SourceIP.String(), f.DestinationIP.To16(), s.p)
+	addTo(s.In, f.DestinationIP.String(), f.SourceIP.To16(), s.p)
+}
+
+func mergeInto(dst, src map[string]*HyperLogLog) error {
+	for key, h := range src {
+		existing, ok := dst[key]
+		if !ok {
+			existing = NewHyperLogLog(h.p)
+			dst[key] = existing
+		}
+		if err := existing.Merge(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SpreadSketches) Merge(other *SpreadSketches) error {
+	if err := mergeInto(s.Out, other.Out); err != nil {
+		return err
+	}
+	return mergeInto(s.In, other.In)
+}
+
+func (s *SpreadSketches) MemoryBytes() int {
+	size := 0
+	for _, h := range s.Out {
+		size += h.MemoryBytes()
+	}
+	for _, h := range s.In {
+		size += h.MemoryBytes()
+	}
+	return size
+}
+
+type Spreader struct {
+	Host     string
+	Distinct uint64
+}
+
+// outliers returns the hosts whose distinct peer estimate reaches threshold,
+// largest first.
+func outliers(sketches map[string]*HyperLogLog, threshold int) []Spreader {
+	var flagged []Spreader
+	for host, h := range sketches {
+		if distinct := h.Estimate(); distinct >= uint64(threshold) {
+			flagged = append(flagged, Spreader{Host: host, Distinct: distinct})
+		}
+	}
+	sort.Slice(flagged, func(i, j int) bool { return flagged[i].Distinct > flagged[j].Distinct })
+
+	return flagged
+}
+
+type WindowResult struct {
+	Start          time.Time
+	Superspreaders []Spreader
+	Supersinks     []Spreader
+}
+
+// generateAttacks adds worm-like scanners that each probe a large number of
+// random addresses, and DDoS victims that are each hit by many random sources.
+func generateAttacks(r *rand.Rand, nodeCount int, cfg config.Superspreader) []flow.Flow {
+	g := flow.NewGenerator(r)
+	scanners := g.IPs(int(math.Ceil(float64(nodeCount) * cfg.ScannerFraction)))
+	victims := g.IPs(int(math.Ceil(float64(nodeCount) * cfg.VictimFraction)))
+	attackFanout := cfg.AttackFanout
+	windowStart := flow.WindowStart()
+
+	var flows []flow.Flow
+	for _, scanner := range scanners {
+		for i, target := range g.IPs(attackFanout) {
+			flows = append(flows, attackFlow(r, scanner, target, windowStart, i, attackFanout))
+		}
+	}
+	for _, victim := range victims {
+		for i, attacker := range g.IPs(attackFanout) {
+			flows = append(flows, attackFlow(r, attacker, victim, windowStart, i, attackFanout))
+		}
+	}
+
+	return flows
+}
+
+func attackFlow(r *rand.Rand, srcIP, dstIP net.IP, windowStart time.Time, i, total int) flow.Flow {
+	startTime := windowStart.Add(flow.Window * time.Duration(i) / time.Duration(total))
+	return flow.Flow{
+		SourceIP:        srcIP,
+		DestinationIP:   dstIP,
+		SourcePort:      uint16(r.Intn(65535-1024) + 1024),
+		DestinationPort: 445,
+		Protocol:        6,
+		ByteCount:       60,
+		PacketCount:     1,
+		StartTime:       startTime,
+		EndTime:         startTime,
+	}
+}
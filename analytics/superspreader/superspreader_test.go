@@ -0,0 +1,77 @@
+package superspreader
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"analytics/config"
+
+	"github.com/rs/zerolog"
+)
+
+// The hosts flagged go out on the tick's event, which the runner logs at
+// info, with the peers counted and the window they were counted in, if any.
+func TestReportListsFlaggedHosts(t *testing.T) {
+	cfg := config.Default()
+	cfg.Nodes, cfg.Seed = 500, 1
+	cfg.Superspreader.AttackFanout, cfg.Superspreader.Threshold = 300, 200
+
+	s := &Superspreaders{}
+	if err := s.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	e := logger.Info()
+	s.Report(e)
+	e.Send()
+
+	var report struct {
+		Superspreaders int `json:"superspreaders"`
+		Supersinks     int `json:"supersinks"`
+		Detected       []struct {
+			Src      string `json:"src"`
+			Dst      string `json:"dst"`
+			Distinct uint64 `json:"distinct"`
+			Window   string `json:"window"`
+		} `json:"detected"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Superspreaders == 0 || report.Supersinks == 0 {
+		t.Fatalf("flagged %d superspreaders and %d supersinks of the generated attacks", report.Superspreaders, report.Supersinks)
+	}
+	run := 0
+	for _, d := range report.Detected {
+		if (d.Src == "") == (d.Dst == "") || d.Distinct < 200 {
+			t.Errorf("detection %+v has not one host or the peers it was flagged at", d)
+		}
+		if d.Window == "" {
+			run++
+		}
+	}
+	if run != s.Detections() {
+		t.Errorf("listed %d hosts flagged over the run, want %d", run, s.Detections())
+	}
+
+	// With one window covering the generated hour, the same hosts are
+	// flagged in it
+	cfg.Superspreader.Window = config.Duration(2 * time.Hour)
+	s = &Superspreaders{}
+	if err := s.Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.windows) == 0 || len(s.windows[0].Superspreaders) == 0 {
+		t.Errorf("flagged nothing in a window over the whole run: %+v", s.windows)
+	}
+}
@@ -0,0 +1,371 @@
+// Package sweep runs analytics in-process across a ladder of network sizes and
+// run frequencies, and writes one tidy row of timing and resource metrics per
+// point.
+package sweep
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"analytics/config"
+	"analytics/resources"
+	"analytics/runner"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Point is one network size and frequency an analytic is run at.
+type Point struct {
+	Analytic  string
+	Nodes     int
+	Edges     int
+	Frequency time.Duration
+}
+
+// Points expands the sweep settings into every point to run, analytic by
+// analytic, in ladder order.
+func Points(cfg *config.Config) ([]Point, error) {
+	s := cfg.Sweep
+
+	analytics := []string(s.Analytics)
+	if len(analytics) == 0 {
+		analytics = []string{cfg.Analytic}
+	}
+	nodes := []int(s.Nodes)
+	if len(nodes) == 0 {
+		nodes = []int{cfg.Nodes}
+	}
+	edges := []int(s.Edges)
+	if len(edges) == 0 {
+		edges = []int{cfg.EdgeSampleSize}
+	}
+	freqs := []config.Duration(s.Freqs)
+	if len(freqs) == 0 {
+		freqs = []config.Duration{cfg.Frequency}
+	}
+
+	type size struct{ nodes, edges int }
+	var sizes []size
+	switch {
+	case s.Cross:
+		for _, n := range nodes {
+			for _, e := range edges {
+				sizes = append(sizes, size{n, e})
+			}
+		}
+	case len(edges) == 1:
+		for _, n := range nodes {
+			sizes = append(sizes, size{n, edges[0]})
+		}
+	case len(edges) == len(nodes):
+		for i := range nodes {
+			sizes = append(sizes, size{nodes[i], edges[i]})
+		}
+	default:
+		return nil, fmt.Errorf("sweep.nodes has %d values and sweep.edges %d, they must match unless sweep.cross is set", len(nodes), len(edges))
+	}
+
+	var points []Point
+	for _, a := range analytics {
+		for _, sz := range sizes {
+			for _, f := range freqs {
+				points = append(points, Point{Analytic: a, Nodes: sz.nodes, Edges: sz.edges, Frequency: time.Duration(f)})
+			}
+		}
+	}
+	return points, nil
+}
+
+// Config is the runner configuration of the i'th point of a sweep run with
+// cfg: its analytic, size and frequency, with the settings that only make
+// sense for a whole sweep turned off.
+func (p Point) Config(cfg *config.Config, i int) config.Config {
+	pointCfg := *cfg
+	pointCfg.Analytic = p.Analytic
+	pointCfg.Nodes = p.Nodes
+	pointCfg.EdgeSampleSize = p.Edges
+	pointCfg.Frequency = config.Duration(p.Frequency)
+	pointCfg.Duration = 0
+	pointCfg.MetricsAddr = ""
+	pointCfg.Profile = config.Profile{}
+	pointCfg.RunID = fmt.Sprintf("%s-%d", cfg.RunID, i+1)
+	return pointCfg
+}
+
+// Row is the measurement of one point. Times are in microseconds and sizes in
+// bytes, averaged over the successful iterations unless named otherwise.
+type Row struct {
+	Analytic       string  `json:"analytic"`
+	Nodes          int     `json:"nodes"`
+	Edges          int     `json:"edges"`
+	FrequencyUS    int64   `json:"freq_us"`
+	Iterations     int     `json:"iterations"`
+	Failures       int     `json:"failures"`
+	ElapsedMeanUS  int64   `json:"elapsed_mean_us"`
+	ElapsedP50US   int64   `json:"elapsed_p50_us"`
+	ElapsedP95US   int64   `json:"elapsed_p95_us"`
+	ElapsedP99US   int64   `json:"elapsed_p99_us"`
+	ElapsedMaxUS   int64   `json:"elapsed_max_us"`
+	CPUUserMeanUS  int64   `json:"cpu_user_mean_us"`
+	CPUSysMeanUS   int64   `json:"cpu_sys_mean_us"`
+	AllocBytesMean float64 `json:"alloc_bytes_mean"`
+	AllocObjsMean  float64 `json:"alloc_objects_mean"`
+	GCCycles       uint64  `json:"gc_cycles_total"`
+	GCPauseUS      int64   `json:"gc_pause_total_us"`
+	HeapPeakBytes  uint64  `json:"heap_peak_bytes"`
+	// MaxRSSBytes is the peak resident set while the point ran, 0 where it
+	// cannot be measured on its own
+	MaxRSSBytes uint64 `json:"max_rss_bytes"`
+	Missed      int    `json:"missed"`
+	LagMeanUS   int64  `json:"lag_mean_us"`
+}
+
+var header = []string{
+	"analytic", "nodes", "edges", "freq_us", "iterations", "failures",
+	"elapsed_mean_us", "elapsed_p50_us", "elapsed_p95_us", "elapsed_p99_us", "elapsed_max_us",
+	"cpu_user_mean_us", "cpu_sys_mean_us", "alloc_bytes_mean", "alloc_objects_mean",
+	"gc_cycles_total", "gc_pause_total_us", "heap_peak_bytes", "max_rss_bytes",
+	"missed", "lag_mean_us",
+}
+
+func (r Row) record() []string {
+	i := func(v int64) string { return strconv.FormatInt(v, 10) }
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+
+	return []string{
+		r.Analytic, i(int64(r.Nodes)), i(int64(r.Edges)), i(r.FrequencyUS), i(int64(r.Iterations)), i(int64(r.Failures)),
+		i(r.ElapsedMeanUS), i(r.ElapsedP50US), i(r.ElapsedP95US), i(r.ElapsedP99US), i(r.ElapsedMaxUS),
+		i(r.CPUUserMeanUS), i(r.CPUSysMeanUS), f(r.AllocBytesMean), f(r.AllocObjsMean),
+		u(r.GCCycles), i(r.GCPauseUS), u(r.HeapPeakBytes), u(r.MaxRSSBytes),
+		i(int64(r.Missed)), i(r.LagMeanUS),
+	}
+}
+
+func newRow(p Point, result *runner.Result, peakRSS uint64) Row {
+	stats := result.Stats()
+	row := Row{
+		Analytic:      p.Analytic,
+		Nodes:         p.Nodes,
+		Edges:         p.Edges,
+		FrequencyUS:   p.Frequency.Microseconds(),
+		Iterations:    stats.Count,
+		Failures:      stats.Failures,
+		ElapsedMeanUS: stats.Mean.Microseconds(),
+		ElapsedP50US:  stats.P50.Microseconds(),
+		ElapsedP95US:  stats.P95.Microseconds(),
+		ElapsedP99US:  stats.P99.Microseconds(),
+		ElapsedMaxUS:  stats.Max.Microseconds(),
+		Missed:        stats.Missed,
+		LagMeanUS:     stats.MeanLag.Microseconds(),
+		MaxRSSBytes:   peakRSS,
+	}
+
+	var cpuUser, cpuSys, pause time.Duration
+	var allocBytes, allocObjects uint64
+	for _, it := range result.Iterations {
+		u := it.Usage
+		row.GCCycles += u.GCCycles
+		pause += u.GCPause
+		if u.PeakHeap > row.HeapPeakBytes {
+			row.HeapPeakBytes = u.PeakHeap
+		}
+		if it.Err != nil {
+			continue
+		}
+		cpuUser += u.CPUUser
+		cpuSys += u.CPUSys
+		allocBytes += u.AllocBytes
+		allocObjects += u.AllocObjects
+	}
+	row.GCPauseUS = pause.Microseconds()
+
+	if stats.Count > 0 {
+		n := int64(stats.Count)
+		row.CPUUserMeanUS = cpuUser.Microseconds() / n
+		row.CPUSysMeanUS = cpuSys.Microseconds() / n
+		row.AllocBytesMean = float64(allocBytes) / float64(n)
+		row.AllocObjsMean = float64(allocObjects) / float64(n)
+	}
+
+	return row
+}
+
+// Run measures every point in turn, each with a fresh analytic built from
+// cfg, and returns a row per point. It stops early, returning the rows so far,
+// if ctx is cancelled.
+func Run(ctx context.Context, cfg *config.Config, points []Point) ([]Row, error) {
+	var rows []Row
+	// The peak resident set is only measured per point while it can be reset
+	var resetErr error
+
+	for i, p := range points {
+		if ctx.Err() != nil {
+			break
+		}
+
+		pointCfg := p.Config(cfg, i)
+
+		log.Info().Str("run", pointCfg.RunID).Str("analytic", p.Analytic).Int("nodes", p.Nodes).Int("edges", p.Edges).Dur("freq", p.Frequency).Int("point", i+1).Int("points", len(points)).Msg("Sweep point")
+
+		// Start the point from a collected heap handed back to the kernel, so
+		// neither allocation nor resident memory left over from the last one
+		// is charged to it, and start the peak resident set from there
+		debug.FreeOSMemory()
+		if resetErr == nil {
+			if resetErr = resources.ResetPeakRSS(); resetErr != nil {
+				log.Warn().Err(resetErr).Msg("The peak resident set cannot be measured per point, max_rss_bytes is left at 0")
+			}
+		}
+
+		result, err := runner.Run(ctx, &pointCfg)
+		if err != nil {
+			return rows, fmt.Errorf("%s at %d nodes, %d edges: %v", p.Analytic, p.Nodes, p.Edges, err)
+		}
+
+		var peakRSS uint64
+		if resetErr == nil {
+			if peakRSS, err = resources.PeakRSS(); err != nil {
+				log.Warn().Err(err).Str("run", pointCfg.RunID).Msg("Could not read the peak resident set")
+			}
+		}
+		rows = append(rows, newRow(p, result, peakRSS))
+	}
+
+	return rows, nil
+}
+
+// Write saves the rows to path as CSV or JSON, chosen by the extension.
+func Write(path string, rows []Row) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		err = WriteCSV(file, rows)
+	case ".json":
+		err = WriteJSON(file, rows)
+	default:
+		return fmt.Errorf("unknown sweep output format %q, use .csv or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func WriteCSV(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := writer.Write(row.record()); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func WriteJSON(w io.Writer, rows []Row) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rows)
+}
+
+// Read loads rows written by Write, choosing CSV or JSON by the extension.
+func Read(path string) ([]Row, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return ReadCSV(file)
+	case ".json":
+		var rows []Row
+		err := json.NewDecoder(file).Decode(&rows)
+		return rows, err
+	}
+	return nil, fmt.Errorf("unknown sweep format %q, use .csv or .json", filepath.Ext(path))
+}
+
+func ReadCSV(r io.Reader) ([]Row, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(header, ",") {
+		return nil, fmt.Errorf("not a sweep file, the header must be %s", strings.Join(header, ","))
+	}
+
+	rows := make([]Row, 0, len(records)-1)
+	for line, record := range records[1:] {
+		row, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line+2, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseRecord(record []string) (Row, error) {
+	var err error
+	field := 1
+	i := func() int64 {
+		v, e := strconv.ParseInt(record[field], 10, 64)
+		if e != nil && err == nil {
+			err = fmt.Errorf("%s: %v", header[field], e)
+		}
+		field++
+		return v
+	}
+	u := func() uint64 {
+		v, e := strconv.ParseUint(record[field], 10, 64)
+		if e != nil && err == nil {
+			err = fmt.Errorf("%s: %v", header[field], e)
+		}
+		field++
+		return v
+	}
+	f := func() float64 {
+		v, e := strconv.ParseFloat(record[field], 64)
+		if e != nil && err == nil {
+			err = fmt.Errorf("%s: %v", header[field], e)
+		}
+		field++
+		return v
+	}
+
+	// Fields are read in header order
+	row := Row{Analytic: record[0]}
+	row.Nodes, row.Edges, row.FrequencyUS = int(i()), int(i()), i()
+	row.Iterations, row.Failures = int(i()), int(i())
+	row.ElapsedMeanUS, row.ElapsedP50US, row.ElapsedP95US, row.ElapsedP99US, row.ElapsedMaxUS = i(), i(), i(), i(), i()
+	row.CPUUserMeanUS, row.CPUSysMeanUS, row.AllocBytesMean, row.AllocObjsMean = i(), i(), f(), f()
+	row.GCCycles, row.GCPauseUS, row.HeapPeakBytes, row.MaxRSSBytes = u(), i(), u(), u()
+	row.Missed, row.LagMeanUS = int(i()), i()
+	return row, err
+}
@@ -0,0 +1,44 @@
+package sweep
+
+import (
+	"testing"
+	"time"
+
+	"analytics/config"
+)
+
+func TestPointConfigs(t *testing.T) {
+	cfg := config.Default()
+	cfg.RunID = "sweep"
+	cfg.Duration = config.Duration(time.Minute)
+	cfg.Sweep.Analytics = config.Strings{"baseline", "bfs"}
+	cfg.Sweep.Nodes = config.Ints{100, 1}
+	cfg.Sweep.Edges = config.Ints{500}
+	cfg.Sweep.Freqs = config.Durations{config.Duration(time.Second)}
+
+	points, err := Points(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 4 {
+		t.Fatalf("got %d points, want 2 analytics by 2 sizes", len(points))
+	}
+
+	invalid := 0
+	for i, p := range points {
+		pointCfg := p.Config(cfg, i)
+		if pointCfg.Analytic != p.Analytic || pointCfg.Nodes != p.Nodes || pointCfg.EdgeSampleSize != 500 || time.Duration(pointCfg.Frequency) != time.Second {
+			t.Errorf("point %d %+v has config %s at %d nodes, %d edges, %s", i, p, pointCfg.Analytic, pointCfg.Nodes, pointCfg.EdgeSampleSize, time.Duration(pointCfg.Frequency))
+		}
+		if pointCfg.Duration != 0 {
+			t.Errorf("point %d keeps the sweep's duration", i)
+		}
+		if pointCfg.Validate([]string{"baseline", "bfs"}) != nil {
+			invalid++
+		}
+	}
+	// The one node points cannot generate flows
+	if invalid != 2 {
+		t.Errorf("%d points are invalid, want the 2 with one node", invalid)
+	}
+}
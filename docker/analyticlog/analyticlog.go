@@ -0,0 +1,149 @@
+// Package analyticlog reads the compute iterations back out of an analytic's
+// zerolog output, as written by the analytics runner or captured with docker
+// logs, so they can be lined up with the resource samples taken alongside.
+package analyticlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Iteration is one timed computation.
+type Iteration struct {
+	Analytic  string
+	Run       string
+	Iteration int
+	Start     time.Time
+	Elapsed   time.Duration
+	// Detections is the alert count of analytics that raise alerts, and
+	// Detector is whether the iteration reported one
+	Detections int
+	Detector   bool
+}
+
+// End is when the computation finished.
+func (it Iteration) End() time.Time {
+	return it.Start.Add(it.Elapsed)
+}
+
+// entry holds the fields of a log event that an iteration is made from.
+type entry struct {
+	Analytic   string          `json:"analytic"`
+	Run        string          `json:"run"`
+	Iteration  int             `json:"iteration"`
+	Start      json.RawMessage `json:"start"`
+	Elapsed    *int64          `json:"elapsed"`
+	Detections *int            `json:"detections"`
+}
+
+// Parse reads an iteration from one log line, which is a zerolog event with
+// a start and an elapsed time, optionally behind the timestamp docker logs
+// -t adds. Other lines, including failed computations, which have no
+// elapsed time, give false.
+func Parse(line []byte) (Iteration, bool) {
+	brace := bytes.IndexByte(line, '{')
+	if brace < 0 {
+		return Iteration{}, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(line[brace:], &e); err != nil || e.Elapsed == nil || len(e.Start) == 0 {
+		return Iteration{}, false
+	}
+	start, ok := parseTime(e.Start)
+	if !ok {
+		return Iteration{}, false
+	}
+
+	it := Iteration{
+		Analytic:  e.Analytic,
+		Run:       e.Run,
+		Iteration: e.Iteration,
+		Start:     start,
+		// The runner logs elapsed in microseconds
+		Elapsed: time.Duration(*e.Elapsed) * time.Microsecond,
+	}
+	if e.Detections != nil {
+		it.Detections, it.Detector = *e.Detections, true
+	}
+	return it, true
+}
+
+// Read reads every iteration logged to r. Iterations from analytics that
+// predate the runner carry no number, and are numbered in the order they
+// were logged.
+func Read(r io.Reader) ([]Iteration, error) {
+	var iterations []Iteration
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		it, ok := Parse(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		if it.Iteration == 0 {
+			it.Iteration = len(iterations) + 1
+		}
+		iterations = append(iterations, it)
+	}
+	return iterations, scanner.Err()
+}
+
+// parseTime reads a zerolog time, which the analytics write as Unix
+// microseconds. Seconds and milliseconds, zerolog's other Unix formats, are
+// told apart by size, and RFC 3339 strings are zerolog's default.
+func parseTime(raw json.RawMessage) (time.Time, bool) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		t, err := time.Parse(time.RFC3339Nano, text)
+		return t, err == nil
+	}
+
+	n, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case n < 1e11:
+		return time.Unix(0, int64(n*1e9)), true
+	case n < 1e14:
+		return time.Unix(0, int64(n*1e6)), true
+	case n < 1e17:
+		return time.Unix(0, int64(n*1e3)), true
+	default:
+		return time.Unix(0, int64(n)), true
+	}
+}
+
+// Container picks the container an analytic's log or metrics came from
+// among names: the first candidate, such as the log's file name or the
+// analytic, that is a container's name, else the only container whose name
+// contains a candidate. It is empty when there is none or several.
+func Container(names []string, candidates ...string) string {
+	for _, c := range candidates {
+		for _, name := range names {
+			if c != "" && name == c {
+				return name
+			}
+		}
+	}
+
+	found := ""
+	for _, name := range names {
+		for _, c := range candidates {
+			if c == "" || !strings.Contains(name, c) {
+				continue
+			}
+			if found != "" && found != name {
+				return ""
+			}
+			found = name
+		}
+	}
+	return found
+}
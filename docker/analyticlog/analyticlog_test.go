@@ -0,0 +1,86 @@
+package analyticlog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"1700000000", time.Unix(1700000000, 0)},
+		{"1700000000.5", time.Unix(1700000000, 5e8)},
+		{"1700000000123", time.Unix(1700000000, 123e6)},
+		{"1700000000123456", time.Unix(1700000000, 123456e3)},
+		{"1700000000000000000", time.Unix(1700000000, 0)},
+		{`"2024-01-01T00:00:00.25Z"`, time.Date(2024, time.January, 1, 0, 0, 0, 25e7, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, ok := parseTime(json.RawMessage(tt.raw))
+		// Microseconds and nanoseconds pass through a float64, which holds
+		// them to within a few hundred nanoseconds
+		if d := got.Sub(tt.want); !ok || d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("parseTime(%s) = %s, %t, want %s", tt.raw, got, ok, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"0", "-5", "true", `"yesterday"`, `""`} {
+		if got, ok := parseTime(json.RawMessage(raw)); ok {
+			t.Errorf("parseTime(%s) = %s, want no time", raw, got)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	log := strings.Join([]string{
+		`2024-01-01T00:00:01.000000000Z {"level":"info","analytic":"klddos","run":"r1","iteration":7,"start":1700000000000000,"elapsed":1500,"detections":2}`,
+		`{"level":"error","analytic":"klddos","start":1700000001000000,"message":"Error: Computation failed"}`,
+		`not json`,
+		`{"level":"info","start":"2024-01-01T00:00:00Z","elapsed":20}`,
+	}, "\n")
+
+	iterations, err := Read(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(iterations) != 2 {
+		t.Fatalf("read %+v, want the two timed iterations", iterations)
+	}
+	first, second := iterations[0], iterations[1]
+	if first.Analytic != "klddos" || first.Run != "r1" || first.Iteration != 7 || first.Elapsed != 1500*time.Microsecond || !first.Detector || first.Detections != 2 {
+		t.Errorf("first iteration %+v", first)
+	}
+	if !first.End().Equal(time.Unix(1700000000, 1500e3)) {
+		t.Errorf("first iteration ends at %s", first.End())
+	}
+	if second.Iteration != 2 || second.Detector {
+		t.Errorf("unnumbered iteration %+v, want it numbered 2 with no detector", second)
+	}
+}
+
+func TestContainer(t *testing.T) {
+	names := []string{"exp-klddos-n100", "exp-bfs-n100", "bfs", "exp-pcr-n100", "exp-pcr-n1000"}
+	tests := []struct {
+		candidates []string
+		want       string
+	}{
+		{[]string{"bfs", "klddos"}, "bfs"},
+		{[]string{"klddos", "exp-bfs-n100"}, "exp-bfs-n100"},
+		{[]string{"", "klddos"}, "exp-klddos-n100"},
+		{[]string{"klddos", "exp-klddos"}, "exp-klddos-n100"},
+		{[]string{"pcr"}, ""},
+		{[]string{"klddos", "pcr-n1000"}, ""},
+		{[]string{"baseline"}, ""},
+		{[]string{"", ""}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := Container(names, tt.candidates...); got != tt.want {
+			t.Errorf("Container(%q) = %q, want %q", tt.candidates, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/sample"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sampleAPI streams the stats of every selected container from the Engine
+// API at once until ctx is done, writing them as they arrive. Streams are
+// opened for containers that start during the run and closed when they stop.
+// The daemon sends a reading about once a second, stamped with when it was
+// read.
+func sampleAPI(ctx context.Context, client *engine.Client, sel discover.Selector, out sample.Writer) error {
+	// Cancelled if writing fails, so the streams stop rather than block
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	samples := make(chan sample.Sample)
+	send := func(s sample.Sample) bool {
+		select {
+		case samples <- s:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var wg sync.WaitGroup
+	stream := func(ctx context.Context, c engine.Container) {
+		defer wg.Done()
+		log.Info().Str("container", c.Name()).Msg("Streaming container stats")
+
+		err := client.StreamStats(ctx, c.ID, func(s engine.Stats) error {
+			if !send(apiSample(c, s)) {
+				return engine.ErrStop
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Str("container", c.Name()).Msg("Error: Stats stream ended")
+		}
+	}
+
+	streams := map[string]context.CancelFunc{}
+	open := func(c engine.Container) {
+		if _, ok := streams[c.ID]; !ok {
+			streamCtx, stop := context.WithCancel(ctx)
+			streams[c.ID] = stop
+			wg.Add(1)
+			go stream(streamCtx, c)
+		}
+	}
+
+	watcher := discover.NewWatcher(client, sel)
+	running, err := watcher.List(ctx)
+	if err != nil {
+		return err
+	}
+	if len(running) == 0 {
+		log.Info().Msg("No selected containers running yet, waiting for them to start")
+	}
+	for _, c := range running {
+		open(c)
+	}
+
+	// From here Follow is the only goroutine to touch streams or add to wg,
+	// and wg is only waited on once it has returned
+	watchErr := make(chan error, 1)
+	go func() {
+		err := watcher.Follow(ctx, func(e discover.Event) {
+			id := e.Container.ID
+			log.Info().Str("container", e.Container.Name()).Str("event", e.Action).Msg("Container event")
+			send(marker(e))
+
+			switch e.Action {
+			case discover.Start, discover.Restart:
+				open(e.Container)
+			case discover.Stop, discover.Die:
+				if stop, ok := streams[id]; ok {
+					stop()
+					delete(streams, id)
+				}
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			cancel()
+		} else {
+			err = nil
+		}
+		wg.Wait()
+		close(samples)
+		watchErr <- err
+	}()
+
+	for s := range samples {
+		if err := out.Write(s); err != nil {
+			cancel()
+			return err
+		}
+	}
+	return <-watchErr
+}
+
+func apiSample(c engine.Container, s engine.Stats) sample.Sample {
+	rx, tx := s.NetIO()
+	read, write := s.BlockIO()
+
+	counters := &sample.Counters{
+		CPUTotal:         time.Duration(s.CPU.Usage.Total),
+		CPUUser:          time.Duration(s.CPU.Usage.User),
+		CPUSystem:        time.Duration(s.CPU.Usage.Kernel),
+		Periods:          s.CPU.Throttling.Periods,
+		ThrottledPeriods: s.CPU.Throttling.ThrottledPeriods,
+		ThrottledTime:    time.Duration(s.CPU.Throttling.ThrottledTime),
+	}
+	periods := s.CPU.Throttling.Periods - s.PreCPU.Throttling.Periods
+	throttled := s.CPU.Throttling.ThrottledPeriods - s.PreCPU.Throttling.ThrottledPeriods
+	if s.CPU.Throttling.Periods > s.PreCPU.Throttling.Periods && throttled <= periods {
+		counters.ThrottledPercent = float64(throttled) / float64(periods) * 100
+	}
+
+	return sample.Sample{
+		Time:          s.Read,
+		Container:     c.ID,
+		Name:          c.Name(),
+		CPUPercent:    s.CPUPercent(),
+		MemUsedBytes:  s.MemoryUsed(),
+		MemLimitBytes: s.Memory.Limit,
+		NetRxBytes:    rx,
+		NetTxBytes:    tx,
+		BlkReadBytes:  read,
+		BlkWriteBytes: write,
+		Pids:          s.Pids.Current,
+		Counters:      counters,
+	}
+}
@@ -0,0 +1,367 @@
+// Package cgroup reads a container's resource counters straight from its
+// cgroup v2 directory, which is exact and far cheaper than asking the docker
+// CLI.
+package cgroup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRoot is where the cgroup v2 hierarchy is mounted.
+const DefaultRoot = "/sys/fs/cgroup"
+
+var errFound = errors.New("found")
+
+// Find returns the cgroup directory of the container with the full id under
+// root, for both the systemd and cgroupfs cgroup drivers.
+func Find(root, id string) (string, error) {
+	for _, dir := range []string{
+		filepath.Join(root, "system.slice", "docker-"+id+".scope"),
+		filepath.Join(root, "docker", id),
+	} {
+		if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err == nil {
+			return dir, nil
+		}
+	}
+
+	// Nested or renamed slices, as with rootless docker, are searched for
+	found := ""
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if strings.Contains(d.Name(), id) {
+			found = path
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && err != errFound {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("no cgroup v2 directory for container %s under %s", id, root)
+	}
+	return found, nil
+}
+
+// Stats are the raw counters of one cgroup at one moment. Controllers that
+// are not enabled for the cgroup leave their counters at zero.
+type Stats struct {
+	Time time.Time
+
+	// cpu.stat
+	CPUUsage      time.Duration
+	CPUUser       time.Duration
+	CPUSystem     time.Duration
+	Periods       uint64
+	Throttled     uint64
+	ThrottledTime time.Duration
+
+	// memory.current, memory.max and memory.stat. MemoryMax is zero when
+	// the cgroup has no limit
+	MemoryCurrent uint64
+	MemoryMax     uint64
+	InactiveFile  uint64
+	Anon          uint64
+	File          uint64
+	Kernel        uint64
+	Sock          uint64
+	Shmem         uint64
+	PgFault       uint64
+	PgMajFault    uint64
+
+	// io.stat, summed over devices
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadIOs    uint64
+	WriteIOs   uint64
+
+	// pids.current
+	Pids uint64
+
+	// Network bytes of the cgroup's network namespace, read through its
+	// first process
+	NetRxBytes uint64
+	NetTxBytes uint64
+}
+
+// Read takes the counters of the cgroup in dir, stamping them with the time
+// they were read. The network counters are read through procfs mounted at
+// procRoot.
+func Read(dir, procRoot string) (Stats, error) {
+	s := Stats{Time: time.Now()}
+
+	cpu, err := readKeyed(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return s, err
+	}
+	s.CPUUsage = usec(cpu["usage_usec"])
+	s.CPUUser = usec(cpu["user_usec"])
+	s.CPUSystem = usec(cpu["system_usec"])
+	s.Periods = cpu["nr_periods"]
+	s.Throttled = cpu["nr_throttled"]
+	s.ThrottledTime = usec(cpu["throttled_usec"])
+
+	if s.MemoryCurrent, err = readValue(filepath.Join(dir, "memory.current")); err != nil {
+		return s, err
+	}
+	if s.MemoryMax, err = readValue(filepath.Join(dir, "memory.max")); err != nil {
+		return s, err
+	}
+	memory, err := readKeyed(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return s, err
+	}
+	s.InactiveFile = memory["inactive_file"]
+	s.Anon = memory["anon"]
+	s.File = memory["file"]
+	s.Kernel = memory["kernel"]
+	if _, ok := memory["kernel"]; !ok {
+		// Kernels before 5.18 only break kernel memory down
+		s.Kernel = memory["kernel_stack"] + memory["pagetables"] + memory["slab"]
+	}
+	s.Sock = memory["sock"]
+	s.Shmem = memory["shmem"]
+	s.PgFault = memory["pgfault"]
+	s.PgMajFault = memory["pgmajfault"]
+
+	if err := s.readIO(filepath.Join(dir, "io.stat")); err != nil {
+		return s, err
+	}
+
+	if s.Pids, err = readValue(filepath.Join(dir, "pids.current")); err != nil {
+		return s, err
+	}
+
+	if err := s.readNet(dir, procRoot); err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// MemoryUsed is the memory in use less the reclaimable page cache, as docker
+// stats reports it.
+func (s Stats) MemoryUsed() uint64 {
+	if s.InactiveFile > s.MemoryCurrent {
+		return 0
+	}
+	return s.MemoryCurrent - s.InactiveFile
+}
+
+// readNet sums <procRoot>/<pid>/net/dev, less loopback, for the first process
+// in the cgroup. An empty cgroup has no traffic to read.
+func (s *Stats) readNet(dir, procRoot string) error {
+	procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pids := strings.Fields(string(procs))
+	if len(pids) == 0 {
+		return nil
+	}
+
+	file, err := os.Open(filepath.Join(procRoot, pids[0], "net", "dev"))
+	if errors.Is(err, os.ErrNotExist) {
+		// The process exited between the two reads
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		iface, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(iface) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return err
+		}
+		s.NetRxBytes += rx
+		s.NetTxBytes += tx
+	}
+	return scanner.Err()
+}
+
+// HostMemory is the machine's total memory in bytes, which is what a
+// container without a memory limit is limited by, read from procfs mounted at
+// procRoot.
+func HostMemory(procRoot string) (uint64, error) {
+	meminfo, err := readKeyedUnits(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	return meminfo["MemTotal:"] * 1024, nil
+}
+
+// readKeyedUnits reads lines such as "MemTotal:  16316412 kB".
+func readKeyedUnits(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]uint64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values, nil
+}
+
+// readIO sums lines such as "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0 dios=0".
+func (s *Stats) readIO(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			switch key {
+			case "rbytes":
+				s.ReadBytes += n
+			case "wbytes":
+				s.WriteBytes += n
+			case "rios":
+				s.ReadIOs += n
+			case "wios":
+				s.WriteIOs += n
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// readKeyed reads a flat keyed file of "key value" lines. A missing file is
+// a controller that is not enabled and reads as empty.
+func readKeyed(path string) (map[string]uint64, error) {
+	values := map[string]uint64{}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		values[fields[0]] = n
+	}
+	return values, scanner.Err()
+}
+
+// readValue reads a single value file, where "max" reads as zero.
+func readValue(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return n, nil
+}
+
+func usec(n uint64) time.Duration {
+	return time.Duration(n) * time.Microsecond
+}
+
+// Rates are the changes between two readings that samples carry as rates.
+// The other counters are written to samples as they are, to be differenced
+// downstream.
+type Rates struct {
+	Interval time.Duration
+	// CPU is in cores, so 1.5 is one and a half CPUs busy
+	CPU float64
+	// ThrottledRatio is the fraction of enforcement periods that were
+	// throttled
+	ThrottledRatio float64
+}
+
+// Since is the CPU use and throttling from prev to s. Counters that went
+// backwards, because the container restarted, give a zero rate.
+func (s Stats) Since(prev Stats) Rates {
+	r := Rates{Interval: s.Time.Sub(prev.Time)}
+	seconds := r.Interval.Seconds()
+	if seconds <= 0 {
+		return r
+	}
+
+	cores := func(now, before time.Duration) float64 {
+		if now < before {
+			return 0
+		}
+		return (now - before).Seconds() / seconds
+	}
+
+	r.CPU = cores(s.CPUUsage, prev.CPUUsage)
+	if s.Periods > prev.Periods && s.Throttled >= prev.Throttled {
+		r.ThrottledRatio = float64(s.Throttled-prev.Throttled) / float64(s.Periods-prev.Periods)
+	}
+	return r
+}
@@ -0,0 +1,83 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Read takes a container's network counters and the host's memory from the
+// procfs it is given, as when dockerstats runs in a container with the
+// host's /proc mounted elsewhere.
+func TestReadUsesProcRoot(t *testing.T) {
+	dir, procRoot := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"cpu.stat":       "usage_usec 2000000\nuser_usec 1500000\nsystem_usec 500000\nnr_periods 100\nnr_throttled 10\nthrottled_usec 40000\n",
+		"memory.current": "104857600\n",
+		"memory.max":     "max\n",
+		"memory.stat":    "anon 50000000\nfile 40000000\ninactive_file 4857600\nkernel 1000000\npgfault 300\npgmajfault 2\n",
+		"io.stat":        "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n8:16 rbytes=4096 wbytes=0 rios=1 wios=0 dbytes=0 dios=0\n",
+		"pids.current":   "3\n",
+		"cgroup.procs":   "4242\n4243\n",
+	})
+	writeFiles(t, procRoot, map[string]string{
+		"4242/net/dev": "Inter-|   Receive                                                |  Transmit\n" +
+			" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n" +
+			"    lo:  999999     10    0    0    0     0          0         0   999999      10    0    0    0     0       0          0\n" +
+			"  eth0:    1500     12    0    0    0     0          0         0      700       9    0    0    0     0       0          0\n",
+		"meminfo": "MemTotal:       16316412 kB\nMemFree:         1000000 kB\n",
+	})
+
+	s, err := Read(dir, procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.NetRxBytes != 1500 || s.NetTxBytes != 700 {
+		t.Errorf("network rx %d tx %d, want 1500 and 700 from eth0 only", s.NetRxBytes, s.NetTxBytes)
+	}
+	if s.ReadBytes != 8192 || s.WriteBytes != 8192 || s.ReadIOs != 2 || s.WriteIOs != 2 {
+		t.Errorf("io read %d/%d write %d/%d, want the devices summed", s.ReadBytes, s.ReadIOs, s.WriteBytes, s.WriteIOs)
+	}
+	if s.MemoryMax != 0 || s.MemoryUsed() != 100000000 {
+		t.Errorf("memory max %d used %d, want no limit and 100000000 used", s.MemoryMax, s.MemoryUsed())
+	}
+
+	host, err := HostMemory(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != 16316412*1024 {
+		t.Errorf("host memory %d, want MemTotal in bytes", host)
+	}
+}
+
+func TestSince(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	prev := Stats{Time: start, CPUUsage: time.Second, Periods: 100, Throttled: 10}
+	now := Stats{Time: start.Add(2 * time.Second), CPUUsage: 4 * time.Second, Periods: 120, Throttled: 15}
+
+	r := now.Since(prev)
+	if r.Interval != 2*time.Second || r.CPU != 1.5 || r.ThrottledRatio != 0.25 {
+		t.Errorf("got %+v, want 1.5 cores over 2s with a quarter of periods throttled", r)
+	}
+
+	// A restarted container's counters start again from zero
+	restarted := Stats{Time: start.Add(4 * time.Second), CPUUsage: time.Second, Periods: 10}
+	if r := restarted.Since(now); r.CPU != 0 || r.ThrottledRatio != 0 {
+		t.Errorf("got %+v after a restart, want zero rates", r)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"dockerstats/cgroup"
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/sample"
+
+	"github.com/rs/zerolog/log"
+)
+
+// container is a running container and its cgroup directory.
+type container struct {
+	id     string
+	name   string
+	cgroup string
+	prev   cgroup.Stats
+}
+
+// sampleCgroups reads the cgroup of every selected container each interval
+// until ctx is done, following containers as they start and stop. Network
+// counters and host memory are read through procfs at procRoot. CPU
+// percentages are over the time since the previous sample, so are zero on a
+// container's first.
+func sampleCgroups(ctx context.Context, client *engine.Client, sel discover.Selector, root, procRoot string, interval time.Duration, out sample.Writer) error {
+	selected, watchDone, err := watchSelection(ctx, client, sel, out, func(c *container) error {
+		dir, err := cgroup.Find(root, c.id)
+		c.cgroup = dir
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Containers without a memory limit are limited by the host
+	hostMemory, err := cgroup.HostMemory(procRoot)
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Could not read host memory")
+	}
+
+	sched := newFixedRate(interval)
+	for {
+		skipped, ok := sched.wait(ctx)
+		if !ok {
+			return nil
+		}
+		if err := watchFailed(ctx, watchDone); err != nil {
+			return err
+		}
+		if skipped > 0 {
+			log.Warn().Int("skipped", skipped).Dur("interval", interval).Msg("Sampling fell behind, skipped samples")
+		}
+
+		for _, c := range selected.list() {
+			stats, err := cgroup.Read(c.cgroup, procRoot)
+			if err != nil && !selected.has(c.id) {
+				// Stopped since the list was taken
+				continue
+			}
+			if err != nil {
+				log.Error().Err(err).Str("container", c.name).Msg("Error: Could not read cgroup")
+				continue
+			}
+			if err := out.Write(cgroupSample(c, stats, hostMemory)); err != nil {
+				return err
+			}
+			c.prev = stats
+		}
+	}
+}
+
+func cgroupSample(c *container, s cgroup.Stats, hostMemory uint64) sample.Sample {
+	limit := s.MemoryMax
+	if limit == 0 {
+		limit = hostMemory
+	}
+
+	out := sample.Sample{
+		Time:          s.Time,
+		Container:     c.id,
+		Name:          c.name,
+		MemUsedBytes:  s.MemoryUsed(),
+		MemLimitBytes: limit,
+		NetRxBytes:    s.NetRxBytes,
+		NetTxBytes:    s.NetTxBytes,
+		BlkReadBytes:  s.ReadBytes,
+		BlkWriteBytes: s.WriteBytes,
+		Pids:          s.Pids,
+		Counters: &sample.Counters{
+			CPUTotal:         s.CPUUsage,
+			CPUUser:          s.CPUUser,
+			CPUSystem:        s.CPUSystem,
+			Periods:          s.Periods,
+			ThrottledPeriods: s.Throttled,
+			ThrottledTime:    s.ThrottledTime,
+		},
+		Memory: &sample.Memory{
+			Anon:       s.Anon,
+			File:       s.File,
+			Kernel:     s.Kernel,
+			Sock:       s.Sock,
+			Shmem:      s.Shmem,
+			PgFault:    s.PgFault,
+			PgMajFault: s.PgMajFault,
+			ReadIOs:    s.ReadIOs,
+			WriteIOs:   s.WriteIOs,
+		},
+	}
+
+	if !c.prev.Time.IsZero() {
+		r := s.Since(c.prev)
+		out.CPUPercent = r.CPU * 100
+		out.Counters.ThrottledPercent = r.ThrottledRatio * 100
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/sample"
+
+	"github.com/rs/zerolog/log"
+)
+
+// sampleCLI scrapes docker stats each interval until ctx is done, keeping the
+// selected containers and parsing the rounded, unit-suffixed columns into
+// numbers. docker stats takes a second or more to answer, so intervals
+// shorter than that skip samples.
+func sampleCLI(ctx context.Context, client *engine.Client, sel discover.Selector, interval time.Duration, out sample.Writer) error {
+	selected, watchDone, err := watchSelection(ctx, client, sel, out, func(*container) error { return nil })
+	if err != nil {
+		return err
+	}
+
+	sched := newFixedRate(interval)
+	for {
+		skipped, ok := sched.wait(ctx)
+		if !ok {
+			return nil
+		}
+		if err := watchFailed(ctx, watchDone); err != nil {
+			return err
+		}
+		if skipped > 0 {
+			log.Warn().Int("skipped", skipped).Dur("interval", interval).Msg("Sampling fell behind, skipped samples")
+		}
+
+		cmd := exec.CommandContext(ctx, "docker", "stats", "--no-stream", "--no-trunc", "--format", "{{.Container}},{{.Name}},{{.CPUPerc}},{{.MemUsage}},{{.NetIO}},{{.BlockIO}},{{.MemPerc}},{{.PIDs}}")
+
+		output, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("docker stats: %v", err)
+		}
+
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			// docker prints each line as soon as it has the container's
+			// stats, so the time it is read is the time of the sample
+			s, err := parseCLI(scanner.Text())
+			if err != nil {
+				// Skip it rather than leave docker stats running unwaited
+				log.Warn().Err(err).Msg("Skipped a docker stats line that could not be parsed")
+				continue
+			}
+			s.Time = time.Now()
+			if !selected.has(s.Container) {
+				continue
+			}
+
+			if err := out.Write(s); err != nil {
+				return err
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+
+		if err := cmd.Wait(); err != nil {
+			if ctx.Err() != nil {
+				// Stopped part way through a sample
+				return nil
+			}
+			return fmt.Errorf("docker stats: %v", err)
+		}
+	}
+}
+
+// parseCLI reads a line of the docker stats format above, such as
+// "abc,klddos,1.23%,12.3MiB / 1.9GiB,1.2kB / 0B,0B / 4.1kB,0.62%,5".
+func parseCLI(line string) (sample.Sample, error) {
+	columns := strings.Split(line, ",")
+	if len(columns) != 8 {
+		return sample.Sample{}, fmt.Errorf("unexpected docker stats line %q", line)
+	}
+
+	s := sample.Sample{Container: columns[0], Name: columns[1]}
+	var err error
+	if s.CPUPercent, err = sample.ParsePercent(columns[2]); err != nil {
+		return s, fmt.Errorf("CPU %% of %s: %v", s.Name, err)
+	}
+	if s.MemUsedBytes, s.MemLimitBytes, err = sample.ParseBytePair(columns[3]); err != nil {
+		return s, fmt.Errorf("memory of %s: %v", s.Name, err)
+	}
+	if s.NetRxBytes, s.NetTxBytes, err = sample.ParseBytePair(columns[4]); err != nil {
+		return s, fmt.Errorf("network IO of %s: %v", s.Name, err)
+	}
+	if s.BlkReadBytes, s.BlkWriteBytes, err = sample.ParseBytePair(columns[5]); err != nil {
+		return s, fmt.Errorf("block IO of %s: %v", s.Name, err)
+	}
+	if columns[7] != "--" {
+		if s.Pids, err = strconv.ParseUint(columns[7], 10, 64); err != nil {
+			return s, fmt.Errorf("PIDs of %s: %v", s.Name, err)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"dockerstats/sample"
+)
+
+func TestParseCLI(t *testing.T) {
+	tests := []struct {
+		line string
+		want sample.Sample
+	}{
+		{
+			"abc,klddos,1.23%,12.3MiB / 1.9GiB,1.2kB / 0B,0B / 4.1kB,0.62%,5",
+			sample.Sample{Container: "abc", Name: "klddos", CPUPercent: 1.23, MemUsedBytes: 12897485, MemLimitBytes: 2040109466, NetRxBytes: 1200, BlkWriteBytes: 4100, Pids: 5},
+		},
+		{
+			// A container that is stopping has no values
+			"def,bfs,--,-- / --,-- / --,-- / --,--,--",
+			sample.Sample{Container: "def", Name: "bfs"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseCLI(tt.line)
+		if err != nil {
+			t.Errorf("parseCLI(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseCLI(%q)\n got %+v\nwant %+v", tt.line, got, tt.want)
+		}
+	}
+
+	for _, line := range []string{
+		"",
+		"abc,klddos,1.23%,12.3MiB / 1.9GiB,1.2kB / 0B,0B / 4.1kB,0.62%",
+		"abc,klddos,high,12.3MiB / 1.9GiB,1.2kB / 0B,0B / 4.1kB,0.62%,5",
+		"abc,klddos,1.23%,12.3MiB,1.2kB / 0B,0B / 4.1kB,0.62%,5",
+		"abc,klddos,1.23%,12.3MiB / 1.9GiB,1.2kB / 0B,0B / 4.1kB,0.62%,five",
+	} {
+		if _, err := parseCLI(line); err == nil {
+			t.Errorf("parseCLI(%q) read a malformed line", line)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// correlate lines up the compute iterations in analytics' logs with the
+// resource samples dockerstats took while they ran. It attributes the CPU
+// seconds and memory each container used to every iteration and to the idle
+// time between iterations, and writes the cost of each iteration and a duty
+// cycle summary per analytic:
+//
+//	docker logs klddos > klddos.log 2>&1
+//	go run ./correlate -samples docker_stats_1700000000.csv klddos.log bfs.log
+//
+// A log is matched to the container -container gives for it, else to the
+// container named like the log file or after the analytic in it.
+// Samples are interpolated at the start and end of each iteration, so
+// iterations much shorter than the sample interval are estimates.
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dockerstats/analyticlog"
+	"dockerstats/sample"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// mapFlag is a repeatable key=value flag.
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m mapFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || k == "" || v == "" {
+			return fmt.Errorf("want log=container or analytic=container, got %q", pair)
+		}
+		m[k] = v
+	}
+	return nil
+}
+
+// summary is one analytic's duty cycle: the time from its first covered
+// iteration's start to its last one's end, split into the iterations and
+// the idle time between them.
+type summary struct {
+	analytic   string
+	container  string
+	iterations int
+	uncovered  int
+	busy       cost
+	idle       cost
+}
+
+func main() {
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	samplesPath := flag.String("samples", "", "samples written by dockerstats, as .csv or .jsonl")
+	outPath := flag.String("out", "", "CSV file for the cost of each iteration, defaulting to the samples file with _iterations.csv")
+	summaryPath := flag.String("summary", "", "CSV file for the duty cycle of each analytic, defaulting to the samples file with _summary.csv")
+	containers := mapFlag{}
+	flag.Var(containers, "container", "container a log's iterations ran in, as logfile=container or analytic=container, comma separated or repeated, for logs not named after their container")
+	flag.Parse()
+
+	if *samplesPath == "" || flag.NArg() == 0 {
+		log.Error().Msg("Usage: ./correlate -samples docker_stats.csv [-out iterations.csv] [-summary summary.csv] [-container log=container] <analytic log>...")
+		os.Exit(1)
+	}
+	base := strings.TrimSuffix(*samplesPath, filepath.Ext(*samplesPath))
+	if *outPath == "" {
+		*outPath = base + "_iterations.csv"
+	}
+	if *summaryPath == "" {
+		*summaryPath = base + "_summary.csv"
+	}
+
+	samples, err := sample.ReadFile(*samplesPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", *samplesPath).Msg("Error: Could not read the samples")
+		os.Exit(1)
+	}
+	byName := map[string][]sample.Sample{}
+	for _, s := range samples {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	allSeries := map[string]*series{}
+	for name, list := range byName {
+		if s := newSeries(name, list); len(s.times) > 1 {
+			allSeries[name] = s
+		}
+	}
+	log.Info().Str("path", *samplesPath).Int("samples", len(samples)).Int("containers", len(allSeries)).Msg("Read samples")
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", *outPath).Msg("Error: Could not create the iterations file")
+		os.Exit(1)
+	}
+	defer out.Close()
+	rows := csv.NewWriter(out)
+	rows.Write([]string{"analytic", "run", "container", "iteration", "start_ms", "elapsed_us", "cpu_seconds", "cpu_cores", "mem_mean_bytes", "mem_peak_bytes", "mem_byte_seconds", "samples", "detections"})
+
+	var summaries []summary
+	for _, path := range flag.Args() {
+		iterations, err := readLog(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Error: Could not read the log")
+			os.Exit(1)
+		}
+		if len(iterations) == 0 {
+			log.Warn().Str("path", path).Msg("No iterations in the log")
+			continue
+		}
+
+		analytic := iterations[0].Analytic
+		if analytic == "" {
+			analytic = logName(path)
+		}
+		s := matchSeries(allSeries, containers, path, analytic)
+		if s == nil {
+			log.Error().Str("path", path).Str("analytic", analytic).Msg("Error: No container's samples match the log, name the log after its container or give -container")
+			os.Exit(1)
+		}
+
+		sum := attribute(s, iterations, func(it analyticlog.Iteration, c cost) {
+			detections := ""
+			if it.Detector {
+				detections = strconv.Itoa(it.Detections)
+			}
+			rows.Write([]string{
+				analytic, it.Run, s.name, strconv.Itoa(it.Iteration),
+				strconv.FormatInt(it.Start.UnixMilli(), 10), strconv.FormatInt(it.Elapsed.Microseconds(), 10),
+				f(c.CPU), f(c.Cores()), f(c.MemMean()), f(c.MemPeak), f(c.MemSeconds), strconv.Itoa(c.Samples), detections,
+			})
+		})
+		sum.analytic = analytic
+		if sum.uncovered > 0 {
+			log.Warn().Str("analytic", analytic).Int("uncovered", sum.uncovered).Msg("Iterations outside the sampled time were left out")
+		}
+		summaries = append(summaries, sum)
+	}
+	rows.Flush()
+	if err := rows.Error(); err != nil {
+		log.Error().Err(err).Str("path", *outPath).Msg("Error: Could not write the iterations file")
+		os.Exit(1)
+	}
+
+	if err := writeSummaries(*summaryPath, summaries); err != nil {
+		log.Error().Err(err).Str("path", *summaryPath).Msg("Error: Could not write the summary file")
+		os.Exit(1)
+	}
+	printSummaries(summaries)
+
+	log.Info().Str("iterations", *outPath).Str("summary", *summaryPath).Msg("Costs have been written")
+}
+
+func readLog(path string) ([]analyticlog.Iteration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return analyticlog.Read(file)
+}
+
+// logName is the log's file name without its extension.
+func logName(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// matchSeries finds the container a log was written by: the one given for
+// the log or analytic by -container, else the one analyticlog.Container
+// picks by the log's file name and the analytic.
+func matchSeries(all map[string]*series, containers mapFlag, path, analytic string) *series {
+	for _, key := range []string{filepath.Base(path), logName(path), analytic} {
+		if name, ok := containers[key]; ok {
+			return all[name]
+		}
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	return all[analyticlog.Container(names, logName(path), analytic)]
+}
+
+// attribute costs each iteration the samples cover, passing it to each, and
+// sums them and the idle gaps between them. Where iterations overlap, the
+// time they share is counted in busy once, so busy and idle add up to the
+// span from the first start to the last end.
+func attribute(s *series, iterations []analyticlog.Iteration, each func(analyticlog.Iteration, cost)) summary {
+	sort.SliceStable(iterations, func(i, j int) bool { return iterations[i].Start.Before(iterations[j].Start) })
+
+	sum := summary{container: s.name}
+	var prev *analyticlog.Iteration
+	for i := range iterations {
+		it := &iterations[i]
+		if !s.covers(it.Start, it.End()) {
+			sum.uncovered++
+			continue
+		}
+
+		c := s.between(it.Start, it.End())
+		each(*it, c)
+		sum.iterations++
+
+		switch {
+		case prev == nil || !it.Start.Before(prev.End()):
+			sum.busy.add(c)
+		case it.End().After(prev.End()):
+			sum.busy.add(s.between(prev.End(), it.End()))
+		}
+		if prev != nil && it.Start.After(prev.End()) {
+			sum.idle.add(s.between(prev.End(), it.Start))
+		}
+		if prev == nil || it.End().After(prev.End()) {
+			prev = it
+		}
+	}
+	return sum
+}
+
+func writeSummaries(path string, summaries []summary) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write([]string{
+		"analytic", "container", "iterations", "uncovered",
+		"busy_seconds", "idle_seconds", "duty_cycle",
+		"busy_cpu_seconds", "idle_cpu_seconds", "busy_cpu_share", "busy_cores", "idle_cores", "cpu_seconds_per_iteration",
+		"mem_mean_busy_bytes", "mem_mean_idle_bytes", "mem_peak_bytes",
+	})
+	for _, s := range summaries {
+		w.Write([]string{
+			s.analytic, s.container, strconv.Itoa(s.iterations), strconv.Itoa(s.uncovered),
+			f(s.busy.Seconds), f(s.idle.Seconds), f(s.dutyCycle()),
+			f(s.busy.CPU), f(s.idle.CPU), f(s.busyCPUShare()), f(s.busy.Cores()), f(s.idle.Cores()), f(s.perIteration()),
+			f(s.busy.MemMean()), f(s.idle.MemMean()), f(math.Max(s.busy.MemPeak, s.idle.MemPeak)),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func printSummaries(summaries []summary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "analytic\tcontainer\titerations\tduty cycle\tcpu s/iteration\tbusy cores\tidle cores\tcpu in iterations\tbusy mem MiB\tidle mem MiB\t\n")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.1f%%\t%.4g\t%.3f\t%.3f\t%.1f%%\t%.1f\t%.1f\t\n",
+			s.analytic, s.container, s.iterations, s.dutyCycle()*100, s.perIteration(),
+			s.busy.Cores(), s.idle.Cores(), s.busyCPUShare()*100, s.busy.MemMean()/(1<<20), s.idle.MemMean()/(1<<20))
+	}
+}
+
+// dutyCycle is the share of the time spent computing.
+func (s summary) dutyCycle() float64 {
+	return ratio(s.busy.Seconds, s.busy.Seconds+s.idle.Seconds)
+}
+
+// busyCPUShare is the share of the CPU used while computing.
+func (s summary) busyCPUShare() float64 {
+	return ratio(s.busy.CPU, s.busy.CPU+s.idle.CPU)
+}
+
+func (s summary) perIteration() float64 {
+	return ratio(s.busy.CPU, float64(s.iterations))
+}
+
+func ratio(a, b float64) float64 {
+	if b <= 0 {
+		return 0
+	}
+	return a / b
+}
+
+func f(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
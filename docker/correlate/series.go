@@ -0,0 +1,154 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"dockerstats/sample"
+)
+
+// series is one container's samples as cumulative CPU seconds and memory in
+// use, which can be read at any moment between the first and last sample.
+type series struct {
+	name  string
+	times []time.Time
+	// cpu only goes up. It is built from the CPU counters where the source
+	// has them and from the CPU percentage otherwise, and does not move
+	// across a restart or a new container taking the name
+	cpu []float64
+	mem []float64
+}
+
+// newSeries orders the samples of one container name by time.
+func newSeries(name string, samples []sample.Sample) *series {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+
+	s := &series{name: name}
+	var prev *sample.Sample
+	total := 0.0
+	for i := range samples {
+		cur := &samples[i]
+		if cur.Event != "" {
+			continue
+		}
+		if prev != nil {
+			total += cpuBetween(*prev, *cur)
+		}
+		s.times = append(s.times, cur.Time)
+		s.cpu = append(s.cpu, total)
+		s.mem = append(s.mem, float64(cur.MemUsedBytes))
+		prev = cur
+	}
+	return s
+}
+
+// cpuBetween is the CPU seconds used from prev to cur. A counter that went
+// backwards, or a different container, counts as nothing rather than
+// guessing what the new one used before it was first sampled.
+func cpuBetween(prev, cur sample.Sample) float64 {
+	if prev.Container != cur.Container {
+		return 0
+	}
+	if prev.Counters != nil && cur.Counters != nil {
+		if cur.Counters.CPUTotal < prev.Counters.CPUTotal {
+			return 0
+		}
+		return (cur.Counters.CPUTotal - prev.Counters.CPUTotal).Seconds()
+	}
+	// The docker CLI only gives the percentage over the interval that ends
+	// at the sample
+	return cur.CPUPercent / 100 * cur.Time.Sub(prev.Time).Seconds()
+}
+
+func (s *series) start() time.Time { return s.times[0] }
+func (s *series) end() time.Time   { return s.times[len(s.times)-1] }
+
+// covers is whether the samples span from to to.
+func (s *series) covers(from, to time.Time) bool {
+	return len(s.times) > 1 && !from.Before(s.start()) && !to.After(s.end())
+}
+
+// at interpolates the cumulative CPU and the memory in use at t, which must
+// be within the samples' span.
+func (s *series) at(t time.Time) (cpu, mem float64) {
+	i := sort.Search(len(s.times), func(i int) bool { return !s.times[i].Before(t) })
+	if i == 0 {
+		return s.cpu[0], s.mem[0]
+	}
+	if i == len(s.times) {
+		return s.cpu[i-1], s.mem[i-1]
+	}
+	span := s.times[i].Sub(s.times[i-1]).Seconds()
+	if span <= 0 {
+		return s.cpu[i], s.mem[i]
+	}
+	f := t.Sub(s.times[i-1]).Seconds() / span
+	return s.cpu[i-1] + f*(s.cpu[i]-s.cpu[i-1]), s.mem[i-1] + f*(s.mem[i]-s.mem[i-1])
+}
+
+// cost is the resources used over an interval.
+type cost struct {
+	Seconds float64
+	CPU     float64
+	// MemSeconds is the integral of memory in use, in byte seconds, so
+	// dividing by Seconds gives the mean
+	MemSeconds float64
+	MemPeak    float64
+	// Samples is how many samples fell inside the interval. With none the
+	// cost is interpolated from the samples either side of it
+	Samples int
+}
+
+func (c *cost) add(o cost) {
+	c.Seconds += o.Seconds
+	c.CPU += o.CPU
+	c.MemSeconds += o.MemSeconds
+	if o.MemPeak > c.MemPeak {
+		c.MemPeak = o.MemPeak
+	}
+	c.Samples += o.Samples
+}
+
+// MemMean is the time weighted mean memory in use.
+func (c cost) MemMean() float64 {
+	if c.Seconds <= 0 {
+		return 0
+	}
+	return c.MemSeconds / c.Seconds
+}
+
+// Cores is the mean CPU use in cores.
+func (c cost) Cores() float64 {
+	if c.Seconds <= 0 {
+		return 0
+	}
+	return c.CPU / c.Seconds
+}
+
+// between is the cost from from to to, which the samples must cover. Memory
+// is integrated by the trapezium rule over the samples inside the interval
+// and the interpolated values at its ends.
+func (s *series) between(from, to time.Time) cost {
+	c := cost{Seconds: to.Sub(from).Seconds()}
+	cpuFrom, memFrom := s.at(from)
+	cpuTo, memTo := s.at(to)
+	c.CPU = cpuTo - cpuFrom
+
+	t, mem := from, memFrom
+	c.MemPeak = mem
+	step := func(next time.Time, nextMem float64) {
+		c.MemSeconds += (mem + nextMem) / 2 * next.Sub(t).Seconds()
+		if nextMem > c.MemPeak {
+			c.MemPeak = nextMem
+		}
+		t, mem = next, nextMem
+	}
+
+	i := sort.Search(len(s.times), func(i int) bool { return s.times[i].After(from) })
+	for ; i < len(s.times) && s.times[i].Before(to); i++ {
+		step(s.times[i], s.mem[i])
+		c.Samples++
+	}
+	step(to, memTo)
+	return c
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"dockerstats/analyticlog"
+	"dockerstats/sample"
+)
+
+var t0 = time.Unix(1700000000, 0)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func counted(container string, offset time.Duration, cpu time.Duration, mem uint64) sample.Sample {
+	return sample.Sample{Time: t0.Add(offset), Container: container, Name: "exp", MemUsedBytes: mem, Counters: &sample.Counters{CPUTotal: cpu}}
+}
+
+// testSeries uses 5 CPU seconds in its first 10 seconds, none in the next
+// 10 and 10 in the last 10, with memory going 100, 300, 300, 100.
+func testSeries() *series {
+	return newSeries("exp", []sample.Sample{
+		counted("a", 30*time.Second, 15*time.Second, 100),
+		counted("a", 0, 0, 100),
+		counted("a", 20*time.Second, 5*time.Second, 300),
+		counted("a", 10*time.Second, 5*time.Second, 300),
+	})
+}
+
+func TestCPUBetween(t *testing.T) {
+	prev := counted("a", 0, 2*time.Second, 0)
+	percent := func(container string, offset time.Duration, p float64) sample.Sample {
+		return sample.Sample{Time: t0.Add(offset), Container: container, CPUPercent: p}
+	}
+
+	tests := []struct {
+		name      string
+		prev, cur sample.Sample
+		want      float64
+	}{
+		{"counters", prev, counted("a", 2*time.Second, 3500*time.Millisecond, 0), 1.5},
+		{"counter reset", prev, counted("a", 2*time.Second, time.Second, 0), 0},
+		{"another container", prev, counted("b", 2*time.Second, 3*time.Second, 0), 0},
+		{"percentage over the interval", percent("a", 0, 50), percent("a", 2*time.Second, 150), 3},
+		{"counters on one side only", prev, percent("a", 4*time.Second, 25), 1},
+	}
+	for _, tt := range tests {
+		if got := cpuBetween(tt.prev, tt.cur); !near(got, tt.want) {
+			t.Errorf("%s: %g CPU seconds, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Markers are skipped, and a new container taking the name starts from the
+// total the old one reached.
+func TestNewSeries(t *testing.T) {
+	s := newSeries("exp", []sample.Sample{
+		counted("a", 0, time.Second, 10),
+		{Time: t0.Add(time.Second), Container: "b", Name: "exp", Event: "restart"},
+		counted("a", time.Second, 3*time.Second, 20),
+		counted("b", 2*time.Second, 500*time.Millisecond, 30),
+		counted("b", 3*time.Second, 1500*time.Millisecond, 40),
+	})
+	want := []float64{0, 2, 2, 3}
+	if len(s.cpu) != len(want) {
+		t.Fatalf("cpu %v, want %v", s.cpu, want)
+	}
+	for i := range want {
+		if !near(s.cpu[i], want[i]) || s.mem[i] != float64(10*(i+1)) {
+			t.Errorf("point %d is %g CPU seconds and %g bytes, want %g and %d", i, s.cpu[i], s.mem[i], want[i], 10*(i+1))
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	s := testSeries()
+	tests := []struct {
+		offset   time.Duration
+		cpu, mem float64
+	}{
+		{0, 0, 100},
+		{5 * time.Second, 2.5, 200},
+		{10 * time.Second, 5, 300},
+		{15 * time.Second, 5, 300},
+		{25 * time.Second, 10, 200},
+		{30 * time.Second, 15, 100},
+	}
+	for _, tt := range tests {
+		if cpu, mem := s.at(t0.Add(tt.offset)); !near(cpu, tt.cpu) || !near(mem, tt.mem) {
+			t.Errorf("at %s: %g CPU seconds and %g bytes, want %g and %g", tt.offset, cpu, mem, tt.cpu, tt.mem)
+		}
+	}
+}
+
+// From 5s to 15s memory goes 200, 300 at the sample at 10s, then 300, so
+// its integral is 5×250 + 5×300 byte seconds.
+func TestBetween(t *testing.T) {
+	c := testSeries().between(t0.Add(5*time.Second), t0.Add(15*time.Second))
+	if !near(c.Seconds, 10) || !near(c.CPU, 2.5) || !near(c.MemSeconds, 2750) || c.MemPeak != 300 || c.Samples != 1 {
+		t.Errorf("cost %+v", c)
+	}
+	if !near(c.Cores(), 0.25) || !near(c.MemMean(), 275) {
+		t.Errorf("%g cores and %g bytes mean, want 0.25 and 275", c.Cores(), c.MemMean())
+	}
+
+	if c := testSeries().between(t0.Add(12*time.Second), t0.Add(18*time.Second)); c.Samples != 0 || !near(c.CPU, 0) || !near(c.MemSeconds, 1800) {
+		t.Errorf("cost between samples %+v", c)
+	}
+}
+
+// Iterations run 2–8s, 12–16s, 24–28s and 26–29s, and one from 29s runs
+// past the last sample. The overlap from 26s to 28s is busy once, and the
+// gaps 8–12s and 16–24s are idle.
+func TestAttribute(t *testing.T) {
+	iteration := func(n int, start, elapsed time.Duration) analyticlog.Iteration {
+		return analyticlog.Iteration{Analytic: "klddos", Iteration: n, Start: t0.Add(start), Elapsed: elapsed}
+	}
+	iterations := []analyticlog.Iteration{
+		iteration(3, 24*time.Second, 4*time.Second),
+		iteration(1, 2*time.Second, 6*time.Second),
+		iteration(2, 12*time.Second, 4*time.Second),
+		iteration(4, 26*time.Second, 3*time.Second),
+		iteration(5, 29*time.Second, 5*time.Second),
+	}
+
+	perIteration := map[int]float64{}
+	sum := attribute(testSeries(), iterations, func(it analyticlog.Iteration, c cost) {
+		perIteration[it.Iteration] = c.CPU
+	})
+
+	want := map[int]float64{1: 3, 2: 0, 3: 4, 4: 3}
+	if len(perIteration) != len(want) {
+		t.Errorf("costed iterations %v, want %v", perIteration, want)
+	}
+	for n, cpu := range want {
+		if !near(perIteration[n], cpu) {
+			t.Errorf("iteration %d used %g CPU seconds, want %g", n, perIteration[n], cpu)
+		}
+	}
+
+	if sum.iterations != 4 || sum.uncovered != 1 {
+		t.Errorf("%d iterations and %d uncovered, want 4 and 1", sum.iterations, sum.uncovered)
+	}
+	if !near(sum.busy.Seconds, 15) || !near(sum.busy.CPU, 8) {
+		t.Errorf("busy %gs using %g CPU seconds, want 15s and 8", sum.busy.Seconds, sum.busy.CPU)
+	}
+	if !near(sum.idle.Seconds, 12) || !near(sum.idle.CPU, 5) {
+		t.Errorf("idle %gs using %g CPU seconds, want 12s and 5", sum.idle.Seconds, sum.idle.CPU)
+	}
+	if !near(sum.dutyCycle(), 15.0/27) {
+		t.Errorf("duty cycle %g, want 15/27", sum.dutyCycle())
+	}
+}
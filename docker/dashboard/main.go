@@ -0,0 +1,179 @@
+// dashboard shows a running experiment in the terminal, redrawing in place:
+// each container's CPU, memory and network traffic as sparklines from the
+// samples dockerstats is writing, and the latest computation of the analytic
+// in it, from the analytic's log or its Prometheus metrics:
+//
+//	go run . -out results/stats.csv 2h &
+//	go run ./dashboard -samples results/stats.csv -log results/klddos.log -metrics bfs=http://localhost:9090/metrics
+//
+// Logs and metrics are matched to containers by name as correlate matches
+// them, so a log named after its container needs no name.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// sourceFlag is a repeatable flag of name=source or just source, comma
+// separated or repeated.
+type sourceFlag []string
+
+func (s *sourceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *sourceFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
+	}
+	return nil
+}
+
+// named splits name=source, naming a bare source with fallback.
+func named(v string, fallback func(string) string) (string, string) {
+	if name, source, ok := strings.Cut(v, "="); ok && !strings.Contains(name, "/") {
+		return name, source
+	}
+	return fallback(v), v
+}
+
+func main() {
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	samplesPath := flag.String("samples", "", "samples file dockerstats is writing, as .csv or .jsonl")
+	var logs, metrics sourceFlag
+	flag.Var(&logs, "log", "analytic log file to follow, as path or container=path, comma separated or repeated")
+	flag.Var(&metrics, "metrics", "analytic runner metrics to scrape, as url or container=url, comma separated or repeated")
+	refresh := flag.Duration("refresh", time.Second, "time between redraws")
+	size := flag.Int("history", 60, "points in each sparkline")
+	once := flag.Bool("once", false, "read what has been written so far, draw it once and exit")
+	flag.Parse()
+
+	if *samplesPath == "" || flag.NArg() != 0 {
+		log.Error().Msg("Usage: ./dashboard -samples docker_stats.csv [-log [container=]path] [-metrics [container=]url] [-refresh 1s] [-history 60] [-once]")
+		os.Exit(1)
+	}
+	if *refresh <= 0 || *size <= 0 {
+		log.Error().Msg("Error: refresh and history must be positive")
+		os.Exit(1)
+	}
+
+	samples := &sampleTail{path: *samplesPath}
+	var logTails []*logTail
+	for _, l := range logs {
+		name, path := named(l, func(path string) string {
+			return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		})
+		logTails = append(logTails, &logTail{name: name, path: path})
+	}
+	var scrapes []*metricsScrape
+	client := &http.Client{Timeout: *refresh}
+	for _, m := range metrics {
+		name, address := named(m, func(address string) string {
+			if u, err := url.Parse(address); err == nil && u.Host != "" {
+				return u.Host
+			}
+			return address
+		})
+		scrapes = append(scrapes, &metricsScrape{name: name, url: address, client: client})
+	}
+	defer closeAll(samples, logTails)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	v := newView(*samplesPath, *size)
+	update := func() []string {
+		var errs []string
+		read, err := samples.read()
+		for _, s := range read {
+			v.add(s)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", samples.path, err))
+		}
+
+		computes := map[string]*compute{}
+		for _, l := range logTails {
+			if err := l.read(); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", l.path, err))
+			}
+			if l.latest != nil {
+				computes[l.name] = l.latest
+			}
+		}
+		for _, m := range scrapes {
+			if err := m.read(ctx); err != nil && ctx.Err() == nil {
+				errs = append(errs, err.Error())
+			}
+			if m.latest != nil {
+				computes[m.name] = m.latest
+			}
+		}
+		return v.render(time.Now(), computes, errs)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	if *once {
+		for _, line := range update() {
+			fmt.Fprintln(out, line)
+		}
+		out.Flush()
+		return
+	}
+
+	// Redraw over the previous frame when on a terminal, and print frames
+	// one after another otherwise
+	terminal := false
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		terminal = true
+		fmt.Fprint(out, "\x1b[?25l\x1b[2J")
+		defer func() {
+			fmt.Fprint(out, "\x1b[?25h")
+			out.Flush()
+		}()
+	}
+
+	ticker := time.NewTicker(*refresh)
+	defer ticker.Stop()
+	for {
+		lines := update()
+		if terminal {
+			fmt.Fprint(out, "\x1b[H")
+			for _, line := range lines {
+				fmt.Fprint(out, line, "\x1b[K\n")
+			}
+			fmt.Fprint(out, "\x1b[J")
+		} else {
+			for _, line := range lines {
+				fmt.Fprintln(out, line)
+			}
+		}
+		out.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
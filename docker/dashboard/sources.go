@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dockerstats/analyticlog"
+	"dockerstats/sample"
+)
+
+// compute is the latest computation an analytic reported.
+type compute struct {
+	// Analytic is the name the analytic reported, if any
+	Analytic   string
+	Elapsed    time.Duration
+	Iteration  int
+	Detections int
+	Detector   bool
+	// At is when the computation finished, or when the metrics showed it
+	At time.Time
+	// Source is the log file or metrics URL it was read from
+	Source string
+}
+
+// sampleTail reads a dockerstats file as it is written, waiting for it to
+// be created.
+type sampleTail struct {
+	path   string
+	file   *os.File
+	reader *sample.Reader
+}
+
+// read returns the samples appended since the last read.
+func (t *sampleTail) read() ([]sample.Sample, error) {
+	if t.reader == nil {
+		format, err := sample.FormatOf(t.path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := os.Open(t.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		reader, err := sample.NewReader(file, format)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		t.file, t.reader = file, reader
+	}
+
+	var samples []sample.Sample
+	for {
+		s, err := t.reader.Read()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, err
+		}
+		samples = append(samples, s)
+	}
+}
+
+// logTail follows an analytic's log file, keeping the latest iteration.
+type logTail struct {
+	name    string
+	path    string
+	file    *os.File
+	reader  *bufio.Reader
+	partial []byte
+	latest  *compute
+}
+
+// read parses the lines appended since the last read.
+func (t *logTail) read() error {
+	if t.reader == nil {
+		file, err := os.Open(t.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.file, t.reader = file, bufio.NewReader(file)
+	}
+
+	for {
+		chunk, err := t.reader.ReadBytes('\n')
+		t.partial = append(t.partial, chunk...)
+		if err == io.EOF {
+			// Keep a line cut short until the rest of it is written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		it, ok := analyticlog.Parse(t.partial)
+		t.partial = t.partial[:0]
+		if ok {
+			t.latest = &compute{
+				Analytic:   it.Analytic,
+				Elapsed:    it.Elapsed,
+				Iteration:  it.Iteration,
+				Detections: it.Detections,
+				Detector:   it.Detector,
+				At:         it.End(),
+				Source:     t.path,
+			}
+		}
+	}
+}
+
+// metricsScrape polls an analytic runner's Prometheus endpoint. The
+// endpoint has a histogram rather than each computation, so the latest
+// elapsed time is the mean over the runs since the previous scrape, or over
+// every run on the first. Detections are the latest run's, from its gauge.
+type metricsScrape struct {
+	name   string
+	url    string
+	client *http.Client
+
+	scraped bool
+	count   float64
+	sum     float64
+	latest  *compute
+}
+
+func (m *metricsScrape) read(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", m.url, resp.Status)
+	}
+
+	values, analytic, err := parseMetrics(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %v", m.url, err)
+	}
+	count, sum := values["analytic_compute_duration_seconds_count"], values["analytic_compute_duration_seconds_sum"]
+	found, detector := values["analytic_detections"]
+
+	if count > m.count {
+		runs := count - m.count
+		m.latest = &compute{
+			Analytic:  analytic,
+			Elapsed:   time.Duration((sum - m.sum) / runs * float64(time.Second)),
+			Iteration: int(count),
+			Detector:  detector,
+			At:        time.Now(),
+			Source:    m.url,
+		}
+		if detector {
+			m.latest.Detections = int(found)
+		}
+	}
+	m.scraped, m.count, m.sum = true, count, sum
+	return nil
+}
+
+// parseMetrics reads the analytic_ samples from the Prometheus text format,
+// returning them by name, without their labels, and the analytic label they
+// carry. A runner serves one analytic, so the label is the same throughout.
+func parseMetrics(r io.Reader) (map[string]float64, string, error) {
+	values := map[string]float64{}
+	analytic := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "analytic_") {
+			continue
+		}
+		name, labels := line, ""
+		if brace := strings.IndexByte(line, '{'); brace >= 0 {
+			end := strings.LastIndexByte(line, '}')
+			if end < brace {
+				return nil, "", fmt.Errorf("malformed line %q", line)
+			}
+			name, labels = line[:brace], line[brace+1:end]
+			line = line[end+1:]
+		} else {
+			name, line, _ = strings.Cut(line, " ")
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil, "", fmt.Errorf("malformed line %q", scanner.Text())
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("malformed line %q", scanner.Text())
+		}
+		if strings.Contains(labels, `le="`) {
+			// Histogram buckets are not needed
+			continue
+		}
+		values[name] += v
+
+		if _, rest, ok := strings.Cut(labels, `analytic="`); ok {
+			analytic, _, _ = strings.Cut(rest, `"`)
+		}
+	}
+	return values, analytic, scanner.Err()
+}
+
+// closeAll closes the files being followed.
+func closeAll(samples *sampleTail, logs []*logTail) {
+	if samples.file != nil {
+		samples.file.Close()
+	}
+	for _, l := range logs {
+		if l.file != nil {
+			l.file.Close()
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// exposition is what an analytic runner serves on /metrics, as the
+// analytics metrics test scrapes it, after count runs that took sum seconds
+// between them. The histogram buckets are trimmed, and runners of analytics
+// that raise no alerts have no detections gauge.
+func exposition(count int, sum float64, detections int, detector bool) string {
+	text := `# HELP analytic_compute_duration_seconds Wall clock time of each analytic Run.
+# TYPE analytic_compute_duration_seconds histogram
+analytic_compute_duration_seconds_bucket{analytic="klddos",le="0.0016"} 0
+analytic_compute_duration_seconds_bucket{analytic="klddos",le="0.0032"} 1
+analytic_compute_duration_seconds_bucket{analytic="klddos",le="0.0512"} %[1]d
+analytic_compute_duration_seconds_bucket{analytic="klddos",le="+Inf"} %[1]d
+analytic_compute_duration_seconds_sum{analytic="klddos"} %[2]g
+analytic_compute_duration_seconds_count{analytic="klddos"} %[1]d
+# HELP analytic_compute_failures_total Runs that returned an error.
+# TYPE analytic_compute_failures_total counter
+analytic_compute_failures_total{analytic="klddos"} 1
+# HELP analytic_flows_ingested_total Flows handed to the analytic.
+# TYPE analytic_flows_ingested_total counter
+analytic_flows_ingested_total{analytic="klddos"} 1200
+# HELP analytic_queue_depth Scheduled runs that were due but had not started when the last run finished, for the open loop schedules.
+# TYPE analytic_queue_depth gauge
+analytic_queue_depth{analytic="klddos"} 2
+# HELP go_goroutines Number of goroutines that currently exist.
+# TYPE go_goroutines gauge
+go_goroutines 10
+`
+	if detector {
+		text += `# HELP analytic_detections Detections raised by the latest run.
+# TYPE analytic_detections gauge
+analytic_detections{analytic="klddos"} %[3]d
+`
+	}
+	return fmt.Sprintf(text, count, sum, detections)
+}
+
+func TestParseMetrics(t *testing.T) {
+	values, analytic, err := parseMetrics(strings.NewReader(exposition(2, 0.043, 7, true) + "analytic_up 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analytic != "klddos" {
+		t.Errorf("analytic %q, want klddos from the labels", analytic)
+	}
+
+	want := map[string]float64{
+		"analytic_compute_duration_seconds_sum":   0.043,
+		"analytic_compute_duration_seconds_count": 2,
+		"analytic_compute_failures_total":         1,
+		"analytic_flows_ingested_total":           1200,
+		"analytic_queue_depth":                    2,
+		"analytic_detections":                     7,
+		"analytic_up":                             1,
+	}
+	if len(values) != len(want) {
+		t.Errorf("read %v, want only %v without the buckets or go_ samples", values, want)
+	}
+	for name, v := range want {
+		if got, ok := values[name]; !ok || got != v {
+			t.Errorf("%s is %g, want %g", name, got, v)
+		}
+	}
+
+	for _, text := range []string{
+		`analytic_queue_depth{analytic="klddos" 2`,
+		`analytic_queue_depth{analytic="klddos"} two`,
+		`analytic_queue_depth`,
+	} {
+		if _, _, err := parseMetrics(strings.NewReader(text + "\n")); err == nil {
+			t.Errorf("read the malformed line %q", text)
+		}
+	}
+}
+
+// metricsServer serves the expositions it is given in turn, repeating the
+// last.
+type metricsServer struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (m *metricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.texts) == 0 {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, m.texts[0])
+	if len(m.texts) > 1 {
+		m.texts = m.texts[1:]
+	}
+}
+
+// The elapsed time is the mean of the runs between scrapes, from the
+// histogram's sum and count, and the detections are the latest run's.
+func TestMetricsScrape(t *testing.T) {
+	server := httptest.NewServer(&metricsServer{texts: []string{
+		exposition(2, 0.043, 7, true),
+		exposition(2, 0.043, 7, true),
+		exposition(5, 0.343, 3, true),
+	}})
+	defer server.Close()
+	m := &metricsScrape{name: "klddos", url: server.URL, client: server.Client()}
+	ctx := context.Background()
+
+	if err := m.read(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first := m.latest
+	if first == nil || first.Analytic != "klddos" || first.Iteration != 2 || first.Elapsed.Round(time.Microsecond) != 21500*time.Microsecond || !first.Detector || first.Detections != 7 {
+		t.Fatalf("first scrape read %+v, want the mean of both runs", first)
+	}
+
+	if err := m.read(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.latest != first {
+		t.Errorf("a scrape with no new runs changed the latest to %+v", m.latest)
+	}
+
+	if err := m.read(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if l := m.latest; l.Iteration != 5 || l.Elapsed.Round(time.Microsecond) != 100*time.Millisecond || l.Detections != 3 {
+		t.Errorf("third scrape read %+v, want 100ms, the mean of the three new runs, and 3 detections", l)
+	}
+}
+
+func TestMetricsScrapeWithoutDetector(t *testing.T) {
+	fake := &metricsServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	m := &metricsScrape{name: "bfs", url: server.URL, client: server.Client()}
+
+	if err := m.read(context.Background()); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("an unready runner read with %v", err)
+	}
+
+	fake.mu.Lock()
+	fake.texts = []string{exposition(1, 0.5, 0, false)}
+	fake.mu.Unlock()
+	if err := m.read(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if l := m.latest; l == nil || l.Detector || l.Elapsed != 500*time.Millisecond {
+		t.Errorf("read %+v, want 500ms and no detector", l)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"dockerstats/analyticlog"
+	"dockerstats/discover"
+	"dockerstats/sample"
+)
+
+// sparks are the eight heights a sparkline is drawn with.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// history is the last points of one measurement, oldest first.
+type history struct {
+	points []float64
+	size   int
+}
+
+func (h *history) add(v float64) {
+	h.points = append(h.points, v)
+	if len(h.points) > h.size {
+		h.points = h.points[len(h.points)-h.size:]
+	}
+}
+
+// spark draws the points scaled from zero to their largest, or to floor if
+// that is larger, padded to the history's size so the columns line up.
+func (h *history) spark(floor float64) string {
+	top := floor
+	for _, v := range h.points {
+		top = math.Max(top, v)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", h.size-len(h.points)))
+	for _, v := range h.points {
+		i := 0
+		if top > 0 {
+			i = int(v / top * float64(len(sparks)-1))
+		}
+		if i < 0 {
+			i = 0
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+func (h *history) last() float64 {
+	if len(h.points) == 0 {
+		return 0
+	}
+	return h.points[len(h.points)-1]
+}
+
+// panel is what the dashboard shows for one container.
+type panel struct {
+	id      string
+	name    string
+	stopped bool
+	// restarts counts the starts after the container was seen to stop
+	restarts int
+
+	cpu, mem, rx, tx *history
+	net              bool
+	last             sample.Sample
+	lastAt           time.Time
+}
+
+// view is the dashboard's state, updated from the samples and computations
+// as they are read.
+type view struct {
+	samplesPath string
+	size        int
+	panels      map[string]*panel
+}
+
+func newView(samplesPath string, size int) *view {
+	return &view{samplesPath: samplesPath, size: size, panels: map[string]*panel{}}
+}
+
+// add records one sample. Panels are kept by container name, so a container
+// recreated under the same name carries on in the same panel.
+func (v *view) add(s sample.Sample) {
+	p := v.panels[s.Name]
+	if p == nil {
+		p = &panel{
+			name: s.Name,
+			cpu:  &history{size: v.size},
+			mem:  &history{size: v.size},
+			rx:   &history{size: v.size},
+			tx:   &history{size: v.size},
+		}
+		v.panels[s.Name] = p
+	}
+	p.id = s.Container
+
+	if s.Event != "" {
+		switch s.Event {
+		case discover.Start, discover.Restart:
+			if p.stopped {
+				p.restarts++
+			}
+			p.stopped = false
+		case discover.Stop, discover.Die, discover.OOM:
+			p.stopped = true
+		}
+		return
+	}
+
+	p.stopped = false
+	p.cpu.add(s.CPUPercent)
+	p.mem.add(float64(s.MemUsedBytes))
+
+	p.net = !unread(s, "net_rx_bytes")
+	if p.net && !p.lastAt.IsZero() && p.last.Container == s.Container {
+		seconds := s.Time.Sub(p.last.Time).Seconds()
+		p.rx.add(rate(s.NetRxBytes, p.last.NetRxBytes, seconds))
+		p.tx.add(rate(s.NetTxBytes, p.last.NetTxBytes, seconds))
+	}
+	p.last, p.lastAt = s, s.Time
+}
+
+func unread(s sample.Sample, column string) bool {
+	for _, c := range s.Unread {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// rate is the change per second of a counter, zero when it went backwards.
+func rate(now, before uint64, seconds float64) float64 {
+	if seconds <= 0 || now < before {
+		return 0
+	}
+	return float64(now-before) / seconds
+}
+
+// names is the containers in name order.
+func (v *view) names() []string {
+	names := make([]string, 0, len(v.panels))
+	for name := range v.panels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// render draws the whole dashboard as lines. computes are keyed by the log
+// or metrics source's name and matched to containers as the correlate
+// command matches logs.
+func (v *view) render(now time.Time, computes map[string]*compute, errs []string) []string {
+	names := v.names()
+	byContainer := map[string]*compute{}
+	var unmatched []string
+	for key, c := range computes {
+		name := analyticlog.Container(names, key, c.Analytic)
+		if name == "" {
+			unmatched = append(unmatched, key)
+			continue
+		}
+		if prev := byContainer[name]; prev == nil || c.At.After(prev.At) {
+			byContainer[name] = c
+		}
+	}
+	sort.Strings(unmatched)
+
+	lines := []string{
+		fmt.Sprintf("dockerstats dashboard  %s  %d containers  %s", v.samplesPath, len(v.panels), now.Format("15:04:05")),
+		"",
+	}
+	if len(names) == 0 {
+		lines = append(lines, "Waiting for samples")
+	}
+
+	for _, name := range names {
+		p := v.panels[name]
+		state := "running"
+		if p.stopped {
+			state = "stopped"
+		}
+		if p.restarts > 0 {
+			state += fmt.Sprintf(", %d restarts", p.restarts)
+		}
+		age := ""
+		if !p.lastAt.IsZero() {
+			age = fmt.Sprintf(", sampled %s ago", now.Sub(p.lastAt).Round(time.Second))
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s  (%s%s)", name, short(p.id), state, age))
+
+		limit := ""
+		if p.last.MemLimitBytes > 0 {
+			limit = fmt.Sprintf(" of %s, %.1f%%", bytes(float64(p.last.MemLimitBytes)), p.last.MemPercent())
+		}
+		lines = append(lines,
+			fmt.Sprintf("  cpu  %s  %6.1f%%", p.cpu.spark(100), p.cpu.last()),
+			fmt.Sprintf("  mem  %s  %s%s", p.mem.spark(0), bytes(p.mem.last()), limit),
+		)
+		if p.net {
+			lines = append(lines,
+				fmt.Sprintf("  rx   %s  %s/s", p.rx.spark(0), bytes(p.rx.last())),
+				fmt.Sprintf("  tx   %s  %s/s", p.tx.spark(0), bytes(p.tx.last())),
+			)
+		} else {
+			lines = append(lines, "  net  not sampled")
+		}
+
+		if c := byContainer[name]; c != nil {
+			detections := ""
+			if c.Detector {
+				detections = fmt.Sprintf("  detections %d", c.Detections)
+			}
+			lines = append(lines, fmt.Sprintf("  compute  elapsed %s%s  iteration %d  %s ago", c.Elapsed.Round(time.Microsecond), detections, c.Iteration, now.Sub(c.At).Round(time.Second)))
+		}
+		lines = append(lines, "")
+	}
+
+	for _, key := range unmatched {
+		c := computes[key]
+		lines = append(lines, fmt.Sprintf("%s: no container matches, last compute elapsed %s", key, c.Elapsed.Round(time.Microsecond)))
+	}
+	for _, err := range errs {
+		lines = append(lines, "Error: "+err)
+	}
+	return lines
+}
+
+// short is a container id as docker ps shows it.
+func short(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// bytes formats a size in binary units, as docker stats does.
+func bytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f%s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f%s", n, units[i])
+}
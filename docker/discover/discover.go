@@ -0,0 +1,186 @@
+// Package discover finds the experiment's containers, by name pattern, image
+// or label, and follows them through Docker events as they start, stop and
+// restart during a run.
+package discover
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"dockerstats/engine"
+)
+
+// Docker event actions reported for a selected container.
+const (
+	Start   = "start"
+	Restart = "restart"
+	Stop    = "stop"
+	Die     = "die"
+	OOM     = "oom"
+)
+
+var actions = []string{Start, Restart, Stop, Die, OOM}
+
+// Selector chooses containers. Names and Images are glob patterns, any of
+// which may match; Labels are key or key=value, all of which must match. An
+// empty Selector chooses every container.
+type Selector struct {
+	Names  []string
+	Images []string
+	Labels []string
+}
+
+// Match reports whether c is selected.
+func (s Selector) Match(c engine.Container) bool {
+	if len(s.Names) > 0 && !anyMatch(s.Names, c.Name()) {
+		return false
+	}
+	if len(s.Images) > 0 {
+		// Patterns match the image with or without its tag
+		untagged := c.Image
+		if i := strings.LastIndex(untagged, ":"); i > strings.LastIndex(untagged, "/") {
+			untagged = untagged[:i]
+		}
+		if !anyMatch(s.Images, c.Image) && !anyMatch(s.Images, untagged) {
+			return false
+		}
+	}
+	for _, label := range s.Labels {
+		key, value, hasValue := strings.Cut(label, "=")
+		actual, ok := c.Labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyMatch(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change to a selected container.
+type Event struct {
+	Time      time.Time
+	Action    string
+	Container engine.Container
+}
+
+// Watcher follows the containers a Selector chooses.
+type Watcher struct {
+	client *engine.Client
+	sel    Selector
+
+	since    time.Time
+	selected map[string]*state
+	ignored  map[string]bool
+}
+
+type state struct {
+	container engine.Container
+	running   bool
+}
+
+func NewWatcher(client *engine.Client, sel Selector) *Watcher {
+	return &Watcher{client: client, sel: sel, selected: map[string]*state{}, ignored: map[string]bool{}}
+}
+
+// List returns the selected containers that are running now. Follow picks up
+// from the moment List was called.
+func (w *Watcher) List(ctx context.Context) ([]engine.Container, error) {
+	// Events are replayed from before the list, so a container starting in
+	// between is not missed, and its start is dropped if the list had it
+	w.since = time.Now()
+	containers, err := w.client.Containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var running []engine.Container
+	for _, c := range containers {
+		if !w.sel.Match(c) {
+			w.ignored[c.ID] = true
+			continue
+		}
+		w.selected[c.ID] = &state{container: c, running: true}
+		running = append(running, c)
+	}
+	return running, nil
+}
+
+// Follow calls fn with every start, restart, stop, die and oom event of a
+// selected container after List until ctx is done.
+func (w *Watcher) Follow(ctx context.Context, fn func(Event)) error {
+	return w.client.StreamEvents(ctx, w.since, actions, func(e engine.Event) error {
+		id := e.Actor.ID
+		if w.ignored[id] || !wanted(e.Action) {
+			return nil
+		}
+
+		st, ok := w.selected[id]
+		if !ok {
+			c, err := w.client.Inspect(ctx, id)
+			if err != nil {
+				// Already removed, as with docker run --rm
+				c = fromAttributes(id, e.Actor.Attributes)
+			}
+			if !w.sel.Match(c) {
+				w.ignored[id] = true
+				return nil
+			}
+			st = &state{container: c}
+			w.selected[id] = st
+		}
+
+		switch e.Action {
+		case Start:
+			if st.running {
+				return nil
+			}
+			st.running = true
+		case Restart:
+			st.running = true
+		case Stop, Die:
+			if !st.running && e.Action == Die {
+				return nil
+			}
+			st.running = false
+		}
+		fn(Event{Time: e.Time(), Action: e.Action, Container: st.container})
+		return nil
+	})
+}
+
+// wanted guards against daemons that do not apply the event filter.
+func wanted(action string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// fromAttributes rebuilds a container from an event's attributes, which mix
+// its labels in with name and image.
+func fromAttributes(id string, attributes map[string]string) engine.Container {
+	c := engine.Container{ID: id, Labels: map[string]string{}}
+	for k, v := range attributes {
+		switch k {
+		case "name":
+			c.Names = []string{"/" + v}
+		case "image":
+			c.Image = v
+		default:
+			c.Labels[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,109 @@
+package discover_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/engine/enginetest"
+)
+
+type object = map[string]interface{}
+
+func event(action, id string, attributes object) object {
+	return object{"Type": "container", "Action": action, "Actor": object{"ID": id, "Attributes": attributes}, "timeNano": 1700000000e9}
+}
+
+// fakeEngine has exp-a running and selected and other running but not
+// selected, then streams the events of a run in which exp-b starts and stops,
+// exp-a restarts and exp-c starts and is removed before it can be inspected.
+func fakeEngine(t *testing.T) *engine.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]object{
+			{"Id": "a", "Names": []string{"/exp-a"}, "Image": "baseline:latest", "Labels": object{"experiment": "exp"}, "State": "running"},
+			{"Id": "other", "Names": []string{"/other"}, "Image": "nginx:latest", "State": "running"},
+		})
+	})
+	mux.HandleFunc("/containers/b/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(object{
+			"Id": "b", "Name": "/exp-b",
+			"Config": object{"Image": "bfs:latest", "Labels": object{"experiment": "exp"}},
+			"State":  object{"Status": "running"},
+		})
+	})
+	mux.HandleFunc("/containers/c/json", func(w http.ResponseWriter, r *http.Request) {
+		enginetest.Error(w, http.StatusNotFound, "No such container: c")
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		enginetest.Stream(w,
+			// Already running when listed
+			event("start", "a", object{"name": "exp-a", "experiment": "exp"}),
+			event("die", "other", object{"name": "other"}),
+			event("start", "b", object{"name": "exp-b", "experiment": "exp"}),
+			event("stop", "b", object{"name": "exp-b", "experiment": "exp"}),
+			// Already reported stopped
+			event("die", "b", object{"name": "exp-b", "experiment": "exp"}),
+			// Not followed even if the daemon sends it
+			event("pause", "a", object{"name": "exp-a", "experiment": "exp"}),
+			event("restart", "a", object{"name": "exp-a", "experiment": "exp"}),
+			event("start", "c", object{"name": "exp-c", "image": "superspreader:latest", "experiment": "exp"}),
+		)
+	})
+	return engine.New(enginetest.Serve(t, mux))
+}
+
+func TestWatcherFollowsSelectedContainers(t *testing.T) {
+	w := discover.NewWatcher(fakeEngine(t), discover.Selector{Labels: []string{"experiment=exp"}})
+
+	running, err := w.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 1 || running[0].Name() != "exp-a" {
+		t.Fatalf("listed %+v, want only exp-a", running)
+	}
+
+	var got []string
+	err = w.Follow(context.Background(), func(e discover.Event) {
+		got = append(got, e.Action+" "+e.Container.Name())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start exp-b", "stop exp-b", "restart exp-a", "start exp-c"}
+	if len(got) != len(want) {
+		t.Fatalf("got events %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	c := engine.Container{Names: []string{"/exp-bfs-1"}, Image: "registry:5000/bfs:v2", Labels: map[string]string{"experiment": "exp", "role": "analytic"}}
+	for _, tc := range []struct {
+		sel  discover.Selector
+		want bool
+	}{
+		{discover.Selector{}, true},
+		{discover.Selector{Names: []string{"exp-*"}}, true},
+		{discover.Selector{Names: []string{"other", "exp-bfs-?"}}, true},
+		{discover.Selector{Names: []string{"bfs"}}, false},
+		{discover.Selector{Images: []string{"registry:5000/bfs"}}, true},
+		{discover.Selector{Images: []string{"registry:5000/bfs:v2"}}, true},
+		{discover.Selector{Images: []string{"registry:5000/bfs:v1"}}, false},
+		{discover.Selector{Labels: []string{"experiment", "role=analytic"}}, true},
+		{discover.Selector{Labels: []string{"experiment", "role=sampler"}}, false},
+		{discover.Selector{Names: []string{"exp-*"}, Labels: []string{"missing"}}, false},
+	} {
+		if got := tc.sel.Match(c); got != tc.want {
+			t.Errorf("%+v matched %v, want %v", tc.sel, got, tc.want)
+		}
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
-	"bufio"
-	"encoding/csv"
+	"context"
+	"flag"
 	"fmt"
 	"os"
-	"os/exec"
+	"os/signal"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
+	"dockerstats/cgroup"
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/proc"
+	"dockerstats/sample"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -22,76 +28,124 @@ func main() {
 
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
-	if len(os.Args) != 2 {
-		log.Error().Msg("Usage: ./dockerstats <runLength>")
+	source := flag.String("source", "api", "where samples are read from: api, streaming stats from the Engine API, cgroup, reading each container's cgroup v2 files, cli, scraping docker stats, or proc, reading the /proc files of processes run without Docker")
+	interval := flag.Duration("interval", time.Second, "time between samples for the cgroup and cli sources, which can be under a second for cgroup; the api source follows the daemon's one second stream")
+	cgroupRoot := flag.String("cgroup.root", cgroup.DefaultRoot, "mount point of the cgroup v2 hierarchy")
+	socket := flag.String("engine.socket", engine.EnvSocket(), "unix socket of the Docker Engine API")
+	var sel discover.Selector
+	flag.Var((*listFlag)(&sel.Names), "name", "only sample containers whose name matches one of these glob patterns, comma separated or repeated")
+	flag.Var((*listFlag)(&sel.Images), "image", "only sample containers whose image, with or without its tag, matches one of these glob patterns")
+	flag.Var((*listFlag)(&sel.Labels), "label", "only sample containers with all of these key or key=value labels, such as experiment=klddos")
+	var pidList, processes listFlag
+	flag.Var(&pidList, "pid", "for the proc source, sample these processes and their children, comma separated or repeated")
+	flag.Var(&processes, "process", "for the proc source, sample processes whose name matches one of these glob patterns, and their children")
+	procRoot := flag.String("proc.root", proc.DefaultRoot, "mount point of procfs, read by the proc source, and by the cgroup source for network counters and host memory")
+	outPath := flag.String("out", "", "file the samples are written to, creating its directory, or an InfluxDB write URL such as http://localhost:8086/api/v2/write?org=lab&bucket=soak; defaults to docker_stats_<unix time> with the format's extension")
+	format := flag.String("format", "", "csv, jsonl, parquet or influx line protocol; defaults to what -out is named, or csv")
+	influxToken := flag.String("influx.token", os.Getenv("INFLUX_TOKEN"), "token sent to an InfluxDB 2 write URL, defaulting to INFLUX_TOKEN")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Error().Msg("Usage: ./dockerstats [-source api|cgroup|cli|proc] [-interval 1s] [-cgroup.root /sys/fs/cgroup] [-proc.root /proc] [-engine.socket /var/run/docker.sock] [-name pattern] [-image pattern] [-label key=value] [-pid pid] [-process pattern] [-out path|url] [-format csv|jsonl|parquet|influx] [-influx.token token] <runLength>, where runLength is a duration such as 90s or 2h, or a number of seconds")
 		os.Exit(1)
 	}
 
-	totalRunttime, err := strconv.Atoi(os.Args[1])
+	runLength, err := parseRunLength(flag.Arg(0))
 	if err != nil {
-		log.Error().Msg("Error: Invalid freq")
+		log.Error().Err(err).Msg("Error: Invalid runLength")
 		os.Exit(1)
 	}
 
-	headerWritten := false
-	beforeCMD := time.Now().Unix()
-	csvFile, err := os.Create(fmt.Sprintf("docker_stats_%v.csv", beforeCMD))
-	if err != nil {
-		log.Fatal()
+	switch *source {
+	case "api", "cgroup", "cli":
+	case "proc":
+		if len(pidList) == 0 && len(processes) == 0 {
+			log.Error().Msg("Error: The proc source needs -pid or -process")
+			os.Exit(1)
+		}
+	default:
+		log.Error().Str("source", *source).Msg("Error: Unknown source, use api, cgroup, cli or proc")
+		os.Exit(1)
+	}
+	pids := make([]int, len(pidList))
+	for i, p := range pidList {
+		if pids[i], err = strconv.Atoi(p); err != nil || pids[i] <= 0 {
+			log.Error().Str("pid", p).Msg("Error: Invalid pid")
+			os.Exit(1)
+		}
+	}
+	if *interval <= 0 {
+		log.Error().Msg("Error: interval must be positive")
+		os.Exit(1)
 	}
-	defer csvFile.Close()
-
-	csvWriter := csv.NewWriter(csvFile)
-	defer csvWriter.Flush()
-
-	for x := 0; x < totalRunttime; x++ {
-
-		beforeCMD = time.Now().Unix()
-		cmd := exec.Command("docker", "stats", "--no-stream", "--format", "{{.Container}},{{.Name}},{{.CPUPerc}},{{.MemUsage}},{{.NetIO}},{{.BlockIO}},{{.MemPerc}},{{.PIDs}}")
-		afterCMD := time.Now().Unix()
 
-		output, err := cmd.StdoutPipe()
+	switch {
+	case *format == "" && *outPath == "":
+		*format = sample.FormatCSV
+	case *format == "":
+		*format, err = sample.FormatOf(*outPath)
 		if err != nil {
-			log.Fatal()
+			log.Error().Err(err).Msg("Error: Unknown output format")
+			os.Exit(1)
 		}
+	}
+	if *outPath == "" {
+		*outPath = fmt.Sprintf("docker_stats_%v%s", time.Now().Unix(), sample.Extension(*format))
+	}
 
-		if err := cmd.Start(); err != nil {
-			log.Fatal()
-		}
+	out, err := sample.Open(*outPath, *format, sample.Options{InfluxToken: *influxToken})
+	if err != nil {
+		log.Error().Err(err).Str("out", *outPath).Str("format", *format).Msg("Error: Could not open the output")
+		os.Exit(1)
+	}
 
-		scanner := bufio.NewScanner(output)
-		for scanner.Scan() {
-			line := scanner.Text()
-			columns := strings.Split(line, ",")
-
-			columns = append(columns, strconv.FormatInt(beforeCMD, 10))
-			columns = append(columns, strconv.FormatInt(afterCMD, 10))
-
-			if !headerWritten {
-				header := []string{"Container", "Name", "CPU %", "Mem Usage", "Net I/O", "Block I/O", "Mem %", "PIDs"}
-				if err := csvWriter.Write(header); err != nil {
-					log.Fatal()
-				}
-				headerWritten = true
-			}
-
-			// Write the stats to the CSV file
-			fmt.Println(x)
-			fmt.Println(columns)
-
-			if err := csvWriter.Write(columns); err != nil {
-				log.Fatal()
-			}
-		}
+	client := engine.New(*socket)
+
+	// Sample for runLength, or until SIGINT or SIGTERM, keeping what was
+	// written either way
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, runLength)
+	defer cancel()
+
+	log.Info().Str("source", *source).Dur("runLength", runLength).Dur("interval", *interval).Strs("name", sel.Names).Strs("image", sel.Images).Strs("label", sel.Labels).Ints("pid", pids).Strs("process", processes).Str("out", *outPath).Str("format", *format).Msg("Sampling")
+
+	switch *source {
+	case "api":
+		err = sampleAPI(ctx, client, sel, out)
+	case "cgroup":
+		err = sampleCgroups(ctx, client, sel, *cgroupRoot, *procRoot, *interval, out)
+	case "cli":
+		err = sampleCLI(ctx, client, sel, *interval, out)
+	case "proc":
+		err = sampleProcs(ctx, *procRoot, pids, processes, *interval, out)
+	}
+	if err != nil {
+		// Keep what was sampled before the failure
+		out.Close()
+		log.Error().Err(err).Str("source", *source).Msg("Error: Sampling failed")
+		os.Exit(1)
+	}
+	if err := out.Close(); err != nil {
+		log.Error().Err(err).Str("out", *outPath).Msg("Error: Could not finish writing the samples")
+		os.Exit(1)
+	}
 
-		if err := scanner.Err(); err != nil {
-			log.Fatal()
-		}
+	log.Info().Str("out", *outPath).Str("format", *format).Int("schema", sample.Version).Msg("Docker stats have been written")
+}
 
-		if err := cmd.Wait(); err != nil {
-			log.Fatal()
-		}
+// parseRunLength reads a duration such as 90s or 2h, or a bare number of
+// seconds.
+func parseRunLength(s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		s = strconv.Itoa(seconds) + "s"
 	}
-
-	fmt.Println("Docker stats have been written to the CSV file.")
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("runLength must be positive, got %s", d)
+	}
+	return d, nil
 }
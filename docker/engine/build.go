@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Build builds the image tag from the Dockerfile at dockerfile, relative to
+// the context directory dir, writing the build's output to progress. The
+// context is sent without the files its .dockerignore excludes, as docker
+// build sends it.
+func (c *Client) Build(ctx context.Context, dir, dockerfile, tag string, progress io.Writer) error {
+	ignore, err := readIgnore(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, dockerfile)); err != nil {
+		return fmt.Errorf("build %s: %v", tag, err)
+	}
+	// The Dockerfile and .dockerignore are always sent, as docker build
+	// sends them even when they are excluded
+	keep := map[string]bool{filepath.ToSlash(filepath.Clean(dockerfile)): true, ".dockerignore": true}
+
+	body, w := io.Pipe()
+	go func() {
+		w.CloseWithError(writeContext(w, dir, ignore, keep))
+	}()
+	defer body.Close()
+
+	query := url.Values{"t": {tag}, "dockerfile": {filepath.ToSlash(dockerfile)}, "rm": {"true"}}
+	resp, err := c.do(ctx, http.MethodPost, "/build", query, "application/x-tar", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The build's output is a stream of messages, the last of which carries
+	// the error if the build failed
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Stream string `json:"stream"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("build %s: %v", tag, err)
+		}
+		if message.Error != "" {
+			return fmt.Errorf("build %s: %s", tag, strings.TrimSpace(message.Error))
+		}
+		if message.Status != "" {
+			message.Stream = message.Status + "\n"
+		}
+		io.WriteString(progress, message.Stream)
+	}
+}
+
+// ignorePattern is one line of a .dockerignore, a glob matched against a path
+// relative to the context and each of its parent directories. A pattern
+// starting with ! includes again what an earlier one excluded. The **
+// wildcard is not supported.
+type ignorePattern struct {
+	glob    string
+	exclude bool
+}
+
+func readIgnore(file string) ([]ignorePattern, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []ignorePattern
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{exclude: true}
+		if strings.HasPrefix(line, "!") {
+			p.exclude = false
+			line = strings.TrimSpace(line[1:])
+		}
+		p.glob = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(line)), "/")
+		if _, err := path.Match(p.glob, ""); err != nil {
+			return nil, fmt.Errorf("%s: bad pattern %q", file, line)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// ignored reports whether the slash separated path rel is excluded: the last
+// pattern matching it decides.
+func ignored(patterns []ignorePattern, rel string) bool {
+	excluded := false
+	for _, p := range patterns {
+		for prefix := rel; prefix != "."; prefix = path.Dir(prefix) {
+			if ok, _ := path.Match(p.glob, prefix); ok {
+				excluded = p.exclude
+				break
+			}
+		}
+	}
+	return excluded
+}
+
+// reincludes reports whether a pattern includes again something under the
+// excluded directory rel, which then has to be walked.
+func reincludes(patterns []ignorePattern, rel string) bool {
+	for _, p := range patterns {
+		if !p.exclude && strings.HasPrefix(p.glob, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeContext writes the files under dir that are not ignored, and those in
+// keep, to w as a tar archive.
+func writeContext(w io.Writer, dir string, ignore []ignorePattern, keep map[string]bool) error {
+	archive := tar.NewWriter(w)
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignored(ignore, rel) && !keep[rel] {
+			if d.IsDir() && !reincludes(ignore, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(archive, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ContainerConfig is what a container is created with. Cmd is appended to
+// the image's entrypoint, replacing the image's own command.
+type ContainerConfig struct {
+	Image  string            `json:"Image"`
+	Cmd    []string          `json:"Cmd,omitempty"`
+	Labels map[string]string `json:"Labels,omitempty"`
+}
+
+// Create makes a container called name, without starting it, and returns its
+// id.
+func (c *Client) Create(ctx context.Context, name string, cfg ContainerConfig) (string, error) {
+	body, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(ctx, http.MethodPost, "/containers/create", url.Values{"name": {name}}, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("create %s: %v", name, err)
+	}
+	return created.ID, nil
+}
+
+// Start starts container id. Starting a running container is not an error.
+func (c *Client) Start(ctx context.Context, id string) error {
+	return c.post(ctx, "/containers/"+id+"/start", nil)
+}
+
+// Stop asks container id to exit, killing it if it has not after timeout.
+// Stopping a stopped container is not an error.
+func (c *Client) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	return c.post(ctx, "/containers/"+id+"/stop", url.Values{"t": {strconv.Itoa(int(timeout.Seconds()))}})
+}
+
+// Wait blocks until container id exits and returns its exit code.
+func (c *Client) Wait(ctx context.Context, id string) (int, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, "", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("wait %s: %v", id, err)
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result.StatusCode, fmt.Errorf("wait %s: %s", id, result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// Remove deletes container id, killing it first if it is still running.
+func (c *Client) Remove(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/containers/"+id, url.Values{"force": {"true"}, "v": {"true"}}, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, path string, query url.Values) error {
+	resp, err := c.do(ctx, http.MethodPost, path, query, "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Logs copies everything container id has written to its stdout and stderr
+// so far to w, as docker logs does.
+func (c *Client) Logs(ctx context.Context, id string, w io.Writer) error {
+	resp, err := c.get(ctx, "/containers/"+id+"/logs", url.Values{"stdout": {"true"}, "stderr": {"true"}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := demultiplex(w, resp.Body); err != nil {
+		return fmt.Errorf("logs of %s: %v", id, err)
+	}
+	return nil
+}
+
+// demultiplex copies the frames of a container's output stream to w. A
+// container without a TTY has its output framed with an 8 byte header of the
+// stream, 1 for stdout and 2 for stderr, and the frame's size; with a TTY the
+// output is sent as it is.
+func demultiplex(w io.Writer, r io.Reader) error {
+	buffered := bufio.NewReader(r)
+	first, err := buffered.Peek(1)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if first[0] > 2 {
+		_, err := io.Copy(w, buffered)
+		return err
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(buffered, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, buffered, size); err != nil {
+			return err
+		}
+	}
+}
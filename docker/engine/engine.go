@@ -0,0 +1,347 @@
+// Package engine is a small client for the Docker Engine API over its unix
+// socket, covering what dockerstats needs, listing containers and streaming
+// their stats, and what the orchestrator needs to build images and run
+// containers.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where dockerd listens by default.
+const DefaultSocket = "/var/run/docker.sock"
+
+// APIVersion is the Engine API version requested, supported by Docker 20.10
+// and later.
+const APIVersion = "1.41"
+
+// Client talks to one Docker daemon.
+type Client struct {
+	http *http.Client
+}
+
+// New returns a client for the daemon listening on the unix socket path.
+func New(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}}
+}
+
+// EnvSocket is the socket named by DOCKER_HOST, when it is a unix one, or
+// dockerd's default.
+func EnvSocket() string {
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		return strings.TrimPrefix(host, "unix://")
+	}
+	return DefaultSocket
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, query, "", nil)
+}
+
+// do sends a request with an optional body of the content type. Responses
+// other than 2xx and 304 Not Modified, which the daemon answers starting a
+// started container or stopping a stopped one with, are returned as errors
+// carrying the daemon's message.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := "http://docker/v" + APIVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		var body struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) != nil || body.Message == "" {
+			body.Message = resp.Status
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, body.Message)
+	}
+	return resp, nil
+}
+
+// Container is an entry of the container list.
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+	State  string            `json:"State"`
+}
+
+// Name is the container's primary name without the leading slash.
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// Containers lists the running containers.
+func (c *Client) Containers(ctx context.Context) ([]Container, error) {
+	resp, err := c.get(ctx, "/containers/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []Container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("container list: %v", err)
+	}
+	return containers, nil
+}
+
+// Stats is one reading of /containers/{id}/stats. Only the fields dockerstats
+// uses are decoded.
+type Stats struct {
+	Read     time.Time          `json:"read"`
+	PreRead  time.Time          `json:"preread"`
+	ID       string             `json:"id"`
+	Name     string             `json:"name"`
+	CPU      CPUStats           `json:"cpu_stats"`
+	PreCPU   CPUStats           `json:"precpu_stats"`
+	Memory   Memory             `json:"memory_stats"`
+	Networks map[string]Network `json:"networks"`
+	BlkIO    struct {
+		ServiceBytes []BlkIOEntry `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	Pids struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+// CPUStats are cumulative CPU times in nanoseconds.
+type CPUStats struct {
+	Usage struct {
+		Total  uint64   `json:"total_usage"`
+		PerCPU []uint64 `json:"percpu_usage"`
+		Kernel uint64   `json:"usage_in_kernelmode"`
+		User   uint64   `json:"usage_in_usermode"`
+	} `json:"cpu_usage"`
+	System     uint64 `json:"system_cpu_usage"`
+	OnlineCPUs int    `json:"online_cpus"`
+	Throttling struct {
+		Periods          uint64 `json:"periods"`
+		ThrottledPeriods uint64 `json:"throttled_periods"`
+		ThrottledTime    uint64 `json:"throttled_time"`
+	} `json:"throttling_data"`
+}
+
+// Network is the traffic of one interface in bytes.
+type Network struct {
+	RxBytes uint64 `json:"rx_bytes"`
+	TxBytes uint64 `json:"tx_bytes"`
+}
+
+// BlkIOEntry is one device's count for one operation.
+type BlkIOEntry struct {
+	Major uint64 `json:"major"`
+	Minor uint64 `json:"minor"`
+	Op    string `json:"op"`
+	Value uint64 `json:"value"`
+}
+
+// Memory is the container's memory use in bytes.
+type Memory struct {
+	Usage uint64            `json:"usage"`
+	Limit uint64            `json:"limit"`
+	Stats map[string]uint64 `json:"stats"`
+}
+
+// CPUPercent is the container's CPU use between the previous reading and
+// this one, from the raw deltas, where 100% is one whole CPU as in docker
+// stats.
+func (s Stats) CPUPercent() float64 {
+	cpuDelta := float64(s.CPU.Usage.Total) - float64(s.PreCPU.Usage.Total)
+	systemDelta := float64(s.CPU.System) - float64(s.PreCPU.System)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := s.CPU.OnlineCPUs
+	if cpus == 0 {
+		cpus = len(s.CPU.Usage.PerCPU)
+	}
+	return cpuDelta / systemDelta * float64(cpus) * 100
+}
+
+// MemoryUsed is the memory in use less the reclaimable page cache, matching
+// the usage docker stats shows for cgroup v1 and v2.
+func (s Stats) MemoryUsed() uint64 {
+	cache, ok := s.Memory.Stats["inactive_file"]
+	if !ok {
+		cache = s.Memory.Stats["total_inactive_file"]
+	}
+	if cache > s.Memory.Usage {
+		return 0
+	}
+	return s.Memory.Usage - cache
+}
+
+// NetIO sums the bytes received and sent over every interface.
+func (s Stats) NetIO() (rx, tx uint64) {
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	return rx, tx
+}
+
+// BlockIO sums the bytes read and written over every device.
+func (s Stats) BlockIO() (read, write uint64) {
+	for _, e := range s.BlkIO.ServiceBytes {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+	return read, write
+}
+
+// ErrStop can be returned by a StreamStats callback to end the stream
+// without an error.
+var ErrStop = errors.New("stop streaming")
+
+// StreamStats follows the stats of container id, which the daemon sends about
+// once a second, calling fn with each reading until the stream ends, ctx is
+// cancelled or fn returns an error.
+func (c *Client) StreamStats(ctx context.Context, id string, fn func(Stats) error) error {
+	resp, err := c.get(ctx, "/containers/"+id+"/stats", url.Values{"stream": {"true"}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var s Stats
+		if err := decoder.Decode(&s); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("stats of %s: %v", id, err)
+		}
+		if err := fn(s); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Inspect returns the current details of container id.
+func (c *Client) Inspect(ctx context.Context, id string) (Container, error) {
+	resp, err := c.get(ctx, "/containers/"+id+"/json", nil)
+	if err != nil {
+		return Container{}, err
+	}
+	defer resp.Body.Close()
+
+	var details struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image  string            `json:"Image"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+		State struct {
+			Status string `json:"Status"`
+		} `json:"State"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return Container{}, fmt.Errorf("inspect %s: %v", id, err)
+	}
+	return Container{
+		ID:     details.ID,
+		Names:  []string{details.Name},
+		Image:  details.Config.Image,
+		Labels: details.Config.Labels,
+		State:  details.State.Status,
+	}, nil
+}
+
+// Event is a message from /events. For container events Actor.ID is the
+// container and Actor.Attributes hold its name, image and labels.
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// Time is when the daemon raised the event.
+func (e Event) Time() time.Time {
+	return time.Unix(0, e.TimeNano)
+}
+
+// StreamEvents follows the container events with the given actions raised
+// from since on, calling fn with each until ctx is cancelled or fn returns an
+// error, as StreamStats does.
+func (c *Client) StreamEvents(ctx context.Context, since time.Time, actions []string, fn func(Event) error) error {
+	filters, err := json.Marshal(map[string][]string{"type": {"container"}, "event": actions})
+	if err != nil {
+		return err
+	}
+	query := url.Values{
+		"since":   {fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond())},
+		"filters": {string(filters)},
+	}
+
+	resp, err := c.get(ctx, "/events", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var e Event
+		if err := decoder.Decode(&e); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("events: %v", err)
+		}
+		if err := fn(e); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+}
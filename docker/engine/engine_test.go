@@ -0,0 +1,158 @@
+package engine_test
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"dockerstats/engine"
+	"dockerstats/engine/enginetest"
+)
+
+type object = map[string]interface{}
+
+// stats is a stats reading with the given cumulative CPU times in
+// nanoseconds, the current ones and those of the reading before.
+func stats(total, system, preTotal, preSystem uint64, online, perCPU int) object {
+	cpu := func(total, system uint64) object {
+		return object{
+			"cpu_usage":        object{"total_usage": total, "percpu_usage": make([]uint64, perCPU)},
+			"system_cpu_usage": system,
+			"online_cpus":      online,
+		}
+	}
+	return object{
+		"read":         time.Unix(1700000000, 0).UTC(),
+		"cpu_stats":    cpu(total, system),
+		"precpu_stats": cpu(preTotal, preSystem),
+		"memory_stats": object{"usage": 300 << 20, "limit": 1 << 30, "stats": object{"inactive_file": 100 << 20}},
+		"networks":     object{"eth0": object{"rx_bytes": 1000, "tx_bytes": 200}, "eth1": object{"rx_bytes": 24, "tx_bytes": 6}},
+		"blkio_stats": object{"io_service_bytes_recursive": []object{
+			{"major": 8, "minor": 0, "op": "Read", "value": 4096},
+			{"major": 8, "minor": 0, "op": "Write", "value": 512},
+			{"major": 8, "minor": 16, "op": "read", "value": 4096},
+		}},
+	}
+}
+
+func TestStreamStatsCPUPercent(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/abc/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stream") != "true" {
+			enginetest.Error(w, http.StatusBadRequest, "want a stream")
+			return
+		}
+		enginetest.Stream(w,
+			// Half a second of CPU in 2s of system time across 4 CPUs
+			stats(1500e6, 102e9, 1000e6, 100e9, 4, 0),
+			// A quarter second in 1s, counting CPUs from the per-CPU usage
+			stats(1750e6, 103e9, 1500e6, 102e9, 0, 2),
+			// The container restarted and its usage went back
+			stats(10e6, 104e9, 1750e6, 103e9, 4, 0),
+		)
+	})
+	client := engine.New(enginetest.Serve(t, mux))
+
+	var readings []engine.Stats
+	err := client.StreamStats(context.Background(), "abc", func(s engine.Stats) error {
+		readings = append(readings, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 3 {
+		t.Fatalf("got %d readings, want 3", len(readings))
+	}
+	for i, want := range []float64{100, 50, 0} {
+		if got := readings[i].CPUPercent(); math.Abs(got-want) > 1e-9 {
+			t.Errorf("reading %d: CPU %.3f%%, want %.0f%%", i+1, got, want)
+		}
+	}
+
+	s := readings[0]
+	if used := s.MemoryUsed(); used != 200<<20 {
+		t.Errorf("memory used %d, want usage less the inactive page cache", used)
+	}
+	if rx, tx := s.NetIO(); rx != 1024 || tx != 206 {
+		t.Errorf("network rx %d tx %d, want both interfaces summed", rx, tx)
+	}
+	if read, write := s.BlockIO(); read != 8192 || write != 512 {
+		t.Errorf("block read %d write %d, want both devices summed whatever the case of op", read, write)
+	}
+
+	// Returning ErrStop ends the stream early without an error
+	count := 0
+	err = client.StreamStats(context.Background(), "abc", func(engine.Stats) error {
+		count++
+		return engine.ErrStop
+	})
+	if err != nil || count != 1 {
+		t.Errorf("stopping after the first reading read %d and returned %v", count, err)
+	}
+}
+
+func TestErrorsCarryTheDaemonsMessage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]object{
+			{"Id": "abc", "Names": []string{"/exp-baseline"}, "Image": "baseline:latest", "Labels": object{"experiment": "exp"}, "State": "running"},
+		})
+	})
+	mux.HandleFunc("/containers/gone/json", func(w http.ResponseWriter, r *http.Request) {
+		enginetest.Error(w, http.StatusNotFound, "No such container: gone")
+	})
+	client := engine.New(enginetest.Serve(t, mux))
+
+	containers, err := client.Containers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].Name() != "exp-baseline" || containers[0].Labels["experiment"] != "exp" {
+		t.Errorf("got containers %+v", containers)
+	}
+
+	if _, err := client.Inspect(context.Background(), "gone"); err == nil || !strings.Contains(err.Error(), "No such container: gone") {
+		t.Errorf("inspecting a removed container returned %v", err)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	since := time.Unix(1700000000, 250000000)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil {
+			enginetest.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if r.URL.Query().Get("since") != "1700000000.250000000" || strings.Join(filters["type"], ",") != "container" || strings.Join(filters["event"], ",") != "start,die" {
+			enginetest.Error(w, http.StatusBadRequest, "unexpected query "+r.URL.RawQuery)
+			return
+		}
+		enginetest.Stream(w,
+			object{"Type": "container", "Action": "start", "Actor": object{"ID": "abc", "Attributes": object{"name": "exp-baseline"}}, "timeNano": since.UnixNano() + 1},
+			object{"Type": "container", "Action": "die", "Actor": object{"ID": "abc"}, "timeNano": since.UnixNano() + 2},
+		)
+	})
+	client := engine.New(enginetest.Serve(t, mux))
+
+	var events []engine.Event
+	err := client.StreamEvents(context.Background(), since, []string{"start", "die"}, func(e engine.Event) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Action != "start" || events[0].Actor.Attributes["name"] != "exp-baseline" || events[1].Action != "die" {
+		t.Fatalf("got events %+v", events)
+	}
+	if !events[1].Time().Equal(time.Unix(0, since.UnixNano()+2)) {
+		t.Errorf("event time %v, want %v", events[1].Time(), time.Unix(0, since.UnixNano()+2))
+	}
+}
@@ -0,0 +1,51 @@
+// Package enginetest serves a fake Docker Engine API on a temporary unix
+// socket, for testing what talks to dockerd without one.
+package enginetest
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"dockerstats/engine"
+)
+
+// Serve serves h on a unix socket in a temporary directory until the test
+// ends, and returns the socket's path. h sees paths without the API version,
+// such as /containers/json.
+func Serve(t testing.TB, h http.Handler) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.StripPrefix("/v"+engine.APIVersion, h)}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return socket
+}
+
+// Stream writes each value as a JSON message and flushes it, as the daemon
+// streams stats and events, then ends the stream.
+func Stream(w http.ResponseWriter, values ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	for _, v := range values {
+		if encoder.Encode(v) != nil {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// Error answers as the daemon does when a request fails.
+func Error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
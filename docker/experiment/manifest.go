@@ -0,0 +1,333 @@
+// Package experiment runs the analytics in containers across the grid an
+// experiment manifest describes, sampling their resources with dockerstats
+// and collecting their logs into a results directory.
+package experiment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that reads as "5s", or a bare number of
+// seconds, as the runner's flags do.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	if seconds, err := strconv.Atoi(string(text)); err == nil {
+		*d = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Manifest describes an experiment: every analytic is run at every network
+// size and frequency for Duration, Repetitions times over. Nodes and Edges
+// are paired off unless Cross is set, when every node count is run with
+// every edge count, and a single edge count is used with every node count,
+// as in the sweep command's settings.
+type Manifest struct {
+	Name        string     `yaml:"name" json:"name"`
+	Analytics   []string   `yaml:"analytics" json:"analytics"`
+	Nodes       []int      `yaml:"nodes" json:"nodes"`
+	Edges       []int      `yaml:"edges" json:"edges"`
+	Cross       bool       `yaml:"cross" json:"cross"`
+	Freqs       []Duration `yaml:"freqs" json:"freqs"`
+	Duration    Duration   `yaml:"duration" json:"duration"`
+	Repetitions int        `yaml:"repetitions" json:"repetitions"`
+	// Seed is passed to the first repetition and counted up for the next,
+	// so repetitions differ but can be run again. 0 lets each pick its own.
+	Seed int64 `yaml:"seed" json:"seed"`
+	// Together runs the analytics of a point side by side in one run,
+	// rather than one after another
+	Together bool `yaml:"together" json:"together"`
+	// Args are extra runner flags by analytic, with those under "all" given
+	// to every analytic
+	Args map[string][]string `yaml:"args" json:"args"`
+	// Grace is how long past Duration a container is given to finish
+	// before it is stopped
+	Grace Duration `yaml:"grace" json:"grace"`
+
+	Build   Build   `yaml:"build" json:"build"`
+	Sampler Sampler `yaml:"sampler" json:"sampler"`
+	// Results is the directory each experiment's results directory is made
+	// in
+	Results string `yaml:"results" json:"results"`
+}
+
+// Build says where the images come from. Dockerfile and Image are patterns
+// in which {analytic} is replaced by the analytic's name.
+type Build struct {
+	// Context is the build context directory
+	Context    string `yaml:"context" json:"context"`
+	Dockerfile string `yaml:"dockerfile" json:"dockerfile"`
+	Image      string `yaml:"image" json:"image"`
+}
+
+// Sampler is how dockerstats samples each run.
+type Sampler struct {
+	// Format is the samples' file format, csv, jsonl or parquet
+	Format string `yaml:"format" json:"format"`
+	// Args are extra dockerstats flags, such as -source cgroup
+	Args []string `yaml:"args" json:"args"`
+	// Warmup is how long each runner waits before its first run, so that
+	// dockerstats has found the container and taken its first sample by
+	// then and every run is covered by samples
+	Warmup Duration `yaml:"warmup" json:"warmup"`
+}
+
+// Load reads a YAML or JSON manifest, fills in the defaults and checks it.
+// Relative paths in it are taken from the manifest's directory.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(m)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(m)
+	default:
+		return nil, fmt.Errorf("manifest %s: unknown format, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", path, err)
+	}
+
+	if m.Name == "" {
+		m.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if m.Repetitions == 0 {
+		m.Repetitions = 1
+	}
+	if m.Grace == 0 {
+		m.Grace = Duration(time.Minute)
+	}
+	if m.Build.Context == "" {
+		m.Build.Context = "."
+	}
+	if m.Build.Dockerfile == "" {
+		m.Build.Dockerfile = "Dockerfile.{analytic}"
+	}
+	if m.Build.Image == "" {
+		m.Build.Image = "{analytic}"
+	}
+	if m.Sampler.Format == "" {
+		m.Sampler.Format = "csv"
+	}
+	if m.Sampler.Warmup == 0 {
+		m.Sampler.Warmup = Duration(5 * time.Second)
+	}
+	if m.Results == "" {
+		m.Results = "results"
+	}
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&m.Build.Context, &m.Results} {
+		if !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// names are what Docker accepts in a container name.
+var names = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Validate checks every setting is in range.
+func (m *Manifest) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(names.MatchString(m.Name), "name %q must be letters, digits, _, . and -", m.Name)
+	check(len(m.Analytics) > 0, "analytics must name at least one analytic")
+	for _, a := range m.Analytics {
+		check(names.MatchString(a), "analytic %q must be letters, digits, _, . and -", a)
+	}
+	check(len(m.Nodes) > 0, "nodes must have at least one node count")
+	check(len(m.Edges) > 0, "edges must have at least one edge count")
+	check(m.Cross || len(m.Edges) <= 1 || len(m.Edges) == len(m.Nodes), "nodes has %d values and edges %d, they must match unless cross is set", len(m.Nodes), len(m.Edges))
+	for _, n := range m.Nodes {
+		check(n > 0, "node counts must be positive")
+	}
+	for _, e := range m.Edges {
+		check(e > 0, "edge counts must be positive")
+	}
+	check(len(m.Freqs) > 0, "freqs must have at least one frequency")
+	for _, f := range m.Freqs {
+		check(f > 0, "frequencies must be positive")
+	}
+	check(m.Duration > 0, "duration must be positive")
+	check(m.Repetitions > 0, "repetitions must be positive")
+	check(m.Grace > 0, "grace must be positive")
+	check(m.Sampler.Warmup >= 0, "sampler warmup must not be negative")
+	for analytic := range m.Args {
+		known := analytic == "all"
+		for _, a := range m.Analytics {
+			known = known || a == analytic
+		}
+		check(known, "args are given for %q, which is not one of the analytics", analytic)
+	}
+	switch m.Sampler.Format {
+	case "csv", "jsonl", "parquet":
+	default:
+		check(false, "sampler format %q must be csv, jsonl or parquet", m.Sampler.Format)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Container is one analytic of a run.
+type Container struct {
+	// Name is the container's name, which its log is named after
+	Name     string
+	Analytic string
+	Image    string
+	Args     []string
+}
+
+// Run is a set of containers started together at one point of the grid,
+// sampled by one dockerstats into one directory.
+type Run struct {
+	// ID names the run's directory and labels its containers
+	ID         string
+	Nodes      int
+	Edges      int
+	Freq       time.Duration
+	Repetition int
+	Seed       int64
+	Containers []Container
+}
+
+// Runs expands the manifest into every run, repetition by repetition, each
+// in ladder order.
+func (m *Manifest) Runs() []Run {
+	type size struct{ nodes, edges int }
+	var sizes []size
+	switch {
+	case m.Cross:
+		for _, n := range m.Nodes {
+			for _, e := range m.Edges {
+				sizes = append(sizes, size{n, e})
+			}
+		}
+	case len(m.Edges) == 1:
+		for _, n := range m.Nodes {
+			sizes = append(sizes, size{n, m.Edges[0]})
+		}
+	default:
+		for i := range m.Nodes {
+			sizes = append(sizes, size{m.Nodes[i], m.Edges[i]})
+		}
+	}
+
+	groups := [][]string{m.Analytics}
+	if !m.Together {
+		groups = nil
+		for _, a := range m.Analytics {
+			groups = append(groups, []string{a})
+		}
+	}
+
+	var runs []Run
+	for rep := 1; rep <= m.Repetitions; rep++ {
+		seed := int64(0)
+		if m.Seed != 0 {
+			seed = m.Seed + int64(rep-1)
+		}
+		for _, group := range groups {
+			for _, sz := range sizes {
+				for _, f := range m.Freqs {
+					point := fmt.Sprintf("n%d-m%d-f%s-r%d", sz.nodes, sz.edges, time.Duration(f), rep)
+					run := Run{
+						ID:         point,
+						Nodes:      sz.nodes,
+						Edges:      sz.edges,
+						Freq:       time.Duration(f),
+						Repetition: rep,
+						Seed:       seed,
+					}
+					if !m.Together {
+						run.ID = group[0] + "-" + point
+					}
+					for _, a := range group {
+						run.Containers = append(run.Containers, m.container(a, run, point))
+					}
+					runs = append(runs, run)
+				}
+			}
+		}
+	}
+	return runs
+}
+
+// container names the analytic's container after the experiment, analytic
+// and point, and gives the runner the point's settings followed by the
+// manifest's own flags, which can override them.
+func (m *Manifest) container(analytic string, run Run, point string) Container {
+	name := m.Name + "-" + analytic + "-" + point
+	args := []string{
+		"-nodes", strconv.Itoa(run.Nodes),
+		"-edges", strconv.Itoa(run.Edges),
+		"-freq", run.Freq.String(),
+		"-duration", time.Duration(m.Duration).String(),
+		"-run-id", name,
+	}
+	if m.Sampler.Warmup > 0 {
+		args = append(args, "-warmup", time.Duration(m.Sampler.Warmup).String())
+	}
+	if run.Seed != 0 {
+		args = append(args, "-seed", strconv.FormatInt(run.Seed, 10))
+	}
+	args = append(args, m.Args["all"]...)
+	args = append(args, m.Args[analytic]...)
+	return Container{Name: name, Analytic: analytic, Image: m.Image(analytic), Args: args}
+}
+
+// Image is the image the analytic runs in.
+func (m *Manifest) Image(analytic string) string {
+	return strings.ReplaceAll(m.Build.Image, "{analytic}", analytic)
+}
+
+// Dockerfile is the analytic's Dockerfile in the build context.
+func (m *Manifest) Dockerfile(analytic string) string {
+	return strings.ReplaceAll(m.Build.Dockerfile, "{analytic}", analytic)
+}
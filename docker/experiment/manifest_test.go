@@ -0,0 +1,87 @@
+package experiment
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuns(t *testing.T) {
+	m := &Manifest{
+		Name:        "exp",
+		Analytics:   []string{"bfs", "klddos"},
+		Nodes:       []int{100, 1000},
+		Edges:       []int{500},
+		Freqs:       []Duration{Duration(time.Second), Duration(5 * time.Second)},
+		Duration:    Duration(time.Minute),
+		Repetitions: 2,
+		Seed:        888,
+		Args:        map[string][]string{"all": {"-schedule", "fixed-delay"}, "klddos": {"-klddos.bins", "20"}},
+		Build:       Build{Image: "lab/{analytic}"},
+		Sampler:     Sampler{Warmup: Duration(5 * time.Second)},
+	}
+
+	runs := m.Runs()
+	if len(runs) != 2*2*2*2 {
+		t.Fatalf("got %d runs, want one per analytic, size, frequency and repetition", len(runs))
+	}
+	first, last := runs[0], runs[len(runs)-1]
+	if first.ID != "bfs-n100-m500-f1s-r1" || first.Seed != 888 || len(first.Containers) != 1 {
+		t.Errorf("first run is %+v", first)
+	}
+	if last.ID != "klddos-n1000-m500-f5s-r2" || last.Seed != 889 || last.Repetition != 2 {
+		t.Errorf("last run is %+v", last)
+	}
+
+	c := last.Containers[0]
+	if c.Name != "exp-klddos-n1000-m500-f5s-r2" || c.Image != "lab/klddos" {
+		t.Errorf("last container is %+v", c)
+	}
+	want := "-nodes 1000 -edges 500 -freq 5s -duration 1m0s -run-id exp-klddos-n1000-m500-f5s-r2 -warmup 5s -seed 889 -schedule fixed-delay -klddos.bins 20"
+	if got := strings.Join(c.Args, " "); got != want {
+		t.Errorf("runner arguments\n got %s\nwant %s", got, want)
+	}
+
+	// Together puts the analytics of a point in one run, and Cross runs
+	// every node count with every edge count
+	m.Together, m.Cross, m.Edges, m.Repetitions = true, true, []int{500, 5000}, 1
+	runs = m.Runs()
+	if len(runs) != 2*2*2 {
+		t.Fatalf("got %d runs together and crossed, want 8", len(runs))
+	}
+	if runs[1].ID != "n100-m500-f5s-r1" || runs[2].Edges != 5000 || len(runs[0].Containers) != 2 {
+		t.Errorf("runs together and crossed start %+v", runs[:3])
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ladder.yaml")
+	manifest := "analytics: [baseline]\nnodes: [1083]\nedges: [59725]\nfreqs: [1s]\nduration: 300\n"
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "ladder" || m.Duration != Duration(5*time.Minute) || m.Repetitions != 1 || m.Sampler.Format != "csv" {
+		t.Errorf("loaded %+v", m)
+	}
+	if m.Sampler.Warmup <= 0 || m.Grace <= 0 {
+		t.Errorf("warmup %s and grace %s, want defaults", m.Sampler.Warmup, m.Grace)
+	}
+	if m.Results != filepath.Join(dir, "results") {
+		t.Errorf("results %s, want it next to the manifest", m.Results)
+	}
+
+	if err := os.WriteFile(path, []byte(manifest+"colour: blue\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("a manifest with an unknown setting loaded")
+	}
+}
@@ -0,0 +1,310 @@
+package experiment
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"dockerstats/engine"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Runtime is what the orchestrator needs of a container runtime. The
+// engine.Client speaks it to dockerd, or to fakeengine standing in for it.
+type Runtime interface {
+	Build(ctx context.Context, dir, dockerfile, tag string, progress io.Writer) error
+	Create(ctx context.Context, name string, cfg engine.ContainerConfig) (string, error)
+	Start(ctx context.Context, id string) error
+	Wait(ctx context.Context, id string) (int, error)
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+	Logs(ctx context.Context, id string, w io.Writer) error
+	Remove(ctx context.Context, id string) error
+}
+
+// Container states recorded in the results.
+const (
+	// Exited is a container that finished by itself
+	Exited = "exited"
+	// Stopped is a container still running Grace after its warm-up and
+	// Duration
+	Stopped = "stopped"
+	// Cancelled is a container stopped because the experiment was
+	Cancelled = "cancelled"
+	// Failed is a container that could not be created, started or waited
+	// for
+	Failed = "failed"
+)
+
+// stopTimeout is how long a stopped container has to exit before it is
+// killed, and teardown is how long each step of cleaning up a run may take,
+// whether or not the experiment was cancelled.
+const (
+	stopTimeout = 10 * time.Second
+	teardown    = time.Minute
+)
+
+// Result is what became of one container of a run.
+type Result struct {
+	Run       Run
+	Container Container
+	Started   time.Time
+	Finished  time.Time
+	ExitCode  int
+	Status    string
+	Err       error
+	// Log and Samples are the files the container's output and the run's
+	// samples were written to, empty when there are none
+	Log     string
+	Samples string
+}
+
+// Orchestrator runs an experiment's runs one after another on a runtime,
+// each into its own directory under Dir.
+type Orchestrator struct {
+	Manifest *Manifest
+	Runtime  Runtime
+	// Sampler is the dockerstats binary, run against Socket, the engine
+	// socket of the runtime. Runs are not sampled when it is empty.
+	Sampler string
+	Socket  string
+	Dir     string
+}
+
+// Build builds the image of every analytic, writing the builds' output to
+// build.log.
+func (o *Orchestrator) Build(ctx context.Context) error {
+	out, err := os.Create(filepath.Join(o.Dir, "build.log"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	m := o.Manifest
+	for _, a := range m.Analytics {
+		image, dockerfile := m.Image(a), m.Dockerfile(a)
+		log.Info().Str("image", image).Str("dockerfile", dockerfile).Str("context", m.Build.Context).Msg("Building")
+		fmt.Fprintf(out, "# %s from %s\n", image, dockerfile)
+		if err := o.Runtime.Build(ctx, m.Build.Context, dockerfile, image, out); err != nil {
+			return fmt.Errorf("%v, see %s", err, out.Name())
+		}
+	}
+	return out.Close()
+}
+
+// Run runs every run of the experiment, recording each container's result
+// in runs.csv as its run ends. Once ctx is cancelled the run in progress is
+// torn down and no more are started.
+func (o *Orchestrator) Run(ctx context.Context) ([]Result, error) {
+	file, err := os.Create(filepath.Join(o.Dir, "runs.csv"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	w.Write([]string{"run", "repetition", "analytic", "container", "image", "nodes", "edges", "freq", "seed", "started_ms", "finished_ms", "exit_code", "status", "error", "log", "samples"})
+
+	var results []Result
+	runs := o.Manifest.Runs()
+	for i, run := range runs {
+		if ctx.Err() != nil {
+			break
+		}
+		log.Info().Str("run", run.ID).Int("of", len(runs)).Int("number", i+1).Msg("Starting run")
+		runResults := o.run(ctx, run)
+		for _, r := range runResults {
+			w.Write(r.record(o.Dir))
+			e := log.Info()
+			if r.Status != Exited || r.ExitCode != 0 {
+				e = log.Warn().AnErr("error", r.Err)
+			}
+			e.Str("container", r.Container.Name).Str("status", r.Status).Int("exit", r.ExitCode).Dur("ran", r.Finished.Sub(r.Started)).Msg("Container finished")
+		}
+		w.Flush()
+		results = append(results, runResults...)
+	}
+	if err := w.Error(); err != nil {
+		return results, err
+	}
+	if err := file.Close(); err != nil {
+		return results, err
+	}
+	return results, ctx.Err()
+}
+
+func (r Result) record(dir string) []string {
+	rel := func(path string) string {
+		if p, err := filepath.Rel(dir, path); err == nil {
+			return p
+		}
+		return path
+	}
+	millis := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	}
+	errText := ""
+	if r.Err != nil {
+		errText = r.Err.Error()
+	}
+	logPath, samples := "", ""
+	if r.Log != "" {
+		logPath = rel(r.Log)
+	}
+	if r.Samples != "" {
+		samples = rel(r.Samples)
+	}
+	return []string{
+		r.Run.ID, strconv.Itoa(r.Run.Repetition), r.Container.Analytic, r.Container.Name, r.Container.Image,
+		strconv.Itoa(r.Run.Nodes), strconv.Itoa(r.Run.Edges), r.Run.Freq.String(), strconv.FormatInt(r.Run.Seed, 10),
+		millis(r.Started), millis(r.Finished), strconv.Itoa(r.ExitCode), r.Status, errText, logPath, samples,
+	}
+}
+
+// started is a container that was created, and so has to be removed.
+type started struct {
+	id     string
+	result *Result
+}
+
+// run starts the sampler and then the run's containers, waits for them to
+// exit, stopping those that overrun, and collects their logs before
+// removing them. Teardown goes ahead even when ctx is cancelled.
+func (o *Orchestrator) run(ctx context.Context, run Run) []Result {
+	m := o.Manifest
+	dir := filepath.Join(o.Dir, run.ID)
+	results := make([]Result, len(run.Containers))
+	for i, c := range run.Containers {
+		results[i] = Result{Run: run, Container: c}
+	}
+	fail := func(err error) []Result {
+		for i := range results {
+			results[i].Status, results[i].Err = Failed, err
+		}
+		return results
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fail(err)
+	}
+
+	var sampler *sampling
+	if o.Sampler != "" {
+		length := time.Duration(m.Sampler.Warmup+m.Duration+m.Grace) + stopTimeout + time.Minute
+		var err error
+		if sampler, err = startSampler(o.Sampler, o.Socket, m, run, dir, length); err != nil {
+			return fail(err)
+		}
+		for i := range results {
+			results[i].Samples = sampler.Path
+		}
+	}
+
+	var created []started
+	defer func() {
+		cleanup, cancel := context.WithTimeout(context.Background(), teardown)
+		defer cancel()
+		for _, s := range created {
+			if err := o.Runtime.Remove(cleanup, s.id); err != nil {
+				log.Warn().Err(err).Str("container", s.result.Container.Name).Msg("Could not remove the container")
+			}
+		}
+	}()
+
+	for i, c := range run.Containers {
+		r := &results[i]
+		cfg := engine.ContainerConfig{
+			Image: c.Image,
+			Cmd:   c.Args,
+			Labels: map[string]string{
+				"experiment": m.Name,
+				"run":        run.ID,
+				"analytic":   c.Analytic,
+				"repetition": strconv.Itoa(run.Repetition),
+			},
+		}
+		id, err := o.Runtime.Create(ctx, c.Name, cfg)
+		if err != nil {
+			r.Status, r.Err = Failed, err
+			continue
+		}
+		created = append(created, started{id: id, result: r})
+		if err := o.Runtime.Start(ctx, id); err != nil {
+			r.Status, r.Err = Failed, err
+			continue
+		}
+		r.Started = time.Now()
+	}
+
+	// The containers share one deadline, as they were started together. Their
+	// runners count Duration from the end of the warm-up, in which the
+	// sampler takes its first sample of each of them
+	deadline := time.Now().Add(time.Duration(m.Sampler.Warmup + m.Duration + m.Grace))
+	for _, s := range created {
+		r := s.result
+		if r.Status == Failed {
+			continue
+		}
+		waitCtx, cancelWait := context.WithDeadline(ctx, deadline)
+		code, err := o.Runtime.Wait(waitCtx, s.id)
+		cancelWait()
+		switch {
+		case err == nil:
+			r.Status, r.ExitCode = Exited, code
+		case ctx.Err() != nil || waitCtx.Err() != nil:
+			r.Status = Stopped
+			if ctx.Err() != nil {
+				r.Status = Cancelled
+			}
+			cleanup, cancel := context.WithTimeout(context.Background(), teardown)
+			if err := o.Runtime.Stop(cleanup, s.id, stopTimeout); err != nil {
+				r.Err = err
+			}
+			if code, err := o.Runtime.Wait(cleanup, s.id); err == nil {
+				r.ExitCode = code
+			}
+			cancel()
+		default:
+			r.Status, r.Err = Failed, err
+		}
+		r.Finished = time.Now()
+	}
+
+	if sampler != nil {
+		if err := sampler.stop(stopTimeout); err != nil {
+			log.Warn().Err(err).Str("run", run.ID).Msg("The sampler did not finish cleanly")
+		}
+	}
+
+	// Logs are named after their container, which is how correlate matches
+	// them to the container's samples
+	cleanup, cancel := context.WithTimeout(context.Background(), teardown)
+	defer cancel()
+	for _, s := range created {
+		path := filepath.Join(dir, s.result.Container.Name+".log")
+		if err := o.saveLogs(cleanup, s.id, path); err != nil {
+			log.Warn().Err(err).Str("container", s.result.Container.Name).Msg("Could not collect the container's logs")
+			continue
+		}
+		s.result.Log = path
+	}
+	return results
+}
+
+func (o *Orchestrator) saveLogs(ctx context.Context, id, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := o.Runtime.Logs(ctx, id, file); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,208 @@
+package experiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dockerstats/engine"
+)
+
+// fakeRuntime runs no containers: each one created exits with its code
+// after the delay its analytic is given, or runs until it is stopped if it
+// has none. Analytics in failStart cannot be started.
+type fakeRuntime struct {
+	mu        sync.Mutex
+	exitAfter map[string]time.Duration
+	exitCode  map[string]int
+	failStart map[string]bool
+	created   map[string]*fakeContainer
+	removed   []string
+	stopped   []string
+}
+
+type fakeContainer struct {
+	name     string
+	analytic string
+	exited   chan struct{}
+	code     int
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{exitAfter: map[string]time.Duration{}, exitCode: map[string]int{}, failStart: map[string]bool{}, created: map[string]*fakeContainer{}}
+}
+
+func (f *fakeRuntime) Build(ctx context.Context, dir, dockerfile, tag string, progress io.Writer) error {
+	return nil
+}
+
+func (f *fakeRuntime) Create(ctx context.Context, name string, cfg engine.ContainerConfig) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := fmt.Sprintf("id-%d", len(f.created))
+	f.created[id] = &fakeContainer{name: name, analytic: cfg.Labels["analytic"], exited: make(chan struct{})}
+	return id, nil
+}
+
+func (f *fakeRuntime) Start(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.created[id]
+	if f.failStart[c.analytic] {
+		return errors.New("no such image")
+	}
+	if after, ok := f.exitAfter[c.analytic]; ok {
+		code := f.exitCode[c.analytic]
+		time.AfterFunc(after, func() { f.exit(c, code) })
+	}
+	return nil
+}
+
+func (f *fakeRuntime) exit(c *fakeContainer, code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	select {
+	case <-c.exited:
+	default:
+		c.code = code
+		close(c.exited)
+	}
+}
+
+func (f *fakeRuntime) Wait(ctx context.Context, id string) (int, error) {
+	f.mu.Lock()
+	c := f.created[id]
+	f.mu.Unlock()
+	select {
+	case <-c.exited:
+		return c.code, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (f *fakeRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	f.mu.Lock()
+	c := f.created[id]
+	f.stopped = append(f.stopped, c.name)
+	f.mu.Unlock()
+	f.exit(c, 137)
+	return nil
+}
+
+func (f *fakeRuntime) Logs(ctx context.Context, id string, w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, err := fmt.Fprintf(w, "log of %s\n", f.created[id].name)
+	return err
+}
+
+func (f *fakeRuntime) Remove(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removed = append(f.removed, f.created[id].name)
+	return nil
+}
+
+func testManifest(analytics ...string) *Manifest {
+	return &Manifest{
+		Name:        "exp",
+		Analytics:   analytics,
+		Nodes:       []int{100},
+		Edges:       []int{500},
+		Freqs:       []Duration{Duration(time.Second)},
+		Duration:    Duration(20 * time.Millisecond),
+		Grace:       Duration(20 * time.Millisecond),
+		Repetitions: 1,
+		Together:    true,
+		Build:       Build{Image: "{analytic}"},
+		Sampler:     Sampler{Format: "csv", Warmup: Duration(10 * time.Millisecond)},
+	}
+}
+
+func byAnalytic(results []Result) map[string]Result {
+	found := map[string]Result{}
+	for _, r := range results {
+		found[r.Container.Analytic] = r
+	}
+	return found
+}
+
+// A container that exits is recorded with its code, one that overruns its
+// warm-up, duration and grace is stopped, and one that cannot start has
+// failed. Every container created is removed, whether it ran or not.
+func TestRunOutcomes(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.exitAfter["quick"], rt.exitCode["quick"] = 5*time.Millisecond, 3
+	rt.failStart["broken"] = true
+	o := &Orchestrator{Manifest: testManifest("quick", "slow", "broken"), Runtime: rt, Dir: t.TempDir()}
+
+	started := time.Now()
+	results, err := o.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran := time.Since(started); ran < 50*time.Millisecond {
+		t.Errorf("the run took %s, less than its 10ms warm-up, 20ms duration and 20ms grace", ran)
+	}
+
+	found := byAnalytic(results)
+	if r := found["quick"]; r.Status != Exited || r.ExitCode != 3 {
+		t.Errorf("quick is %s with code %d, want exited with 3", r.Status, r.ExitCode)
+	}
+	if r := found["slow"]; r.Status != Stopped || r.ExitCode != 137 {
+		t.Errorf("slow is %s with code %d, want stopped with 137", r.Status, r.ExitCode)
+	}
+	if r := found["broken"]; r.Status != Failed || r.Err == nil || !r.Started.IsZero() {
+		t.Errorf("broken is %s with error %v, want failed to start", r.Status, r.Err)
+	}
+	if len(rt.stopped) != 1 || rt.stopped[0] != found["slow"].Container.Name {
+		t.Errorf("stopped %q, want only the slow container", rt.stopped)
+	}
+	if len(rt.removed) != 3 {
+		t.Errorf("removed %q, want all three containers", rt.removed)
+	}
+
+	for _, r := range results {
+		data, err := os.ReadFile(r.Log)
+		if err != nil || string(data) != "log of "+r.Container.Name+"\n" {
+			t.Errorf("%s log is %q, %v", r.Container.Name, data, err)
+		}
+	}
+	runs, err := os.ReadFile(filepath.Join(o.Dir, "runs.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(runs), "\n"); lines != 4 {
+		t.Errorf("runs.csv has %d lines, want the header and one per container", lines)
+	}
+}
+
+// Cancelling the experiment stops the run in progress, still removes its
+// containers and starts no more runs.
+func TestRunCancelled(t *testing.T) {
+	rt := newFakeRuntime()
+	m := testManifest("slow")
+	m.Duration, m.Repetitions = Duration(time.Hour), 3
+	o := &Orchestrator{Manifest: m, Runtime: rt, Dir: t.TempDir()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	results, err := o.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("a cancelled experiment returned %v", err)
+	}
+	if len(results) != 1 || results[0].Status != Cancelled || results[0].ExitCode != 137 {
+		t.Fatalf("got %+v, want the first run's container cancelled", results)
+	}
+	if len(rt.created) != 1 || len(rt.removed) != 1 {
+		t.Errorf("created %d containers and removed %q, want the one removed", len(rt.created), rt.removed)
+	}
+}
@@ -0,0 +1,70 @@
+package experiment
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"dockerstats/sample"
+)
+
+// sampling is a dockerstats process sampling the containers of one run.
+type sampling struct {
+	cmd  *exec.Cmd
+	log  *os.File
+	done chan error
+	// Path is where the samples are written
+	Path string
+}
+
+// startSampler runs the dockerstats binary against the engine socket,
+// selecting the run's containers by their labels, with its output going to
+// sampler.log in dir. It is given long enough for the whole run, and is
+// stopped once the run's containers have exited.
+func startSampler(binary, socket string, m *Manifest, run Run, dir string, length time.Duration) (*sampling, error) {
+	s := &sampling{Path: filepath.Join(dir, "stats"+sample.Extension(m.Sampler.Format)), done: make(chan error, 1)}
+	args := []string{
+		"-engine.socket", socket,
+		"-label", "experiment=" + m.Name + ",run=" + run.ID,
+		"-out", s.Path,
+		"-format", m.Sampler.Format,
+	}
+	args = append(args, m.Sampler.Args...)
+	args = append(args, strconv.Itoa(int(length.Seconds()+0.5)))
+
+	var err error
+	if s.log, err = os.Create(filepath.Join(dir, "sampler.log")); err != nil {
+		return nil, err
+	}
+	s.cmd = exec.Command(binary, args...)
+	s.cmd.Stdout, s.cmd.Stderr = s.log, s.log
+	if err := s.cmd.Start(); err != nil {
+		s.log.Close()
+		return nil, fmt.Errorf("sampler %s: %v", binary, err)
+	}
+	go func() {
+		s.done <- s.cmd.Wait()
+	}()
+	return s, nil
+}
+
+// stop interrupts dockerstats, which then writes out what it has, killing it
+// if it has not exited within timeout.
+func (s *sampling) stop(timeout time.Duration) error {
+	defer s.log.Close()
+	s.cmd.Process.Signal(os.Interrupt)
+	select {
+	case err := <-s.done:
+		if err != nil {
+			return fmt.Errorf("sampler: %v, see %s", err, s.log.Name())
+		}
+		return nil
+	case <-time.After(timeout):
+		s.cmd.Process.Kill()
+		<-s.done
+		return fmt.Errorf("sampler did not exit within %s of being interrupted and was killed", timeout)
+	}
+}
@@ -0,0 +1,439 @@
+// fakeengine serves the parts of the Docker Engine API that dockerstats uses
+// on a unix socket, with made-up containers whose counters grow steadily, so
+// dockerstats can be run and checked on a machine without Docker. It can
+// start a container part way through and restart one periodically, raising
+// the events Docker would:
+//
+//	go run ./fakeengine -socket /tmp/docker.sock &
+//	go run . -source api -engine.socket /tmp/docker.sock 10
+//
+// It also builds images and runs containers as the orchestrator asks it to.
+// A build keeps only the Dockerfile's exec form ENTRYPOINT and CMD, and a
+// container running the analytics runner, as the Dockerfiles at the root of
+// the repository do, logs an iteration every -freq for -duration, using a
+// core while it computes, so an experiment can be run end to end:
+//
+//	go run ./fakeengine -socket /tmp/docker.sock -containers 0 &
+//	go run ./orchestrate -engine.socket /tmp/docker.sock -sampler ./dockerstats ../experiments/baseline.yaml
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"dockerstats/engine"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	onlineCPUs = 4
+	memLimit   = 2 << 30
+)
+
+// fakeContainer has a fixed CPU load, in cores, and memory footprint, unless
+// it was created through the API, when its simulation decides them.
+type fakeContainer struct {
+	engine.Container
+	started  time.Time
+	load     float64
+	memory   uint64
+	running  bool
+	exitCode int
+
+	args []string
+	sim  *simulation
+}
+
+type server struct {
+	interval time.Duration
+
+	mu          sync.Mutex
+	containers  []*fakeContainer
+	images      map[string]image
+	history     []engine.Event
+	subscribers map[chan engine.Event]bool
+}
+
+var versioned = regexp.MustCompile(`^/v[0-9.]+/`)
+
+func main() {
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	socket := flag.String("socket", "/tmp/fakeengine.sock", "unix socket to listen on")
+	count := flag.Int("containers", 3, "number of running containers")
+	interval := flag.Duration("interval", time.Second, "time between streamed stats, dockerd uses 1s")
+	late := flag.Duration("late", 0, "start another container, fake-late, this long after listening, 0 for never")
+	restart := flag.Duration("restart", 0, "restart fake-1 this often, 0 for never")
+	flag.Parse()
+
+	s := &server{interval: *interval, images: map[string]image{}, subscribers: map[chan engine.Event]bool{}}
+	for i := 1; i <= *count; i++ {
+		s.containers = append(s.containers, newContainer(i, fmt.Sprintf("fake-%d", i), "fake/analytic:1.0"))
+	}
+
+	os.Remove(*socket)
+	listener, err := net.Listen("unix", *socket)
+	if err != nil {
+		log.Error().Err(err).Str("socket", *socket).Msg("Error: Could not listen")
+		os.Exit(1)
+	}
+
+	// Remove the socket on the way out so the next run can listen on it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	if *late > 0 {
+		go func() {
+			time.Sleep(*late)
+			s.mu.Lock()
+			c := newContainer(len(s.containers)+1, "fake-late", "fake/late:1.0")
+			c.running = false
+			s.containers = append(s.containers, c)
+			s.mu.Unlock()
+			s.start(c, "start")
+		}()
+	}
+	if *restart > 0 && len(s.containers) > 0 {
+		go func() {
+			c := s.containers[0]
+			for range time.Tick(*restart) {
+				s.stop(c)
+				s.start(c, "start", "restart")
+			}
+		}()
+	}
+
+	log.Info().Str("socket", *socket).Int("containers", *count).Dur("late", *late).Dur("restart", *restart).Msg("Fake engine listening")
+	if err := http.Serve(listener, s); err != nil && ctx.Err() == nil {
+		log.Error().Err(err).Msg("Error: Fake engine stopped")
+		os.Exit(1)
+	}
+}
+
+func newContainer(i int, name, image string) *fakeContainer {
+	return &fakeContainer{
+		Container: engine.Container{
+			ID:     fmt.Sprintf("%064x", i),
+			Names:  []string{"/" + name},
+			Image:  image,
+			Labels: map[string]string{"experiment": "fake", "index": fmt.Sprint(i)},
+			State:  "running",
+		},
+		started: time.Now(),
+		load:    0.25 * float64(i),
+		memory:  uint64(i) * 64 << 20,
+		running: true,
+	}
+}
+
+// start runs c, with its counters from zero, and raises each action.
+func (s *server) start(c *fakeContainer, actions ...string) {
+	s.mu.Lock()
+	c.running = true
+	c.State = "running"
+	c.started = time.Now()
+	s.mu.Unlock()
+	for _, action := range actions {
+		s.publish(c, action)
+	}
+}
+
+// stop exits c as docker stop does.
+func (s *server) stop(c *fakeContainer) {
+	s.exit(c, 0, "kill", "die", "stop")
+}
+
+// exit ends c with the exit code and raises each action.
+func (s *server) exit(c *fakeContainer, code int, actions ...string) {
+	s.mu.Lock()
+	c.running = false
+	c.State = "exited"
+	c.exitCode = code
+	s.mu.Unlock()
+	for _, action := range actions {
+		s.publish(c, action)
+	}
+}
+
+func (s *server) publish(c *fakeContainer, action string) {
+	var e engine.Event
+	e.Type = "container"
+	e.Action = action
+	e.Actor.ID = c.ID
+	e.Actor.Attributes = map[string]string{"name": c.Name(), "image": c.Image}
+	for k, v := range c.Labels {
+		e.Actor.Attributes[k] = v
+	}
+	e.TimeNano = time.Now().UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history = append(s.history, e)
+	for sub := range s.subscribers {
+		select {
+		case sub <- e:
+		default:
+			// A subscriber that cannot keep up misses events, as with dockerd
+		}
+	}
+	log.Info().Str("container", c.Name()).Str("action", action).Msg("Event")
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versioned.ReplaceAllString(r.URL.Path, "/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case path == "/_ping":
+		fmt.Fprint(w, "OK")
+	case path == "/build" && r.Method == http.MethodPost:
+		s.build(w, r)
+	case path == "/containers/create" && r.Method == http.MethodPost:
+		s.create(w, r)
+	case path == "/containers/json":
+		s.mu.Lock()
+		list := []engine.Container{}
+		for _, c := range s.containers {
+			if c.running {
+				list = append(list, c.Container)
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, list)
+	case path == "/events":
+		s.events(w, r)
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "json":
+		c := s.find(parts[1])
+		if c == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such container: " + parts[1]})
+			return
+		}
+		s.mu.Lock()
+		details := map[string]interface{}{
+			"Id":     c.ID,
+			"Name":   "/" + c.Name(),
+			"Config": map[string]interface{}{"Image": c.Image, "Labels": c.Labels},
+			"State":  map[string]interface{}{"Status": c.State, "Running": c.running},
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, details)
+	case len(parts) == 3 && parts[0] == "containers" && parts[2] == "stats":
+		c := s.find(parts[1])
+		if c == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such container: " + parts[1]})
+			return
+		}
+		s.stats(w, r, c)
+	case len(parts) >= 2 && parts[0] == "containers":
+		s.lifecycle(w, r, parts)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "page not found"})
+	}
+}
+
+// lifecycle answers the start, stop, wait, logs and remove requests of the
+// orchestrator.
+func (s *server) lifecycle(w http.ResponseWriter, r *http.Request, parts []string) {
+	c := s.find(parts[1])
+	if c == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such container: " + parts[1]})
+		return
+	}
+
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		s.remove(w, r, c)
+	case action == "start" && r.Method == http.MethodPost:
+		s.run(w, c)
+	case action == "stop" && r.Method == http.MethodPost:
+		s.halt(w, r, c)
+	case action == "wait" && r.Method == http.MethodPost:
+		s.wait(w, r, c)
+	case action == "logs" && r.Method == http.MethodGet:
+		s.logs(w, c)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "page not found"})
+	}
+}
+
+// events replays the events since the since parameter and then streams new
+// ones. Filters are not applied, as only container events are raised.
+func (s *server) events(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var seconds, nanos int64
+		fmt.Sscanf(v, "%d.%d", &seconds, &nanos)
+		since = time.Unix(seconds, nanos)
+	}
+
+	sub := make(chan engine.Event, 64)
+	s.mu.Lock()
+	var replay []engine.Event
+	for _, e := range s.history {
+		if !e.Time().Before(since) {
+			replay = append(replay, e)
+		}
+	}
+	s.subscribers[sub] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, sub)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for _, e := range replay {
+		encoder.Encode(e)
+	}
+	for {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-sub:
+			if err := encoder.Encode(e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *server) find(id string) *fakeContainer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.containers {
+		if c.ID == id || strings.HasPrefix(c.ID, id) || c.Name() == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// stats streams a reading every interval, or sends one when stream=false.
+func (s *server) stats(w http.ResponseWriter, r *http.Request, c *fakeContainer) {
+	stream := r.URL.Query().Get("stream") != "false"
+
+	s.mu.Lock()
+	prev := c.at(time.Now().Add(-s.interval))
+	s.mu.Unlock()
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		running := c.running
+		current := c.at(time.Now())
+		s.mu.Unlock()
+		if !running {
+			// dockerd ends the stream of a container that stops
+			return
+		}
+
+		current.PreRead = prev.Read
+		current.PreCPU = prev.CPU
+		if err := json.NewEncoder(w).Encode(current); err != nil {
+			// The client hung up
+			return
+		}
+		if !stream {
+			return
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		prev = current
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// at is the container's counters at t, grown at a steady rate since it
+// started.
+func (c *fakeContainer) at(t time.Time) engine.Stats {
+	up := t.Sub(c.started)
+	if up < 0 {
+		up = 0
+	}
+	seconds := up.Seconds()
+
+	var s engine.Stats
+	s.Read = t
+	s.ID = c.ID
+	s.Name = "/" + c.Name()
+
+	load, memory := c.load, c.memory
+	if c.sim != nil {
+		// A simulated runner idles at 1% of a core and uses a whole one while
+		// computing, holding its graph in memory for the computation
+		load = 0.01
+		memory = 24 << 20
+		if c.sim.computing(t) {
+			memory += uint64(c.sim.nodes)*2048 + uint64(c.sim.edges)*200
+		}
+	}
+
+	s.CPU.Usage.Total = uint64(float64(up.Nanoseconds()) * load)
+	if c.sim != nil {
+		s.CPU.Usage.Total += uint64(c.sim.busyUntil(t).Nanoseconds())
+	}
+	s.CPU.Usage.User = s.CPU.Usage.Total * 3 / 4
+	s.CPU.Usage.Kernel = s.CPU.Usage.Total - s.CPU.Usage.User
+	s.CPU.System = uint64(t.UnixNano()) * onlineCPUs
+	s.CPU.OnlineCPUs = onlineCPUs
+	s.CPU.Throttling.Periods = uint64(seconds * 10)
+	s.CPU.Throttling.ThrottledPeriods = s.CPU.Throttling.Periods / 10
+	s.CPU.Throttling.ThrottledTime = s.CPU.Throttling.ThrottledPeriods * uint64(5*time.Millisecond)
+
+	s.Memory.Usage = memory + uint64(seconds*4096)
+	s.Memory.Limit = memLimit
+	s.Memory.Stats = map[string]uint64{"inactive_file": 1 << 20, "anon": memory}
+
+	s.Networks = map[string]engine.Network{"eth0": {RxBytes: uint64(seconds * 1500), TxBytes: uint64(seconds * 600)}}
+
+	s.BlkIO.ServiceBytes = []engine.BlkIOEntry{
+		{Major: 8, Op: "read", Value: 1 << 20},
+		{Major: 8, Op: "write", Value: uint64(seconds * 8192)},
+	}
+
+	s.Pids.Current = 8
+	return s
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dockerstats/engine"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// image is what a build keeps of a Dockerfile: its exec form ENTRYPOINT and
+// CMD.
+type image struct {
+	entrypoint []string
+	cmd        []string
+}
+
+// detectors are the analytics whose iterations report detections.
+var detectors = map[string]bool{"klddos": true, "beaconing": true, "heavyhitter": true, "superspreader": true}
+
+// build reads the context archive for the Dockerfile and keeps its
+// entrypoint and command under the tag, answering with the stream of
+// messages docker build reads.
+func (s *server) build(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tag := withTag(query.Get("t"))
+	dockerfile := query.Get("dockerfile")
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if tag == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "fakeengine only builds tagged images"})
+		return
+	}
+
+	var instructions []string
+	files := 0
+	archive := tar.NewReader(r.Body)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "unreadable build context: " + err.Error()})
+			return
+		}
+		files++
+		if path.Clean(header.Name) != path.Clean(dockerfile) {
+			continue
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"message": "unreadable build context: " + err.Error()})
+			return
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				instructions = append(instructions, line)
+			}
+		}
+	}
+	if instructions == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"message": "Cannot locate specified Dockerfile: " + dockerfile})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	var img image
+	for i, line := range instructions {
+		encoder.Encode(map[string]string{"stream": fmt.Sprintf("Step %d/%d : %s\n", i+1, len(instructions), line)})
+		keyword, rest, _ := strings.Cut(line, " ")
+		var target *[]string
+		switch strings.ToUpper(keyword) {
+		case "ENTRYPOINT":
+			target = &img.entrypoint
+		case "CMD":
+			target = &img.cmd
+		default:
+			continue
+		}
+		if err := json.Unmarshal([]byte(rest), target); err != nil {
+			encoder.Encode(map[string]string{"error": fmt.Sprintf("fakeengine only runs the exec form of %s, got %s", keyword, rest)})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.images[tag] = img
+	s.mu.Unlock()
+	id := newID()
+	encoder.Encode(map[string]interface{}{"aux": map[string]string{"ID": "sha256:" + id}})
+	encoder.Encode(map[string]string{"stream": fmt.Sprintf("Successfully built %s\n", id[:12])})
+	encoder.Encode(map[string]string{"stream": fmt.Sprintf("Successfully tagged %s\n", tag)})
+	log.Info().Str("image", tag).Int("files", files).Msg("Built")
+}
+
+// withTag adds the latest tag to an image name without one.
+func withTag(name string) string {
+	if name == "" || strings.LastIndex(name, ":") > strings.LastIndex(name, "/") {
+		return name
+	}
+	return name + ":latest"
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// create makes a stopped container of a built image.
+func (s *server) create(w http.ResponseWriter, r *http.Request) {
+	var cfg engine.ContainerConfig
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	name := r.URL.Query().Get("name")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	img, ok := s.images[withTag(cfg.Image)]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such image: " + cfg.Image})
+		return
+	}
+	if name == "" {
+		name = fmt.Sprintf("fake-%d", len(s.containers)+1)
+	}
+	for _, c := range s.containers {
+		if c.Name() == name {
+			writeJSON(w, http.StatusConflict, map[string]string{"message": fmt.Sprintf("Conflict. The container name %q is already in use by container %q", "/"+name, c.ID)})
+			return
+		}
+	}
+
+	cmd := cfg.Cmd
+	if len(cmd) == 0 {
+		cmd = img.cmd
+	}
+	c := &fakeContainer{
+		Container: engine.Container{
+			ID:     newID(),
+			Names:  []string{"/" + name},
+			Image:  cfg.Image,
+			Labels: cfg.Labels,
+			State:  "created",
+		},
+		args: append(append([]string{}, img.entrypoint...), cmd...),
+	}
+	s.containers = append(s.containers, c)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"Id": c.ID, "Warnings": []string{}})
+}
+
+// run starts a created container, simulating the analytics runner if it
+// runs one.
+func (s *server) run(w http.ResponseWriter, c *fakeContainer) {
+	s.mu.Lock()
+	if c.running {
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.sim = newSimulation(c.args)
+	s.mu.Unlock()
+
+	s.start(c, "start")
+	go s.simulate(c)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// halt stops a container as docker stop does, waiting up to the timeout
+// before killing it.
+func (s *server) halt(w http.ResponseWriter, r *http.Request, c *fakeContainer) {
+	s.mu.Lock()
+	running, sim := c.running, c.sim
+	s.mu.Unlock()
+	if !running {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if sim == nil {
+		s.stop(c)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	sim.cancel()
+	select {
+	case <-sim.done:
+	case <-r.Context().Done():
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// wait answers once the container is not running, with its exit code.
+func (s *server) wait(w http.ResponseWriter, r *http.Request, c *fakeContainer) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		running, code := c.running, c.exitCode
+		s.mu.Unlock()
+		if !running {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"StatusCode": code, "Error": nil})
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logs sends what the container logged to stderr, framed as dockerd frames
+// the output of a container without a TTY.
+func (s *server) logs(w http.ResponseWriter, c *fakeContainer) {
+	s.mu.Lock()
+	var out []byte
+	if c.sim != nil {
+		out = c.sim.output()
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	w.WriteHeader(http.StatusOK)
+	if len(out) == 0 {
+		return
+	}
+	header := []byte{2, 0, 0, 0, 0, 0, 0, 0}
+	header[4], header[5], header[6], header[7] = byte(len(out)>>24), byte(len(out)>>16), byte(len(out)>>8), byte(len(out))
+	w.Write(header)
+	w.Write(out)
+}
+
+// remove deletes a container, killing it first when forced.
+func (s *server) remove(w http.ResponseWriter, r *http.Request, c *fakeContainer) {
+	s.mu.Lock()
+	running, sim := c.running, c.sim
+	s.mu.Unlock()
+	if running {
+		if r.URL.Query().Get("force") != "true" && r.URL.Query().Get("force") != "1" {
+			writeJSON(w, http.StatusConflict, map[string]string{"message": "You cannot remove a running container " + c.ID + ". Stop the container before attempting removal or force remove"})
+			return
+		}
+		if sim != nil {
+			sim.kill()
+			<-sim.done
+		} else {
+			s.stop(c)
+		}
+	}
+
+	s.mu.Lock()
+	for i, other := range s.containers {
+		if other == c {
+			s.containers = append(s.containers[:i], s.containers[i+1:]...)
+			break
+		}
+	}
+	s.mu.Unlock()
+	s.publish(c, "destroy")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// simulation stands in for the analytics runner: every freq it computes for
+// a time that grows with the network size, using one core, and logs the
+// iteration as the runner does, until duration or iterations run out or it
+// is stopped.
+type simulation struct {
+	runner     bool
+	analytic   string
+	run        string
+	nodes      int
+	edges      int
+	freq       time.Duration
+	duration   time.Duration
+	iterations int
+	seed       int64
+
+	// busy holds the start and end of each computation
+	busy [][2]time.Time
+
+	mu     sync.Mutex
+	log    bytes.Buffer
+	ctx    context.Context
+	cancel context.CancelFunc
+	killed bool
+	done   chan struct{}
+}
+
+// newSimulation reads the runner's flags out of a container's arguments.
+// A container that does not run the runner idles until it is stopped.
+func newSimulation(args []string) *simulation {
+	sim := &simulation{nodes: 1083, edges: 59725, freq: 5 * time.Second, done: make(chan struct{})}
+	sim.ctx, sim.cancel = context.WithCancel(context.Background())
+	if len(args) > 0 && path.Base(args[0]) == "runner" {
+		sim.runner = true
+		args = args[1:]
+	}
+
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		value := ""
+		if n, v, ok := strings.Cut(name, "="); ok {
+			name, value = n, v
+		} else if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			value = args[i+1]
+			i++
+		}
+		switch name {
+		case "analytic":
+			sim.analytic = value
+		case "run-id":
+			sim.run = value
+		case "nodes":
+			sim.nodes, _ = strconv.Atoi(value)
+		case "edges":
+			sim.edges, _ = strconv.Atoi(value)
+		case "iterations":
+			sim.iterations, _ = strconv.Atoi(value)
+		case "seed":
+			sim.seed, _ = strconv.ParseInt(value, 10, 64)
+		case "freq":
+			sim.freq = parseDuration(value, sim.freq)
+		case "duration":
+			sim.duration = parseDuration(value, 0)
+		}
+	}
+	if sim.run == "" {
+		sim.run = fmt.Sprintf("%s-%d", sim.analytic, time.Now().Unix())
+	}
+	return sim
+}
+
+// parseDuration reads a duration as the runner does, a bare number being
+// seconds.
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	return fallback
+}
+
+func (sim *simulation) kill() {
+	sim.mu.Lock()
+	sim.killed = true
+	sim.mu.Unlock()
+	sim.cancel()
+}
+
+func (sim *simulation) output() []byte {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return append([]byte(nil), sim.log.Bytes()...)
+}
+
+func (sim *simulation) Write(p []byte) (int, error) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	return sim.log.Write(p)
+}
+
+// simulate runs the container's simulation and exits the container when it
+// ends, raising the events of a natural exit, a stop or a kill.
+func (s *server) simulate(c *fakeContainer) {
+	sim := c.sim
+	stopped := s.iterate(c, sim)
+	sim.mu.Lock()
+	killed := sim.killed
+	sim.mu.Unlock()
+
+	switch {
+	case killed:
+		s.exit(c, 137, "kill", "die")
+	case stopped:
+		// The runner finishes its run on SIGTERM
+		s.exit(c, 0, "kill", "die", "stop")
+	default:
+		s.exit(c, 0, "die")
+	}
+	close(sim.done)
+}
+
+// iterate logs the runner's iterations, reporting whether it was stopped
+// before the run was over.
+func (s *server) iterate(c *fakeContainer, sim *simulation) bool {
+	logger := zerolog.New(sim).With().Timestamp().Logger()
+	if !sim.runner {
+		<-sim.ctx.Done()
+		return true
+	}
+
+	r := mathrand.New(mathrand.NewSource(sim.seed))
+	// Computing takes 20µs a node and 2µs an edge, give or take 10%, and
+	// at most 90% of the frequency
+	work := time.Duration(sim.nodes)*20*time.Microsecond + time.Duration(sim.edges)*2*time.Microsecond
+	if limit := sim.freq * 9 / 10; work > limit {
+		work = limit
+	}
+
+	begin := time.Now()
+	next := begin
+	wait := func(d time.Duration) bool {
+		select {
+		case <-sim.ctx.Done():
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+	for iteration := 1; sim.iterations == 0 || iteration <= sim.iterations; iteration++ {
+		if sim.duration > 0 && next.Sub(begin) >= sim.duration {
+			break
+		}
+		if !wait(time.Until(next)) {
+			return true
+		}
+
+		start := time.Now()
+		elapsed := time.Duration(float64(work) * (0.9 + 0.2*r.Float64()))
+		s.mu.Lock()
+		sim.busy = append(sim.busy, [2]time.Time{start, start.Add(elapsed)})
+		s.mu.Unlock()
+		if !wait(elapsed) {
+			return true
+		}
+
+		e := logger.Info().Str("analytic", sim.analytic).Str("run", sim.run).Int("iteration", iteration).Time("start", start).Time("scheduled", next).Int64("lag", start.Sub(next).Microseconds()).Bool("missed", false).Int("nodes", sim.nodes).Int("edgesamplesize", sim.edges)
+		if detectors[sim.analytic] {
+			e.Int("detections", r.Intn(4))
+		}
+		e.Int64("elapsed", elapsed.Microseconds()).Msgf("Computation with node count %d and edge sample %d took %s\n", sim.nodes, sim.edges, elapsed)
+
+		// Runs that fall behind start back to back, as the fixed-rate
+		// schedule starts them
+		next = next.Add(sim.freq)
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+	}
+	logger.Info().Str("analytic", sim.analytic).Str("run", sim.run).Int("nodes", sim.nodes).Int("edgesamplesize", sim.edges).Msg("Run summary")
+	return false
+}
+
+// busyUntil is how long the simulation has computed by t.
+func (sim *simulation) busyUntil(t time.Time) time.Duration {
+	var total time.Duration
+	for _, span := range sim.busy {
+		if t.Before(span[0]) {
+			continue
+		}
+		end := span[1]
+		if t.Before(end) {
+			end = t
+		}
+		total += end.Sub(span[0])
+	}
+	return total
+}
+
+// computing reports whether the simulation is in a computation at t.
+func (sim *simulation) computing(t time.Time) bool {
+	if n := len(sim.busy); n > 0 {
+		span := sim.busy[n-1]
+		return !t.Before(span[0]) && t.Before(span[1])
+	}
+	return false
+}
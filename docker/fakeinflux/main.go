@@ -0,0 +1,169 @@
+// fakeinflux stands in for InfluxDB when checking dockerstats' line protocol
+// output. It accepts writes on the v1 /write and v2 /api/v2/write endpoints,
+// checks each line has a measurement, fields and a timestamp, and appends
+// the lines to a file or stdout:
+//
+//	go run ./fakeinflux -addr localhost:8086 -out influx.lp &
+//	go run . -out 'http://localhost:8086/api/v2/write?org=lab&bucket=soak' 10
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type server struct {
+	token string
+
+	mu    sync.Mutex
+	out   io.Writer
+	lines int
+}
+
+func main() {
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	addr := flag.String("addr", "localhost:8086", "address to listen on")
+	outPath := flag.String("out", "", "file the received lines are appended to, stdout when empty")
+	token := flag.String("token", "", "token writes must carry, none when empty")
+	flag.Parse()
+
+	s := &server{token: *token, out: os.Stdout}
+	if *outPath != "" {
+		file, err := os.OpenFile(*outPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Error().Err(err).Str("out", *outPath).Msg("Error: Could not open the output file")
+			os.Exit(1)
+		}
+		defer file.Close()
+		s.out = file
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/write", s.write)
+	mux.HandleFunc("/api/v2/write", s.write)
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	srv := &http.Server{Addr: *addr, Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+
+	log.Info().Str("addr", *addr).Msg("Fake InfluxDB listening")
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error().Err(err).Msg("Error: Server failed")
+		os.Exit(1)
+	}
+
+	s.mu.Lock()
+	log.Info().Int("lines", s.lines).Msg("Fake InfluxDB stopped")
+	s.mu.Unlock()
+}
+
+func (s *server) write(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "writes must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.token != "" && r.Header.Get("Authorization") != "Token "+s.token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if p := r.URL.Query().Get("precision"); p != "" && p != "ns" {
+		http.Error(w, "only nanosecond precision is supported", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the whole batch before keeping any of it, as InfluxDB does
+	count := 0
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		count++
+		if err := checkLine(line); err != nil {
+			http.Error(w, fmt.Sprintf("line %d: %v", count, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	_, err = s.out.Write(body)
+	s.lines += count
+	total := s.lines
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Str("path", r.URL.Path).Str("query", r.URL.RawQuery).Int("lines", count).Int("total", total).Msg("Write")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkLine splits a line into its measurement and tags, fields and
+// timestamp on unescaped spaces outside quoted field values.
+func checkLine(line string) error {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ' ':
+			if !quoted {
+				parts = append(parts, line[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, line[start:])
+
+	if len(parts) != 3 {
+		return fmt.Errorf("want measurement, fields and timestamp, got %d parts", len(parts))
+	}
+	if parts[0] == "" || strings.HasPrefix(parts[0], ",") {
+		return fmt.Errorf("missing measurement")
+	}
+	if !strings.Contains(parts[1], "=") {
+		return fmt.Errorf("missing fields")
+	}
+	if _, err := strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return fmt.Errorf("bad timestamp %q", parts[2])
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// orchestrate runs an experiment from a manifest: it builds each analytic's
+// image, then for every analytic, network size, frequency and repetition it
+// starts the containers with those settings, samples them with dockerstats
+// and collects their logs, removing the containers before the next run:
+//
+//	go build -o dockerstats .
+//	go run ./orchestrate -sampler ./dockerstats ../experiments/baseline.yaml
+//
+// Each experiment gets a directory under the manifest's results directory,
+// holding a copy of the manifest, build.log, runs.csv with what became of
+// every container, and a directory per run with the samples and a log per
+// container, named after it so correlate matches them:
+//
+//	go run ./correlate -samples results/baseline-1700000000/baseline-n1083-m59725-f1s-r1/stats.csv results/baseline-1700000000/baseline-n1083-m59725-f1s-r1/*.log
+//
+// fakeengine stands in for Docker to try a manifest out; see its
+// documentation.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"dockerstats/engine"
+	"dockerstats/experiment"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	socket := flag.String("engine.socket", engine.EnvSocket(), "unix socket of the Docker Engine API, or of fakeengine")
+	sampler := flag.String("sampler", "dockerstats", "dockerstats binary the runs are sampled with, empty for no sampling")
+	build := flag.Bool("build", true, "build the analytics' images first, false to run the images already built")
+	dryRun := flag.Bool("dry-run", false, "print the runs and their containers' arguments without running them")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Error().Msg("Usage: ./orchestrate [-engine.socket /var/run/docker.sock] [-sampler ./dockerstats] [-build=false] [-dry-run] <manifest.yaml>")
+		os.Exit(1)
+	}
+	manifestPath := flag.Arg(0)
+	m, err := experiment.Load(manifestPath)
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Could not load the manifest")
+		os.Exit(1)
+	}
+
+	runs := m.Runs()
+	if *dryRun {
+		for _, run := range runs {
+			fmt.Println(run.ID)
+			for _, c := range run.Containers {
+				fmt.Printf("  %s  %s %v\n", c.Name, c.Image, c.Args)
+			}
+		}
+		return
+	}
+
+	if *sampler != "" {
+		path, err := exec.LookPath(*sampler)
+		if err != nil {
+			log.Error().Err(err).Msg("Error: Could not find the sampler, build it with go build -o dockerstats . and give its path with -sampler")
+			os.Exit(1)
+		}
+		*sampler = path
+	}
+
+	dir := filepath.Join(m.Results, fmt.Sprintf("%s-%d", m.Name, time.Now().Unix()))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("Error: Could not create the results directory")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "manifest"+filepath.Ext(manifestPath)), data, 0o644)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("Error: Could not copy the manifest")
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	o := &experiment.Orchestrator{
+		Manifest: m,
+		Runtime:  engine.New(*socket),
+		Sampler:  *sampler,
+		Socket:   *socket,
+		Dir:      dir,
+	}
+	if *build {
+		if err := o.Build(ctx); err != nil {
+			log.Error().Err(err).Msg("Error: Could not build the images")
+			os.Exit(1)
+		}
+	}
+
+	log.Info().Str("experiment", m.Name).Int("runs", len(runs)).Dur("duration", time.Duration(m.Duration)).Str("dir", dir).Msg("Running experiment")
+	results, err := o.Run(ctx)
+	failed := 0
+	for _, r := range results {
+		if r.Status != experiment.Exited || r.ExitCode != 0 {
+			failed++
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Int("containers", len(results)).Int("failed", failed).Str("dir", dir).Msg("Error: The experiment did not finish")
+		os.Exit(1)
+	}
+	if failed > 0 {
+		log.Warn().Int("containers", len(results)).Int("failed", failed).Str("runs", filepath.Join(dir, "runs.csv")).Msg("Some containers did not exit cleanly")
+	}
+	log.Info().Int("containers", len(results)).Str("dir", dir).Msg("Experiment results have been written")
+}
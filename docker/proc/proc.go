@@ -0,0 +1,318 @@
+// Package proc reads the resource counters of a process and its descendants
+// from /proc, for analytics run natively rather than in a container. A
+// process tree is summed the way a container's cgroup would count it.
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultRoot is where procfs is mounted.
+const DefaultRoot = "/proc"
+
+// userHZ is the unit of the times in /proc/<pid>/stat, which Linux fixes at
+// 100 on every architecture it reports to user space.
+const userHZ = 100
+
+// Process is one process's /proc/<pid>/stat.
+type Process struct {
+	PID  int
+	PPID int
+	// Comm is the executable name, truncated by the kernel to 15 bytes
+	Comm string
+	// State is R when running, S when sleeping, Z for a zombie and so on
+	State string
+	// Start is when the process started, in clock ticks since boot, which
+	// tells a process from a later one that reused its PID
+	Start uint64
+
+	// Times and faults include those of children the process has waited
+	// for
+	UTime   time.Duration
+	STime   time.Duration
+	MinFlt  uint64
+	MajFlt  uint64
+	Threads uint64
+}
+
+// Table is every process at one moment, by PID.
+type Table struct {
+	Time      time.Time
+	root      string
+	processes map[int]*Process
+	children  map[int][]int
+}
+
+// Scan reads the stat file of every process under root, stamping the table
+// with the time it was read. Processes that exit during the scan are left
+// out.
+func Scan(root string) (*Table, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{Time: time.Now(), root: root, processes: map[int]*Process{}, children: map[int][]int{}}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		p, err := readStat(filepath.Join(root, entry.Name(), "stat"))
+		if gone(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.PID = pid
+		t.processes[pid] = p
+		t.children[p.PPID] = append(t.children[p.PPID], pid)
+	}
+	return t, nil
+}
+
+// Process is the process with pid, or nil when it is not running.
+func (t *Table) Process(pid int) *Process {
+	return t.processes[pid]
+}
+
+// Tree is pid followed by all of its descendants.
+func (t *Table) Tree(pid int) []int {
+	if t.processes[pid] == nil {
+		return nil
+	}
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, t.children[tree[i]]...)
+	}
+	return tree
+}
+
+// Roots is the live processes among pids, and those whose name matches one
+// of the glob patterns, in PID order. Zombies are not roots. A process that
+// descends from another root is left out, as it is counted in that root's
+// tree, so a server that forks workers of the same name is one root.
+func (t *Table) Roots(pids []int, patterns []string) []int {
+	candidate := map[int]bool{}
+	for _, pid := range pids {
+		if p := t.processes[pid]; p != nil && p.State != "Z" {
+			candidate[pid] = true
+		}
+	}
+	if len(patterns) > 0 {
+		for pid, p := range t.processes {
+			if p.State != "Z" && t.matches(p, patterns) {
+				candidate[pid] = true
+			}
+		}
+	}
+
+	var roots []int
+	for pid := range candidate {
+		nested := false
+		for ancestor := t.processes[pid].PPID; !nested && t.processes[ancestor] != nil; ancestor = t.processes[ancestor].PPID {
+			nested = candidate[ancestor]
+		}
+		if !nested {
+			roots = append(roots, pid)
+		}
+	}
+	sort.Ints(roots)
+	return roots
+}
+
+// matches is whether the process's name, or the base name of the program in
+// its command line when the name was truncated, matches a pattern.
+func (t *Table) matches(p *Process, patterns []string) bool {
+	names := []string{p.Comm}
+	if cmdline, err := os.ReadFile(filepath.Join(t.root, strconv.Itoa(p.PID), "cmdline")); err == nil {
+		if argv0, _, _ := strings.Cut(string(cmdline), "\x00"); argv0 != "" {
+			names = append(names, path.Base(argv0))
+		}
+	}
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Stats are the summed counters of a process tree at one moment.
+type Stats struct {
+	Time time.Time
+	// Procs is the number of processes in the tree and Threads their tasks,
+	// which is what a cgroup's pids.current counts
+	Procs   int
+	Threads uint64
+
+	CPUUser    time.Duration
+	CPUSystem  time.Duration
+	PgFault    uint64
+	PgMajFault uint64
+
+	// Resident memory from /proc/<pid>/status. Pages shared between
+	// processes in the tree are counted once for each
+	RSS   uint64
+	Anon  uint64
+	File  uint64
+	Shmem uint64
+
+	// Bytes read from and written to storage, from /proc/<pid>/io. IO is
+	// false when the io files could not be read, which needs the processes'
+	// user or root
+	ReadBytes  uint64
+	WriteBytes uint64
+	IO         bool
+}
+
+// CPUUsage is the tree's user and system CPU time.
+func (s Stats) CPUUsage() time.Duration {
+	return s.CPUUser + s.CPUSystem
+}
+
+// Read sums the counters of pid and its descendants. Counters are
+// cumulative and include children that have exited and been waited for, but
+// drop when a process leaves the tree without being waited for, as an
+// orphan reparented away does.
+func (t *Table) Read(pid int) (Stats, error) {
+	tree := t.Tree(pid)
+	if tree == nil {
+		return Stats{}, fmt.Errorf("process %d is not running", pid)
+	}
+
+	s := Stats{Time: t.Time, IO: true}
+	for _, member := range tree {
+		p := t.processes[member]
+		dir := filepath.Join(t.root, strconv.Itoa(member))
+
+		status, err := readKeyedUnits(filepath.Join(dir, "status"))
+		if gone(err) {
+			// Exited since the scan
+			continue
+		}
+		if err != nil {
+			return s, err
+		}
+
+		s.Procs++
+		s.Threads += p.Threads
+		s.CPUUser += p.UTime
+		s.CPUSystem += p.STime
+		s.PgFault += p.MinFlt + p.MajFlt
+		s.PgMajFault += p.MajFlt
+
+		s.RSS += status["VmRSS:"] * 1024
+		s.Anon += status["RssAnon:"] * 1024
+		s.File += status["RssFile:"] * 1024
+		s.Shmem += status["RssShmem:"] * 1024
+
+		if !s.IO {
+			continue
+		}
+		io, err := readKeyedUnits(filepath.Join(dir, "io"))
+		switch {
+		case gone(err):
+		case errors.Is(err, os.ErrPermission):
+			s.IO = false
+		case err != nil:
+			return s, err
+		default:
+			s.ReadBytes += io["read_bytes:"]
+			s.WriteBytes += io["write_bytes:"]
+		}
+	}
+	if s.Procs == 0 {
+		return s, fmt.Errorf("process %d is not running", pid)
+	}
+	if !s.IO {
+		s.ReadBytes, s.WriteBytes = 0, 0
+	}
+	return s, nil
+}
+
+var errExited = errors.New("process has exited")
+
+// gone is whether err is from reading a process that has exited, whose files
+// vanish or fail with ESRCH once it is reaped.
+func gone(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ESRCH) || errors.Is(err, errExited)
+}
+
+// readStat parses /proc/<pid>/stat. The name is in parentheses and may hold
+// spaces or parentheses itself, so the fields are split after the last ')'.
+func readStat(file string) (*Process, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	line := string(data)
+	lparen, rparen := strings.IndexByte(line, '('), strings.LastIndexByte(line, ')')
+	if lparen < 0 || rparen < lparen {
+		return nil, fmt.Errorf("%s: malformed", file)
+	}
+	// fields[0] is field 3 of proc(5), the state
+	fields := strings.Fields(line[rparen+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("%s: %d fields", file, len(fields)+2)
+	}
+	if fields[0] == "X" {
+		return nil, errExited
+	}
+
+	n := make([]uint64, len(fields))
+	for i, f := range fields[1:20] {
+		// Only the unsigned fields up to starttime are used
+		if v, err := strconv.ParseUint(f, 10, 64); err == nil {
+			n[i+1] = v
+		}
+	}
+	ticks := func(i int) time.Duration { return time.Duration(n[i]) * time.Second / userHZ }
+
+	return &Process{
+		PPID:    int(n[1]),
+		Comm:    line[lparen+1 : rparen],
+		State:   fields[0],
+		Start:   n[19],
+		UTime:   ticks(11) + ticks(13),
+		STime:   ticks(12) + ticks(14),
+		MinFlt:  n[7] + n[8],
+		MajFlt:  n[9] + n[10],
+		Threads: n[17],
+	}, nil
+}
+
+// readKeyedUnits reads lines such as "VmRSS:  16412 kB" or "read_bytes: 0".
+func readKeyedUnits(file string) (map[string]uint64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,196 @@
+package proc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// statLine is a /proc/<pid>/stat line. Every process has waited for
+// children that took 5 minor and 1 major fault, 2 ticks of user and 3 of
+// system time, and started at tick 1000 plus its PID.
+func statLine(pid, ppid int, comm, state string, utime, stime, minflt, majflt, threads uint64) string {
+	return fmt.Sprintf("%d (%s) %s %d %d %d 0 -1 4194304 %d 5 %d 1 %d %d 2 3 20 0 %d 0 %d 123456789 300 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0\n",
+		pid, comm, state, ppid, pid, pid, minflt, majflt, utime, stime, threads, 1000+pid)
+}
+
+func TestReadStat(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"42/stat":   statLine(42, 7, "my worker) (x", "S", 150, 40, 1000, 10, 4),
+		"43/stat":   statLine(43, 7, "reaped", "X", 0, 0, 0, 0, 1),
+		"44/stat":   "44 no name S 7\n",
+		"45/stat":   "45 (short) S 7 45 45\n",
+		"46/status": "not a stat file\n",
+	})
+
+	p, err := readStat(filepath.Join(dir, "42/stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Process{
+		PPID:    7,
+		Comm:    "my worker) (x",
+		State:   "S",
+		Start:   1042,
+		UTime:   1520 * time.Millisecond,
+		STime:   430 * time.Millisecond,
+		MinFlt:  1005,
+		MajFlt:  11,
+		Threads: 4,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("read\n %+v\nwant %+v", p, want)
+	}
+
+	if _, err := readStat(filepath.Join(dir, "43/stat")); !gone(err) {
+		t.Errorf("a dead process read with %v, want it gone", err)
+	}
+	for _, file := range []string{"44/stat", "45/stat"} {
+		if _, err := readStat(filepath.Join(dir, file)); err == nil || gone(err) {
+			t.Errorf("%s read with %v, want it malformed", file, err)
+		}
+	}
+	if _, err := readStat(filepath.Join(dir, "46/stat")); !gone(err) {
+		t.Errorf("a missing stat file read with %v, want it gone", err)
+	}
+}
+
+// fakeProc is a server, 100, with a worker of the same name that has one of
+// its own and a helper that exited after the scan, so has no status, and a
+// zombie worker. There is also a zombie and a dead server at the top, an
+// analytic whose name the kernel truncated and an unrelated process.
+func fakeProc(t *testing.T) string {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"1/stat":      statLine(1, 0, "init", "S", 0, 0, 0, 0, 1),
+		"100/stat":    statLine(100, 1, "server", "S", 100, 50, 1000, 10, 4),
+		"100/status":  "Name:\tserver\nVmRSS:\t    1000 kB\nRssAnon:\t     600 kB\nRssFile:\t     300 kB\nRssShmem:\t     100 kB\n",
+		"100/io":      "rchar: 9999\nread_bytes: 4096\nwrite_bytes: 8192\n",
+		"101/stat":    statLine(101, 100, "server", "R", 200, 20, 300, 0, 2),
+		"101/status":  "Name:\tserver\nVmRSS:\t     500 kB\nRssAnon:\t     400 kB\nRssFile:\t     100 kB\nRssShmem:\t       0 kB\n",
+		"101/io":      "read_bytes: 1000\nwrite_bytes: 0\n",
+		"102/stat":    statLine(102, 101, "server", "S", 10, 10, 100, 2, 1),
+		"102/status":  "Name:\tserver\nVmRSS:\t     200 kB\nRssAnon:\t     200 kB\nRssFile:\t       0 kB\nRssShmem:\t       0 kB\n",
+		"103/stat":    statLine(103, 100, "helper", "S", 500, 500, 500, 5, 1),
+		"104/stat":    statLine(104, 100, "server", "Z", 0, 0, 0, 0, 1),
+		"104/status":  "Name:\tserver\nState:\tZ (zombie)\n",
+		"200/stat":    statLine(200, 1, "server", "Z", 0, 0, 0, 0, 1),
+		"300/stat":    statLine(300, 1, "long-analytic-n", "S", 0, 0, 0, 0, 1),
+		"300/cmdline": "/usr/local/bin/long-analytic-name\x00-freq\x001s\x00",
+		"400/stat":    statLine(400, 1, "other", "S", 0, 0, 0, 0, 1),
+		"500/stat":    statLine(500, 1, "server", "X", 0, 0, 0, 0, 1),
+		"meminfo":     "MemTotal:       16316412 kB\n",
+	})
+	return root
+}
+
+func TestTree(t *testing.T) {
+	table, err := Scan(fakeProc(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Process(500) != nil || table.Process(100) == nil {
+		t.Errorf("scanned %d processes, want the dead one left out", len(table.processes))
+	}
+
+	tests := []struct {
+		pid  int
+		want []int
+	}{
+		{100, []int{100, 101, 103, 104, 102}},
+		{101, []int{101, 102}},
+		{400, []int{400}},
+		{999, nil},
+	}
+	for _, tt := range tests {
+		if got := table.Tree(tt.pid); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tree of %d is %v, want %v", tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestRoots(t *testing.T) {
+	table, err := Scan(fakeProc(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		pids     []int
+		patterns []string
+		want     []int
+	}{
+		{"workers nest under the server", nil, []string{"server"}, []int{100}},
+		{"a worker given with its server", []int{101, 100}, nil, []int{100}},
+		{"a worker given alone", []int{101}, nil, []int{101}},
+		{"zombies and missing processes", []int{104, 200, 999}, nil, nil},
+		{"truncated names match the command line", []int{400}, []string{"serv*", "long-analytic-name"}, []int{100, 300, 400}},
+		{"no match", nil, []string{"nothing"}, nil},
+	}
+	for _, tt := range tests {
+		if got := table.Roots(tt.pids, tt.patterns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: roots %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Read sums the server's tree: the zombie counts as a process with no
+// memory, and the helper that exited after the scan is left out.
+func TestRead(t *testing.T) {
+	table, err := Scan(fakeProc(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := table.Read(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{
+		Time:       table.Time,
+		Procs:      4,
+		Threads:    8,
+		CPUUser:    3180 * time.Millisecond,
+		CPUSystem:  920 * time.Millisecond,
+		PgFault:    1436,
+		PgMajFault: 16,
+		RSS:        1700 * 1024,
+		Anon:       1200 * 1024,
+		File:       400 * 1024,
+		Shmem:      100 * 1024,
+		ReadBytes:  5096,
+		WriteBytes: 8192,
+		IO:         true,
+	}
+	if s != want {
+		t.Errorf("read\n %+v\nwant %+v", s, want)
+	}
+	if s.CPUUsage() != 4100*time.Millisecond {
+		t.Errorf("CPU usage %s, want 4.1s", s.CPUUsage())
+	}
+
+	if _, err := table.Read(103); err == nil {
+		t.Error("read a tree whose only process has exited")
+	}
+	if _, err := table.Read(999); err == nil {
+		t.Error("read a process that is not running")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"dockerstats/cgroup"
+	"dockerstats/discover"
+	"dockerstats/proc"
+	"dockerstats/sample"
+
+	"github.com/rs/zerolog/log"
+)
+
+// procUnread are the columns a process tree has no counters for. Natively
+// run analytics share the host's network namespace, so its traffic is not
+// theirs, and there is no CFS bandwidth limit, kernel or socket memory, or
+// block IO operation count per process.
+var procUnread = []string{
+	"net_rx_bytes", "net_tx_bytes",
+	"periods", "throttled_periods", "throttled_us", "throttled_percent",
+	"mem_kernel_bytes", "mem_sock_bytes", "blk_read_ios", "blk_write_ios",
+}
+
+// process is a followed process tree, identified by its root's PID and
+// start time so a reused PID is not mistaken for it.
+type process struct {
+	pid   int
+	start uint64
+	name  string
+	prev  proc.Stats
+}
+
+// sampleProcs reads the process trees rooted at pids, and at processes whose
+// name matches one of patterns, each interval until ctx is done. Each tree is
+// written with the same schema as a container, its container column being
+// the root's PID and its name the root's name. Trees that appear or exit
+// after the first scan are written as start and die markers, as containers
+// are.
+func sampleProcs(ctx context.Context, root string, pids []int, patterns []string, interval time.Duration, out sample.Writer) error {
+	// Processes are limited by the host's memory
+	hostMemory, err := cgroup.HostMemory(root)
+	if err != nil {
+		log.Error().Err(err).Msg("Error: Could not read host memory")
+	}
+
+	followed := map[int]*process{}
+	first := true
+	warnedIO := map[int]bool{}
+
+	sched := newFixedRate(interval)
+	for {
+		skipped, ok := sched.wait(ctx)
+		if !ok {
+			return nil
+		}
+		if skipped > 0 {
+			log.Warn().Int("skipped", skipped).Dur("interval", interval).Msg("Sampling fell behind, skipped samples")
+		}
+
+		table, err := proc.Scan(root)
+		if err != nil {
+			return err
+		}
+
+		rootList := table.Roots(pids, patterns)
+		roots := map[int]bool{}
+		for _, pid := range rootList {
+			roots[pid] = true
+		}
+
+		for pid, p := range followed {
+			if current := table.Process(pid); roots[pid] && current.Start == p.start {
+				continue
+			}
+			log.Info().Int("pid", pid).Str("process", p.name).Msg("Process exited")
+			if err := out.Write(sample.Sample{Time: table.Time, Container: strconv.Itoa(pid), Name: p.name, Event: discover.Die}); err != nil {
+				return err
+			}
+			delete(followed, pid)
+		}
+
+		for _, pid := range rootList {
+			if followed[pid] != nil {
+				continue
+			}
+			current := table.Process(pid)
+			followed[pid] = &process{pid: pid, start: current.Start, name: current.Comm}
+			log.Info().Int("pid", pid).Str("process", current.Comm).Msg("Sampling process")
+			if first {
+				continue
+			}
+			if err := out.Write(sample.Sample{Time: table.Time, Container: strconv.Itoa(pid), Name: current.Comm, Event: discover.Start}); err != nil {
+				return err
+			}
+		}
+		if first && len(followed) == 0 {
+			log.Info().Ints("pid", pids).Strs("process", patterns).Msg("No selected processes running yet, waiting for them to start")
+		}
+		first = false
+
+		for _, pid := range rootList {
+			p := followed[pid]
+			stats, err := table.Read(pid)
+			if err != nil {
+				// Exited since the scan, which the next scan records
+				continue
+			}
+			if !stats.IO && !warnedIO[pid] {
+				log.Warn().Int("pid", pid).Str("process", p.name).Msg("Could not read the process's IO counters, run as its user or root to sample them")
+				warnedIO[pid] = true
+			}
+			if err := out.Write(procSample(p, stats, hostMemory)); err != nil {
+				return err
+			}
+			p.prev = stats
+		}
+	}
+}
+
+func procSample(p *process, s proc.Stats, hostMemory uint64) sample.Sample {
+	out := sample.Sample{
+		Time:          s.Time,
+		Container:     strconv.Itoa(p.pid),
+		Name:          p.name,
+		MemUsedBytes:  s.RSS,
+		MemLimitBytes: hostMemory,
+		BlkReadBytes:  s.ReadBytes,
+		BlkWriteBytes: s.WriteBytes,
+		Pids:          s.Threads,
+		Counters: &sample.Counters{
+			CPUTotal:  s.CPUUsage(),
+			CPUUser:   s.CPUUser,
+			CPUSystem: s.CPUSystem,
+		},
+		Memory: &sample.Memory{
+			Anon:       s.Anon,
+			File:       s.File,
+			Shmem:      s.Shmem,
+			PgFault:    s.PgFault,
+			PgMajFault: s.PgMajFault,
+		},
+		Unread: procUnread,
+	}
+	if !s.IO {
+		out.Unread = append(append([]string(nil), procUnread...), "blk_read_bytes", "blk_write_bytes")
+	}
+
+	// CPU is over the time since the previous sample, so is zero on the
+	// first, and a tree that lost an unwaited-for child reads as idle
+	if !p.prev.Time.IsZero() {
+		if seconds := s.Time.Sub(p.prev.Time).Seconds(); seconds > 0 && s.CPUUsage() >= p.prev.CPUUsage() {
+			out.CPUPercent = (s.CPUUsage() - p.prev.CPUUsage()).Seconds() / seconds * 100
+		}
+	}
+	return out
+}
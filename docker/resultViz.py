@@ -1,11 +1,29 @@
 import pandas as pd
 import matplotlib.pyplot as plt
 
+IO_COLUMNS = ['net_rx_bytes', 'net_tx_bytes', 'blk_read_bytes', 'blk_write_bytes']
+
 def read_docker_stats_csv(file_path):
-    column_names = ['Container', 'Name', 'CPU %', 'Mem Usage', 'Net I/O', 'Block I/O', 'Mem %', 'PIDs', 'start', 'end']
-    df = pd.read_csv(file_path, names=column_names, skiprows=1)
-    df['CPU %'] = df['CPU %'].str.rstrip('%').astype('float')
-    df['Mem %'] = df['Mem %'].str.rstrip('%').astype('float')
+    with open(file_path) as f:
+        first_line = f.readline()
+
+    if first_line.startswith('# dockerstats schema'):
+        # Numeric columns, stamped in milliseconds when each sample was read
+        df = pd.read_csv(file_path, comment='#')
+        if 'event' in df.columns:
+            # Lifecycle markers (start, stop, restart) carry no measurements
+            df = df[df['event'].isna()].copy()
+        df = df.rename(columns={'container': 'Container', 'name': 'Name', 'cpu_percent': 'CPU %'})
+        df['Mem %'] = df['mem_used_bytes'] / df['mem_limit_bytes'] * 100
+        df['start'] = df['time_ms'] / 1000
+        df['end'] = df['start']
+    else:
+        # Files written before the schema was versioned
+        column_names = ['Container', 'Name', 'CPU %', 'Mem Usage', 'Net I/O', 'Block I/O', 'Mem %', 'PIDs', 'start', 'end']
+        df = pd.read_csv(file_path, names=column_names, skiprows=1)
+        df['CPU %'] = df['CPU %'].str.rstrip('%').astype('float')
+        df['Mem %'] = df['Mem %'].str.rstrip('%').astype('float')
+
     df['Time'] = (df['start'] + df['end']) / 2
     return df
 
@@ -102,6 +120,30 @@ def plot_memory_usage_rolling_avg(datasets: list, container_name: str, window_si
     plt.savefig(f'{container_name}_memory_usage_rolling_avg_comparison.png')
 
 
+def plot_io_usage(datasets: list, container_name: str):
+
+    plt.figure()
+
+    for dataset in datasets:
+        df = dataset[0]
+        n_c = dataset[1]
+        e_c = dataset[2]
+        min_time = dataset[3]
+        if not set(IO_COLUMNS).issubset(df.columns):
+            continue
+        container_df = df[df['Name'] == container_name]
+        for column in IO_COLUMNS:
+            plt.plot(container_df['Time'] - min_time, container_df[column] / 2**20, label=f"{n_c} Nodes, {e_c} Edges {column}", alpha = .5)
+
+    plt.xlabel('Time (s)')
+    plt.ylabel('Cumulative IO (MiB)')
+    plt.title(f'{container_name} - Docker Network and Block IO')
+    plt.legend()
+    plt.xticks(rotation=45)
+    plt.tight_layout()
+    plt.savefig(f'{container_name}_io_comparison.png')
+
+
 def calculate_second_half_average(datasets: list, container_name):
 
     for dataset in datasets:
@@ -175,9 +217,10 @@ def main():
         plot_memory_usage(datasets, container_name)
         plot_cpu_usage_rolling_avg(datasets, container_name)
         plot_memory_usage_rolling_avg(datasets, container_name)
+        plot_io_usage(datasets, container_name)
         calculate_second_half_average(datasets, container_name)
 
-    print("Graphs saved for each container as [container_name]_cpu_usage_comparison.png, [container_name]_memory_usage_comparison.png, [container_name]_cpu_usage_rolling_avg_comparison.png, and [container_name]_memory_usage_rolling_avg_comparison.png")
+    print("Graphs saved for each container as [container_name]_cpu_usage_comparison.png, [container_name]_memory_usage_comparison.png, [container_name]_cpu_usage_rolling_avg_comparison.png, [container_name]_memory_usage_rolling_avg_comparison.png, and [container_name]_io_comparison.png")
 if __name__ == "__main__":
     main()
 
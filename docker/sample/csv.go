@@ -0,0 +1,52 @@
+package sample
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CSVWriter writes samples as CSV, starting with a "# dockerstats schema N"
+// line and the header.
+type CSVWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	csv *csv.Writer
+}
+
+// NewCSVWriter writes the schema line and header straight away, so a run
+// that ends before its first sample still leaves a file that reads back as
+// empty.
+func NewCSVWriter(w io.Writer) (*CSVWriter, error) {
+	c := &CSVWriter{w: w, csv: csv.NewWriter(w)}
+	if _, err := fmt.Fprintf(w, "# dockerstats schema %d\n", Version); err != nil {
+		return nil, err
+	}
+	if err := c.flush(Header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write writes one sample and flushes it, so the file can be followed while
+// sampling runs.
+func (c *CSVWriter) Write(s Sample) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush(s.Record())
+}
+
+func (c *CSVWriter) flush(record []string) error {
+	if err := c.csv.Write(record); err != nil {
+		return err
+	}
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+func (c *CSVWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return closeUnderlying(c.w)
+}
@@ -0,0 +1,71 @@
+package sample
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A run that ends before its first sample still leaves a CSV file with the
+// schema line and header, which reads back as no samples.
+func TestCSVWithoutSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.csv")
+	w, err := Open(path, FormatCSV, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# dockerstats schema 3\n" + strings.Join(Header, ",") + "\n"
+	if string(data) != want {
+		t.Errorf("got file %q, want %q", data, want)
+	}
+
+	samples, err := ReadFile(path)
+	if err != nil || len(samples) != 0 {
+		t.Errorf("read %d samples and %v from an empty run", len(samples), err)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.csv")
+	w, err := Open(path, FormatCSV, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.UnixMilli(1700000000123)
+	written := []Sample{
+		{Time: at, Container: "abc", Name: "exp-a", Event: "start"},
+		{Time: at.Add(time.Second), Container: "abc", Name: "exp-a", CPUPercent: 150.5, MemUsedBytes: 1 << 20, MemLimitBytes: 1 << 30, Pids: 4},
+	}
+	for _, s := range written {
+		if err := w.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("read %d samples, want 2", len(samples))
+	}
+	if s := samples[0]; s.Event != "start" || s.Name != "exp-a" || !s.Time.Equal(at) {
+		t.Errorf("read marker %+v", s)
+	}
+	if s := samples[1]; s.CPUPercent != 150.5 || s.MemUsedBytes != 1<<20 || s.MemLimitBytes != 1<<30 || s.Pids != 4 {
+		t.Errorf("read sample %+v", s)
+	}
+}
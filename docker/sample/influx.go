@@ -0,0 +1,186 @@
+package sample
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Measurements written in line protocol. Samples go to docker_stats and
+// lifecycle markers to docker_events, tagged by container id and name.
+const (
+	InfluxMeasurement = "docker_stats"
+	InfluxEvents      = "docker_events"
+)
+
+// Line is the sample in InfluxDB line protocol with a nanosecond timestamp,
+// without the trailing newline. Counts are integer fields and rates floats.
+func Line(s Sample) string {
+	var b strings.Builder
+
+	measurement := InfluxMeasurement
+	if s.Event != "" {
+		measurement = InfluxEvents
+	}
+	b.WriteString(measurement)
+	b.WriteString(",container=" + escapeTag(s.Container))
+	b.WriteString(",name=" + escapeTag(s.Name))
+
+	sep := " "
+	field := func(key, value string) {
+		b.WriteString(sep + key + "=" + value)
+		sep = ","
+	}
+
+	if s.Event != "" {
+		field("event", `"`+escapeString(s.Event)+`"`)
+	} else {
+		field("schema", strconv.Itoa(Version)+"i")
+		// Numeric columns follow the three identifying ones
+		record := s.Record()
+		for i := 3; i < len(record)-1; i++ {
+			value := record[i]
+			if value == "" {
+				continue
+			}
+			if !strings.Contains(value, ".") {
+				value += "i"
+			}
+			field(Header[i], value)
+		}
+	}
+
+	b.WriteString(" " + strconv.FormatInt(s.Time.UnixNano(), 10))
+	return b.String()
+}
+
+var (
+	tagEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+func escapeTag(s string) string {
+	if s == "" {
+		// Empty tag values are not allowed
+		return "-"
+	}
+	return tagEscaper.Replace(s)
+}
+
+func escapeString(s string) string {
+	return stringEscaper.Replace(s)
+}
+
+// InfluxWriter writes line protocol to a file.
+type InfluxWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewInfluxWriter(w io.Writer) *InfluxWriter {
+	return &InfluxWriter{w: w}
+}
+
+func (i *InfluxWriter) Write(s Sample) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, err := io.WriteString(i.w, Line(s)+"\n")
+	return err
+}
+
+func (i *InfluxWriter) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return closeUnderlying(i.w)
+}
+
+// influxBatch is the most lines sent in one request.
+const influxBatch = 5000
+
+// InfluxHTTPWriter sends line protocol to an InfluxDB write endpoint, v1
+// /write or v2 /api/v2/write, in batches at least every flush interval. The
+// URL carries the database or org and bucket, and should ask for
+// precision=ns or leave precision to its nanosecond default.
+type InfluxHTTPWriter struct {
+	url   string
+	token string
+	flush time.Duration
+	http  *http.Client
+
+	mu        sync.Mutex
+	batch     bytes.Buffer
+	lines     int
+	lastFlush time.Time
+}
+
+func NewInfluxHTTPWriter(url string, opts Options) *InfluxHTTPWriter {
+	flush := opts.InfluxFlush
+	if flush <= 0 {
+		flush = time.Second
+	}
+	return &InfluxHTTPWriter{
+		url:       url,
+		token:     opts.InfluxToken,
+		flush:     flush,
+		http:      &http.Client{Timeout: 10 * time.Second},
+		lastFlush: time.Now(),
+	}
+}
+
+func (i *InfluxHTTPWriter) Write(s Sample) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.batch.WriteString(Line(s) + "\n")
+	i.lines++
+	if i.lines >= influxBatch || time.Since(i.lastFlush) >= i.flush {
+		return i.send()
+	}
+	return nil
+}
+
+func (i *InfluxHTTPWriter) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.send()
+}
+
+// send posts the batch. A failed batch is dropped so one outage does not
+// grow the buffer without bound, and the error is returned.
+func (i *InfluxHTTPWriter) send() error {
+	i.lastFlush = time.Now()
+	if i.lines == 0 {
+		return nil
+	}
+	lines := i.lines
+	body := bytes.NewReader(i.batch.Bytes())
+	defer func() {
+		i.batch.Reset()
+		i.lines = 0
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, i.url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.token != "" {
+		req.Header.Set("Authorization", "Token "+i.token)
+	}
+
+	resp, err := i.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending %d lines to InfluxDB: %v", lines, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sending %d lines to InfluxDB: %s: %s", lines, resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package sample
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLine(t *testing.T) {
+	at := time.Unix(1700000000, 123456789)
+	tests := []struct {
+		name string
+		in   Sample
+		want string
+	}{
+		{
+			"marker with escaping",
+			Sample{Time: at, Container: "abc", Name: `exp a,b=c`, Event: `die "x" \`},
+			`docker_events,container=abc,name=exp\ a\,b\=c event="die \"x\" \\" 1700000000123456789`,
+		},
+		{
+			"marker without a container",
+			Sample{Time: at, Name: "exp-a", Event: "start"},
+			`docker_events,container=-,name=exp-a event="start" 1700000000123456789`,
+		},
+		{
+			"sample",
+			Sample{Time: at, Container: "abc", Name: "exp-a", CPUPercent: 150.5, MemUsedBytes: 1 << 20, MemLimitBytes: 1 << 30, NetRxBytes: 10, NetTxBytes: 20, Pids: 4},
+			"docker_stats,container=abc,name=exp-a schema=3i,cpu_percent=150.5000,mem_used_bytes=1048576i,mem_limit_bytes=1073741824i,net_rx_bytes=10i,net_tx_bytes=20i,blk_read_bytes=0i,blk_write_bytes=0i,pids=4i 1700000000123456789",
+		},
+		{
+			"counters and unread columns",
+			Sample{
+				Time: at, Container: "123", Name: "worker", CPUPercent: 2, Pids: 1,
+				Counters: &Counters{CPUTotal: 1500 * time.Microsecond, CPUUser: time.Millisecond, CPUSystem: 500 * time.Microsecond, Periods: 10, ThrottledPeriods: 1, ThrottledTime: 2 * time.Millisecond, ThrottledPercent: 12.5},
+				Unread:   []string{"net_rx_bytes", "net_tx_bytes"},
+			},
+			"docker_stats,container=123,name=worker schema=3i,cpu_percent=2.0000,mem_used_bytes=0i,mem_limit_bytes=0i,blk_read_bytes=0i,blk_write_bytes=0i,pids=1i," +
+				"cpu_total_us=1500i,cpu_user_us=1000i,cpu_system_us=500i,periods=10i,throttled_periods=1i,throttled_us=2000i,throttled_percent=12.5000 1700000000123456789",
+		},
+	}
+	for _, tt := range tests {
+		if got := Line(tt.in); got != tt.want {
+			t.Errorf("%s\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// fakeInflux records the bodies of the writes it is sent, answering each
+// with status.
+type fakeInflux struct {
+	mu     sync.Mutex
+	status int
+	auth   []string
+	bodies []string
+}
+
+func (f *fakeInflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	f.bodies = append(f.bodies, string(body))
+	if f.status != 0 {
+		http.Error(w, "partial write: field type conflict", f.status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeInflux) lines() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var lines []int
+	for _, body := range f.bodies {
+		lines = append(lines, strings.Count(body, "\n"))
+	}
+	return lines
+}
+
+func testSample(i int) Sample {
+	return Sample{Time: time.Unix(1700000000, int64(i)), Container: "abc", Name: "exp-a", Pids: uint64(i)}
+}
+
+// Samples are held until a batch fills or Close, and the batch is sent as
+// one request of whole lines with the token.
+func TestInfluxHTTPBatches(t *testing.T) {
+	fake := &fakeInflux{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	w := NewInfluxHTTPWriter(server.URL+"/api/v2/write?org=lab&bucket=soak", Options{InfluxToken: "secret", InfluxFlush: time.Hour})
+
+	for i := 0; i < influxBatch-1; i++ {
+		if err := w.Write(testSample(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.lines(); len(got) != 0 {
+		t.Fatalf("sent %v lines before the batch filled", got)
+	}
+	for i := influxBatch - 1; i < influxBatch+2; i++ {
+		if err := w.Write(testSample(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fake.lines(); len(got) != 1 || got[0] != influxBatch {
+		t.Fatalf("sent %v lines, want one full batch", got)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.lines(); len(got) != 2 || got[1] != 2 {
+		t.Fatalf("sent %v lines, want the two left over on Close", got)
+	}
+
+	if first := strings.SplitN(fake.bodies[0], "\n", 2)[0]; first != Line(testSample(0)) {
+		t.Errorf("first line sent %q, want %q", first, Line(testSample(0)))
+	}
+	if fake.auth[0] != "Token secret" {
+		t.Errorf("sent authorization %q", fake.auth[0])
+	}
+}
+
+// A batch held longer than the flush interval is sent with the next write.
+func TestInfluxHTTPFlushInterval(t *testing.T) {
+	fake := &fakeInflux{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	w := NewInfluxHTTPWriter(server.URL+"/write?db=soak", Options{InfluxFlush: 20 * time.Millisecond})
+
+	if err := w.Write(testSample(0)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := w.Write(testSample(1)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.lines(); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("sent %v lines, want both once the interval passed", got)
+	}
+	if fake.auth[0] != "" {
+		t.Errorf("sent authorization %q without a token", fake.auth[0])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.lines(); len(got) != 1 {
+		t.Errorf("sent %v lines, want nothing more on Close", got)
+	}
+}
+
+// A rejected batch returns InfluxDB's message and is dropped, not resent.
+func TestInfluxHTTPRejected(t *testing.T) {
+	fake := &fakeInflux{status: http.StatusBadRequest}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	w := NewInfluxHTTPWriter(server.URL+"/write?db=soak", Options{InfluxFlush: time.Hour})
+
+	if err := w.Write(testSample(0)); err != nil {
+		t.Fatal(err)
+	}
+	err := w.Close()
+	if err == nil || !strings.Contains(err.Error(), "field type conflict") || !strings.Contains(err.Error(), "1 lines") {
+		t.Fatalf("a rejected batch returned %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("closing again returned %v, want the batch dropped", err)
+	}
+	if got := fake.lines(); len(got) != 1 {
+		t.Errorf("sent %v lines, want the batch sent once", got)
+	}
+}
@@ -0,0 +1,58 @@
+package sample
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// textColumns are the columns written as JSON strings rather than numbers.
+var textColumns = map[string]bool{"container": true, "name": true, "event": true}
+
+// JSONLWriter writes a JSON object per line, with the CSV column names as
+// keys plus the schema version. Columns the source could not read are left
+// out.
+type JSONLWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	return &JSONLWriter{w: w}
+}
+
+func (j *JSONLWriter) Write(s Sample) error {
+	var line bytes.Buffer
+	line.WriteString(`{"schema":`)
+	line.WriteString(strconv.Itoa(Version))
+
+	for i, value := range s.Record() {
+		if value == "" {
+			continue
+		}
+		line.WriteString(`,"` + Header[i] + `":`)
+		if textColumns[Header[i]] {
+			quoted, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			line.Write(quoted)
+		} else {
+			line.WriteString(value)
+		}
+	}
+	line.WriteString("}\n")
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err := j.w.Write(line.Bytes())
+	return err
+}
+
+func (j *JSONLWriter) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return closeUnderlying(j.w)
+}
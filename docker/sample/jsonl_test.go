@@ -0,0 +1,61 @@
+package sample
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Samples written as JSON lines read back as they were, to the millisecond
+// and microsecond the columns hold, with unread columns still unread.
+func TestJSONLRoundTrip(t *testing.T) {
+	at := time.UnixMilli(1700000000123)
+	written := []Sample{
+		{Time: at, Container: "abc", Name: `exp "a" \ b`, Event: "die"},
+		{
+			Time: at.Add(time.Second), Container: "abc", Name: "exp-a",
+			CPUPercent: 150.25, MemUsedBytes: 1 << 20, MemLimitBytes: 1 << 30,
+			NetRxBytes: 1200, NetTxBytes: 3400, BlkReadBytes: 4096, BlkWriteBytes: 8192, Pids: 4,
+			Counters: &Counters{CPUTotal: 1500 * time.Microsecond, CPUUser: time.Millisecond, CPUSystem: 500 * time.Microsecond, Periods: 10, ThrottledPeriods: 1, ThrottledTime: 2 * time.Millisecond, ThrottledPercent: 12.5},
+			Memory:   &Memory{Anon: 1 << 19, File: 1 << 18, Kernel: 4096, Sock: 512, Shmem: 256, PgFault: 100, PgMajFault: 2, ReadIOs: 7, WriteIOs: 9},
+		},
+		{
+			Time: at.Add(2 * time.Second), Container: "123", Name: "worker",
+			CPUPercent: 99.5, MemUsedBytes: 1 << 21, BlkReadBytes: 10, Pids: 1,
+			Unread: []string{"net_rx_bytes", "net_tx_bytes"},
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewJSONLWriter(&buf)
+	for _, s := range written {
+		if err := w.Write(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&buf, FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range written {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("sample %d\n got %+v\nwant %+v", i, got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("read %v after the last sample, want EOF", err)
+	}
+	if r.Version != Version {
+		t.Errorf("read schema %d, want %d", r.Version, Version)
+	}
+}
@@ -0,0 +1,131 @@
+package sample
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetRow is a sample as a Parquet row, with the CSV column names.
+// Columns a source could not read are null.
+type parquetRow struct {
+	Container string `parquet:"name=container, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Name      string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Time      int64  `parquet:"name=time_ms, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+
+	CPUPercent    *float64 `parquet:"name=cpu_percent, type=DOUBLE, repetitiontype=OPTIONAL"`
+	MemUsedBytes  *int64   `parquet:"name=mem_used_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	MemLimitBytes *int64   `parquet:"name=mem_limit_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	NetRxBytes    *int64   `parquet:"name=net_rx_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	NetTxBytes    *int64   `parquet:"name=net_tx_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	BlkReadBytes  *int64   `parquet:"name=blk_read_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	BlkWriteBytes *int64   `parquet:"name=blk_write_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	Pids          *int64   `parquet:"name=pids, type=INT64, repetitiontype=OPTIONAL"`
+
+	CPUTotalUS       *int64   `parquet:"name=cpu_total_us, type=INT64, repetitiontype=OPTIONAL"`
+	CPUUserUS        *int64   `parquet:"name=cpu_user_us, type=INT64, repetitiontype=OPTIONAL"`
+	CPUSystemUS      *int64   `parquet:"name=cpu_system_us, type=INT64, repetitiontype=OPTIONAL"`
+	Periods          *int64   `parquet:"name=periods, type=INT64, repetitiontype=OPTIONAL"`
+	ThrottledPeriods *int64   `parquet:"name=throttled_periods, type=INT64, repetitiontype=OPTIONAL"`
+	ThrottledUS      *int64   `parquet:"name=throttled_us, type=INT64, repetitiontype=OPTIONAL"`
+	ThrottledPercent *float64 `parquet:"name=throttled_percent, type=DOUBLE, repetitiontype=OPTIONAL"`
+
+	MemAnonBytes   *int64 `parquet:"name=mem_anon_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	MemFileBytes   *int64 `parquet:"name=mem_file_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	MemKernelBytes *int64 `parquet:"name=mem_kernel_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	MemSockBytes   *int64 `parquet:"name=mem_sock_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	MemShmemBytes  *int64 `parquet:"name=mem_shmem_bytes, type=INT64, repetitiontype=OPTIONAL"`
+	PgFault        *int64 `parquet:"name=pgfault, type=INT64, repetitiontype=OPTIONAL"`
+	PgMajFault     *int64 `parquet:"name=pgmajfault, type=INT64, repetitiontype=OPTIONAL"`
+	BlkReadIOs     *int64 `parquet:"name=blk_read_ios, type=INT64, repetitiontype=OPTIONAL"`
+	BlkWriteIOs    *int64 `parquet:"name=blk_write_ios, type=INT64, repetitiontype=OPTIONAL"`
+
+	Event *string `parquet:"name=event, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// newParquetRow fills the row from the sample's CSV record, so Parquet
+// leaves out exactly the columns CSV leaves empty. The row's fields are in
+// Header order.
+func newParquetRow(s Sample) (parquetRow, error) {
+	row := parquetRow{Container: s.Container, Name: s.Name, Time: s.Time.UnixMilli()}
+	if s.Event != "" {
+		row.Event = &s.Event
+		return row, nil
+	}
+
+	fields := reflect.ValueOf(&row).Elem()
+	record := s.Record()
+	for i := 3; i < len(record)-1; i++ {
+		if record[i] == "" {
+			continue
+		}
+		field := fields.Field(i)
+		switch field.Type().Elem().Kind() {
+		case reflect.Float64:
+			v, err := strconv.ParseFloat(record[i], 64)
+			if err != nil {
+				return row, fmt.Errorf("%s: %v", Header[i], err)
+			}
+			field.Set(reflect.ValueOf(&v))
+		default:
+			v, err := strconv.ParseInt(record[i], 10, 64)
+			if err != nil {
+				return row, fmt.Errorf("%s: %v", Header[i], err)
+			}
+			field.Set(reflect.ValueOf(&v))
+		}
+	}
+	return row, nil
+}
+
+// parquetRowGroup bounds how much is held in memory before a row group is
+// written out.
+const parquetRowGroup = 8 << 20
+
+// ParquetWriter writes samples to a Parquet file, recording the schema
+// version in the file's key-value metadata. The file is only readable once
+// the writer is closed.
+type ParquetWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	pw *writer.ParquetWriter
+}
+
+func NewParquetWriter(w io.Writer) (*ParquetWriter, error) {
+	pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRow), 1)
+	if err != nil {
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroup
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	version := strconv.Itoa(Version)
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{Key: "dockerstats.schema", Value: &version})
+
+	return &ParquetWriter{w: w, pw: pw}, nil
+}
+
+func (p *ParquetWriter) Write(s Sample) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	row, err := newParquetRow(s)
+	if err != nil {
+		return err
+	}
+	return p.pw.Write(row)
+}
+
+func (p *ParquetWriter) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.pw.WriteStop(); err != nil {
+		closeUnderlying(p.w)
+		return err
+	}
+	return closeUnderlying(p.w)
+}
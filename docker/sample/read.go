@@ -0,0 +1,255 @@
+package sample
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader reads samples back from CSV or JSON lines written by dockerstats.
+// It only returns whole lines, so a file still being written can be read
+// again after io.EOF for the samples appended since.
+type Reader struct {
+	r       *bufio.Reader
+	format  string
+	partial []byte
+	columns []string
+
+	// Version is the schema the file declares, once it has been read
+	Version int
+}
+
+// NewReader reads samples in format, which is csv or jsonl, from r.
+func NewReader(r io.Reader, format string) (*Reader, error) {
+	if format != FormatCSV && format != FormatJSONL {
+		return nil, fmt.Errorf("cannot read %s samples, only csv and jsonl", format)
+	}
+	return &Reader{r: bufio.NewReader(r), format: format}, nil
+}
+
+// ReadFile reads every sample in the file at path, which is named for its
+// format.
+func ReadFile(path string) ([]Sample, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := NewReader(file, format)
+	if err != nil {
+		return nil, err
+	}
+	var samples []Sample
+	for {
+		s, err := r.Read()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, fmt.Errorf("%s: %v", path, err)
+		}
+		samples = append(samples, s)
+	}
+}
+
+// Read returns the next sample, or io.EOF when there is no whole line left.
+func (r *Reader) Read() (Sample, error) {
+	for {
+		line, err := r.line()
+		if err != nil {
+			return Sample{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var values map[string]string
+		switch r.format {
+		case FormatCSV:
+			values, err = r.csvValues(line)
+		default:
+			values, err = r.jsonValues(line)
+		}
+		if err != nil {
+			return Sample{}, err
+		}
+		if values == nil {
+			// The schema line or header
+			continue
+		}
+		return fromValues(values)
+	}
+}
+
+// line is the next whole line without its newline. A line cut short by EOF
+// is held until the rest of it is appended.
+func (r *Reader) line() ([]byte, error) {
+	chunk, err := r.r.ReadBytes('\n')
+	r.partial = append(r.partial, chunk...)
+	if err != nil {
+		return nil, err
+	}
+	line := bytes.TrimRight(r.partial, "\r\n")
+	r.partial = nil
+	return line, nil
+}
+
+func (r *Reader) csvValues(line []byte) (map[string]string, error) {
+	if version, ok := schemaLine(line); ok {
+		r.Version = version
+		return nil, nil
+	}
+
+	record, err := csv.NewReader(bytes.NewReader(line)).Read()
+	if err != nil {
+		return nil, err
+	}
+	if r.columns == nil {
+		if !contains(record, "container") || !contains(record, "time_ms") {
+			return nil, errors.New("not a dockerstats schema file, the header has no container and time_ms columns")
+		}
+		r.columns = record
+		return nil, nil
+	}
+	if len(record) != len(r.columns) {
+		return nil, fmt.Errorf("%d fields for %d columns", len(record), len(r.columns))
+	}
+
+	values := make(map[string]string, len(record))
+	for i, v := range record {
+		values[r.columns[i]] = v
+	}
+	return values, nil
+}
+
+func (r *Reader) jsonValues(line []byte) (map[string]string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(line, &object); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(object))
+	for k, raw := range object {
+		if k == "schema" {
+			r.Version, _ = strconv.Atoi(string(raw))
+			continue
+		}
+		if textColumns[k] {
+			var text string
+			if err := json.Unmarshal(raw, &text); err != nil {
+				return nil, fmt.Errorf("%s: %v", k, err)
+			}
+			values[k] = text
+		} else {
+			values[k] = string(raw)
+		}
+	}
+	return values, nil
+}
+
+// schemaLine reads the "# dockerstats schema N" line.
+func schemaLine(line []byte) (int, bool) {
+	const prefix = "# dockerstats schema "
+	if !strings.HasPrefix(string(line), prefix) {
+		return 0, false
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(line[len(prefix):])))
+	return version, err == nil
+}
+
+// fromValues builds a sample from its columns by name, the inverse of
+// Record. Columns that are missing or empty are listed in Unread, and the
+// counters and memory breakdown are only set when the file has them.
+func fromValues(values map[string]string) (Sample, error) {
+	ms, err := strconv.ParseInt(values["time_ms"], 10, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("time_ms: %v", err)
+	}
+	s := Sample{Time: time.UnixMilli(ms), Container: values["container"], Name: values["name"], Event: values["event"]}
+	if s.Event != "" {
+		return s, nil
+	}
+
+	var parseErr error
+	u := func(column string) uint64 {
+		v := values[column]
+		if v == "" {
+			s.Unread = append(s.Unread, column)
+			return 0
+		}
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil && parseErr == nil {
+			parseErr = fmt.Errorf("%s: %v", column, err)
+		}
+		return n
+	}
+	f := func(column string) float64 {
+		v := values[column]
+		if v == "" {
+			s.Unread = append(s.Unread, column)
+			return 0
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil && parseErr == nil {
+			parseErr = fmt.Errorf("%s: %v", column, err)
+		}
+		return n
+	}
+	us := func(column string) time.Duration {
+		return time.Duration(u(column)) * time.Microsecond
+	}
+
+	s.CPUPercent = f("cpu_percent")
+	s.MemUsedBytes, s.MemLimitBytes = u("mem_used_bytes"), u("mem_limit_bytes")
+	s.NetRxBytes, s.NetTxBytes = u("net_rx_bytes"), u("net_tx_bytes")
+	s.BlkReadBytes, s.BlkWriteBytes = u("blk_read_bytes"), u("blk_write_bytes")
+	s.Pids = u("pids")
+
+	if values["cpu_total_us"] != "" {
+		s.Counters = &Counters{
+			CPUTotal:         us("cpu_total_us"),
+			CPUUser:          us("cpu_user_us"),
+			CPUSystem:        us("cpu_system_us"),
+			Periods:          u("periods"),
+			ThrottledPeriods: u("throttled_periods"),
+			ThrottledTime:    us("throttled_us"),
+			ThrottledPercent: f("throttled_percent"),
+		}
+	}
+	if values["mem_anon_bytes"] != "" {
+		s.Memory = &Memory{
+			Anon:       u("mem_anon_bytes"),
+			File:       u("mem_file_bytes"),
+			Kernel:     u("mem_kernel_bytes"),
+			Sock:       u("mem_sock_bytes"),
+			Shmem:      u("mem_shmem_bytes"),
+			PgFault:    u("pgfault"),
+			PgMajFault: u("pgmajfault"),
+			ReadIOs:    u("blk_read_ios"),
+			WriteIOs:   u("blk_write_ios"),
+		}
+	}
+	return s, parseErr
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
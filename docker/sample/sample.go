@@ -0,0 +1,142 @@
+// Package sample is the record every dockerstats source produces, whether it
+// scrapes the docker CLI, streams the Engine API or reads cgroup files, and
+// the versioned CSV it is written as.
+package sample
+
+import (
+	"strconv"
+	"time"
+)
+
+// Version is the schema version written at the head of every file. It goes
+// up whenever a column is added, removed or changes meaning.
+const Version = 3
+
+// Sample is the resource use of one container at one moment. CPU and memory
+// percentages follow docker stats, where 100% CPU is one whole core.
+//
+// A sample with an Event is a lifecycle marker instead, recording that the
+// container started, stopped or restarted at Time, and carries no
+// measurements.
+type Sample struct {
+	Time      time.Time
+	Container string
+	Name      string
+	Event     string
+
+	CPUPercent    float64
+	MemUsedBytes  uint64
+	MemLimitBytes uint64
+	NetRxBytes    uint64
+	NetTxBytes    uint64
+	BlkReadBytes  uint64
+	BlkWriteBytes uint64
+	Pids          uint64
+
+	// Counters holds cumulative CPU and throttling counters, which only the
+	// api and cgroup sources can read
+	Counters *Counters
+	// Memory holds the cgroup memory breakdown and fault and IO operation
+	// counts, which the cgroup and proc sources can read
+	Memory *Memory
+
+	// Unread names columns the source has no reading for, which are left
+	// empty rather than written as zero. The proc source, for one, has no
+	// network or throttling counters for a process
+	Unread []string
+}
+
+// Counters are cumulative CPU times and CFS throttling counts.
+type Counters struct {
+	CPUTotal         time.Duration
+	CPUUser          time.Duration
+	CPUSystem        time.Duration
+	Periods          uint64
+	ThrottledPeriods uint64
+	ThrottledTime    time.Duration
+	// ThrottledPercent is the share of enforcement periods throttled since
+	// the previous sample
+	ThrottledPercent float64
+}
+
+// Memory is a cgroup's memory.stat breakdown with its fault and IO counts.
+type Memory struct {
+	Anon       uint64
+	File       uint64
+	Kernel     uint64
+	Sock       uint64
+	Shmem      uint64
+	PgFault    uint64
+	PgMajFault uint64
+	ReadIOs    uint64
+	WriteIOs   uint64
+}
+
+// MemPercent is the memory used as a percentage of the limit.
+func (s Sample) MemPercent() float64 {
+	if s.MemLimitBytes == 0 {
+		return 0
+	}
+	return float64(s.MemUsedBytes) / float64(s.MemLimitBytes) * 100
+}
+
+// Header names the CSV columns in the order Record writes them.
+var Header = []string{
+	"container", "name", "time_ms",
+	"cpu_percent", "mem_used_bytes", "mem_limit_bytes",
+	"net_rx_bytes", "net_tx_bytes", "blk_read_bytes", "blk_write_bytes", "pids",
+	"cpu_total_us", "cpu_user_us", "cpu_system_us", "periods", "throttled_periods", "throttled_us", "throttled_percent",
+	"mem_anon_bytes", "mem_file_bytes", "mem_kernel_bytes", "mem_sock_bytes", "mem_shmem_bytes",
+	"pgfault", "pgmajfault", "blk_read_ios", "blk_write_ios",
+	"event",
+}
+
+// column is the index of each column in Header.
+var column = func() map[string]int {
+	index := make(map[string]int, len(Header))
+	for i, name := range Header {
+		index[name] = i
+	}
+	return index
+}()
+
+// Record is the sample as CSV fields. Columns the source could not read are
+// left empty rather than written as zero.
+func (s Sample) Record() []string {
+	u := func(v uint64) string { return strconv.FormatUint(v, 10) }
+	us := func(d time.Duration) string { return strconv.FormatInt(d.Microseconds(), 10) }
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+
+	if s.Event != "" {
+		record := make([]string, len(Header))
+		record[0], record[1], record[2] = s.Container, s.Name, strconv.FormatInt(s.Time.UnixMilli(), 10)
+		record[len(record)-1] = s.Event
+		return record
+	}
+
+	record := []string{
+		s.Container, s.Name, strconv.FormatInt(s.Time.UnixMilli(), 10),
+		f(s.CPUPercent), u(s.MemUsedBytes), u(s.MemLimitBytes),
+		u(s.NetRxBytes), u(s.NetTxBytes), u(s.BlkReadBytes), u(s.BlkWriteBytes), u(s.Pids),
+	}
+
+	if c := s.Counters; c != nil {
+		record = append(record, us(c.CPUTotal), us(c.CPUUser), us(c.CPUSystem), u(c.Periods), u(c.ThrottledPeriods), us(c.ThrottledTime), f(c.ThrottledPercent))
+	} else {
+		record = append(record, make([]string, 7)...)
+	}
+
+	if m := s.Memory; m != nil {
+		record = append(record, u(m.Anon), u(m.File), u(m.Kernel), u(m.Sock), u(m.Shmem), u(m.PgFault), u(m.PgMajFault), u(m.ReadIOs), u(m.WriteIOs))
+	} else {
+		record = append(record, make([]string, 9)...)
+	}
+
+	for _, name := range s.Unread {
+		if i, ok := column[name]; ok && i < len(record) {
+			record[i] = ""
+		}
+	}
+
+	return append(record, "")
+}
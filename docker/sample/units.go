@@ -0,0 +1,74 @@
+package sample
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Unit multipliers as the docker CLI prints them: binary units for memory
+// and decimal units for network and block IO.
+var units = map[string]float64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+// ParseBytes reads a size such as "12.3MiB", "1.9GB" or "0B" as bytes.
+// docker prints "--" when it has no value, which reads as zero.
+func ParseBytes(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "--" || s == "" {
+		return 0, nil
+	}
+
+	split := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if split <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	value, err := strconv.ParseFloat(s[:split], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	multiplier, ok := units[strings.ToLower(strings.TrimSpace(s[split:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q", s)
+	}
+	return uint64(value*multiplier + 0.5), nil
+}
+
+// ParseBytePair reads a pair such as "12.3MiB / 1.9GiB".
+func ParseBytePair(s string) (uint64, uint64, error) {
+	first, second, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid pair %q", s)
+	}
+	a, err := ParseBytes(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := ParseBytes(second)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// ParsePercent reads a percentage such as "12.34%".
+func ParsePercent(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "--" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+}
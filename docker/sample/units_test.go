@@ -0,0 +1,79 @@
+package sample
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"0B", 0},
+		{"512B", 512},
+		{"1.2kB", 1200},
+		{"3.4MB", 3400000},
+		{"1.9GB", 1900000000},
+		{"1kiB", 1024},
+		{"12.3MiB", 12897485},
+		{"1.9GiB", 2040109466},
+		{" 1.5 GB ", 1500000000},
+		{"--", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"MiB", "12", "12.3XB", "1.2.3kB", "abc"} {
+		if got, err := ParseBytes(in); err == nil {
+			t.Errorf("ParseBytes(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestParseBytePair(t *testing.T) {
+	tests := []struct {
+		in          string
+		first, last uint64
+	}{
+		{"12.3MiB / 1.9GiB", 12897485, 2040109466},
+		{"1.2kB / 0B", 1200, 0},
+		{"-- / --", 0, 0},
+	}
+	for _, tt := range tests {
+		first, last, err := ParseBytePair(tt.in)
+		if err != nil || first != tt.first || last != tt.last {
+			t.Errorf("ParseBytePair(%q) = %d, %d, %v, want %d, %d", tt.in, first, last, err, tt.first, tt.last)
+		}
+	}
+
+	for _, in := range []string{"1.2kB", "1.2kB / x", "x / 1.2kB"} {
+		if _, _, err := ParseBytePair(in); err == nil {
+			t.Errorf("ParseBytePair(%q) read, want an error", in)
+		}
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"1.23%", 1.23},
+		{"0.00%", 0},
+		{"250.5%", 250.5},
+		{"--", 0},
+	}
+	for _, tt := range tests {
+		got, err := ParsePercent(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePercent(%q) = %g, %v, want %g", tt.in, got, err, tt.want)
+		}
+	}
+
+	if got, err := ParsePercent("abc%"); err == nil {
+		t.Errorf("ParsePercent(\"abc%%\") = %g, want an error", got)
+	}
+}
@@ -0,0 +1,118 @@
+package sample
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Writer is a destination for samples. Writers are safe to use from several
+// goroutines, and must be closed to flush what they buffer.
+type Writer interface {
+	Write(Sample) error
+	Close() error
+}
+
+// Output formats.
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+	FormatInflux  = "influx"
+)
+
+var extensions = map[string]string{
+	FormatCSV:     ".csv",
+	FormatJSONL:   ".jsonl",
+	FormatParquet: ".parquet",
+	FormatInflux:  ".lp",
+}
+
+// Extension is the file extension written for format.
+func Extension(format string) string {
+	return extensions[format]
+}
+
+// FormatOf infers the format from out, an http or https URL being InfluxDB
+// and a file going by its extension.
+func FormatOf(out string) (string, error) {
+	if isURL(out) {
+		return FormatInflux, nil
+	}
+	ext := strings.ToLower(filepath.Ext(out))
+	for format, e := range extensions {
+		if ext == e {
+			return format, nil
+		}
+	}
+	if ext == ".json" || ext == ".ndjson" {
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf("cannot tell the format of %q, name it .csv, .jsonl, .parquet or .lp, or give -format", out)
+}
+
+func isURL(out string) bool {
+	return strings.HasPrefix(out, "http://") || strings.HasPrefix(out, "https://")
+}
+
+// Options tune the writers that need more than a destination.
+type Options struct {
+	// InfluxToken authorises writes to InfluxDB 2 over HTTP
+	InfluxToken string
+	// InfluxFlush is the longest samples are held before being sent over
+	// HTTP
+	InfluxFlush time.Duration
+}
+
+// Open returns a writer of format to out, which is a file path, or for
+// InfluxDB may be the URL of a write endpoint such as
+// http://localhost:8086/api/v2/write?org=lab&bucket=soak.
+func Open(out, format string, opts Options) (Writer, error) {
+	if format == FormatInflux && isURL(out) {
+		return NewInfluxHTTPWriter(out, opts), nil
+	}
+	if isURL(out) {
+		return nil, fmt.Errorf("only the influx format can be sent to a URL")
+	}
+	if _, ok := extensions[format]; !ok {
+		return nil, fmt.Errorf("unknown format %q, use csv, jsonl, parquet or influx", format)
+	}
+
+	if dir := filepath.Dir(out); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+
+	var w Writer
+	switch format {
+	case FormatCSV:
+		w, err = NewCSVWriter(file)
+	case FormatJSONL:
+		w = NewJSONLWriter(file)
+	case FormatParquet:
+		w, err = NewParquetWriter(file)
+	default:
+		w = NewInfluxWriter(file)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// closeUnderlying closes w when it is a file or other closer.
+func closeUnderlying(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
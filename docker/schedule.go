@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// fixedRate paces polling sources on a clock of start + k·interval, so the
+// sample rate does not drift with how long each sample takes to read. A
+// sample that overruns its slot delays only the slots it overlapped, which
+// are skipped rather than taken back to back.
+type fixedRate struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newFixedRate(interval time.Duration) *fixedRate {
+	return &fixedRate{interval: interval, next: time.Now()}
+}
+
+// wait blocks until the next slot and returns how many slots were skipped
+// to reach it, or false once ctx is done.
+func (f *fixedRate) wait(ctx context.Context) (int, bool) {
+	skipped := 0
+	if late := time.Since(f.next); late >= f.interval {
+		skipped = int(late / f.interval)
+		f.next = f.next.Add(time.Duration(skipped) * f.interval)
+	}
+
+	timer := time.NewTimer(time.Until(f.next))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return skipped, false
+	case <-timer.C:
+	}
+
+	f.next = f.next.Add(f.interval)
+	return skipped, true
+}
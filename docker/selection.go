@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/sample"
+
+	"github.com/rs/zerolog/log"
+)
+
+// listFlag is a flag that can be repeated, or given a comma separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// marker is the lifecycle sample written for a discover event.
+func marker(e discover.Event) sample.Sample {
+	return sample.Sample{Time: e.Time, Container: e.Container.ID, Name: e.Container.Name(), Event: e.Action}
+}
+
+// selection is the set of selected containers that are running, kept up to
+// date by watching Docker events in the background. Every start, stop and
+// restart is written to out as a lifecycle marker.
+type selection struct {
+	mu         sync.Mutex
+	containers map[string]*container
+}
+
+// watchSelection lists the containers sel chooses and follows them in the
+// background. prepare is called for each container as it starts, and a
+// container it fails for is not sampled. The returned channel has the
+// watch's error once it ends.
+func watchSelection(ctx context.Context, client *engine.Client, sel discover.Selector, out sample.Writer, prepare func(*container) error) (*selection, <-chan error, error) {
+	s := &selection{containers: map[string]*container{}}
+
+	watcher := discover.NewWatcher(client, sel)
+	running, err := watcher.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(running) == 0 {
+		log.Info().Msg("No selected containers running yet, waiting for them to start")
+	}
+	for _, c := range running {
+		s.add(c, prepare)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watcher.Follow(ctx, func(e discover.Event) {
+			log.Info().Str("container", e.Container.Name()).Str("event", e.Action).Msg("Container event")
+			if err := out.Write(marker(e)); err != nil {
+				log.Error().Err(err).Msg("Error: Could not write container event")
+			}
+
+			switch e.Action {
+			case discover.Start, discover.Restart:
+				s.add(e.Container, prepare)
+			case discover.Stop, discover.Die:
+				s.mu.Lock()
+				delete(s.containers, e.Container.ID)
+				s.mu.Unlock()
+			}
+		})
+	}()
+
+	return s, done, nil
+}
+
+// add starts sampling ec unless it already is.
+func (s *selection) add(ec engine.Container, prepare func(*container) error) {
+	if s.has(ec.ID) {
+		return
+	}
+
+	c := &container{id: ec.ID, name: ec.Name()}
+	if err := prepare(c); err != nil {
+		log.Error().Err(err).Str("container", c.name).Msg("Error: Skipping container")
+		return
+	}
+	log.Info().Str("container", c.name).Msg("Sampling container")
+
+	s.mu.Lock()
+	s.containers[c.id] = c
+	s.mu.Unlock()
+}
+
+// list is the containers to sample now, in name order.
+func (s *selection) list() []*container {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]*container, 0, len(s.containers))
+	for _, c := range s.containers {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+func (s *selection) has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.containers[id]
+	return ok
+}
+
+// watchFailed returns the error that ended watching, if it ended before ctx
+// was done.
+func watchFailed(ctx context.Context, done <-chan error) error {
+	select {
+	case err := <-done:
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			err = errors.New("docker events stream ended")
+		}
+		return err
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"dockerstats/discover"
+	"dockerstats/engine"
+	"dockerstats/engine/enginetest"
+	"dockerstats/sample"
+)
+
+type object = map[string]interface{}
+
+// recorder is a sample.Writer that keeps what it is given.
+type recorder struct {
+	mu      sync.Mutex
+	samples []sample.Sample
+}
+
+func (r *recorder) Write(s sample.Sample) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples = append(r.samples, s)
+	return nil
+}
+
+func (r *recorder) Close() error { return nil }
+
+func TestSelectionWritesMarkers(t *testing.T) {
+	event := func(action, id, name string) object {
+		return object{"Type": "container", "Action": action, "Actor": object{"ID": id, "Attributes": object{"name": name}}, "timeNano": 1700000000e9}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]object{{"Id": "a", "Names": []string{"/exp-a"}, "State": "running"}})
+	})
+	mux.HandleFunc("/containers/", func(w http.ResponseWriter, r *http.Request) {
+		enginetest.Error(w, http.StatusNotFound, "No such container")
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		enginetest.Stream(w,
+			event("start", "b", "exp-b"),
+			event("die", "a", "exp-a"),
+			event("restart", "a", "exp-a"),
+			event("stop", "b", "exp-b"),
+			event("start", "c", "exp-c"),
+		)
+	})
+	client := engine.New(enginetest.Serve(t, mux))
+
+	out := &recorder{}
+	var prepared []string
+	prepare := func(c *container) error {
+		prepared = append(prepared, c.name)
+		return nil
+	}
+	s, done, err := watchSelection(context.Background(), client, discover.Selector{Names: []string{"exp-*"}}, out, prepare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ event, name string }{
+		{"start", "exp-b"}, {"die", "exp-a"}, {"restart", "exp-a"}, {"stop", "exp-b"}, {"start", "exp-c"},
+	}
+	if len(out.samples) != len(want) {
+		t.Fatalf("wrote %+v, want %d markers", out.samples, len(want))
+	}
+	for i, w := range want {
+		if got := out.samples[i]; got.Event != w.event || got.Name != w.name {
+			t.Errorf("marker %d is %s %s, want %s %s", i, got.Event, got.Name, w.event, w.name)
+		}
+	}
+
+	var names []string
+	for _, c := range s.list() {
+		names = append(names, c.name)
+	}
+	if len(names) != 2 || names[0] != "exp-a" || names[1] != "exp-c" {
+		t.Errorf("sampling %q after the events, want exp-a and exp-c", names)
+	}
+	if len(prepared) != 4 {
+		t.Errorf("prepared %q, want exp-a, exp-b, exp-a again after its restart and exp-c", prepared)
+	}
+}
@@ -1,25 +1,24 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math/rand"
 	"net"
-	"time"
 	"os"
 	"strconv"
+	"time"
+
+	"analytics/flow"
+	"analytics/graph"
+	"analytics/seed"
 
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"	
+	"github.com/rs/zerolog/log"
 )
 
-type Flow struct {
-	SourceIP        net.IP
-	DestinationIP   net.IP
-	SourcePort      uint16
-	DestinationPort uint16
-	Protocol        uint8
-	ByteCount       uint32
-}
+// epoch is when the simulated events start.
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
 
 type Node struct {
 	ip    net.IP
@@ -32,30 +31,35 @@ func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
-	if len(os.Args) != 4 {
-		log.Error().Msg("Usage: ./event-gen <duration> <event_per_second> <remote_site_count>")
+	runSeed := flag.Int64("seed", 888, "random seed, the same seed gives the same devices and flows")
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) != 3 && len(args) != 4 {
+		log.Error().Msg("Usage: ./event-gen [-seed n] <duration> <event_per_second> <remote_site_count> [graph.graphml|graph.gexf|graph.dot]")
 		os.Exit(1)
 	}
 
-	durationInt, err := strconv.Atoi(os.Args[1])
+	durationInt, err := strconv.Atoi(args[0])
 	if err != nil {
 		log.Error().Msg("Error: Invalid duration")
 		os.Exit(1)
 	}
 
-	eventsPerSecond, err := strconv.Atoi(os.Args[2])
+	eventsPerSecond, err := strconv.Atoi(args[1])
 	if err != nil {
 		log.Error().Msg("Error: Invalid events per second")
 		os.Exit(1)
 	}
 
-	storeCount, err := strconv.Atoi(os.Args[3])
-	if err != nil {
-		log.Error().Msg("Error: Invalid remote_site_count")
+	storeCount, err := strconv.Atoi(args[2])
+	if err != nil || storeCount <= 0 {
+		log.Error().Msg("Error: Invalid remote_site_count, it must be a positive number of sites")
 		os.Exit(1)
 	}
 
-	rand.Seed(888)
+	log.Info().Int64("seed", *runSeed).Int("duration", durationInt).Int("eventsPerSecond", eventsPerSecond).Int("stores", storeCount).Msg("Generating events")
+
 	officeIP := net.ParseIP("192.168.0.1")
 	officeNode := &Node{ip: officeIP}
 
@@ -67,72 +71,99 @@ func main() {
 		storeNodes[i].edges = append(storeNodes[i].edges, officeNode)
 	}
 
-	storeDevices := createDevicesForStores(storeNodes)
+	storeDevices := createDevicesForStores(seed.New(*runSeed, "devices"), storeNodes)
 	officeDevices := createDevicesForOffice(officeNode)
 
 	duration := time.Duration(durationInt) * time.Second
 
-	flows := generateFlows(storeDevices, officeDevices, duration, eventsPerSecond)
+	flows := generateFlows(seed.New(*runSeed, "flows"), storeDevices, officeDevices, duration, eventsPerSecond)
 
 	observedNodes := make(map[string]int)
 	observedEdges := make(map[string]int)
 
-	for _, flow := range flows {
-		observedNodes[flow.SourceIP.String()] = 1
-		observedNodes[flow.DestinationIP.String()] = 1
+	for _, f := range flows {
+		observedNodes[f.SourceIP.String()] = 1
+		observedNodes[f.DestinationIP.String()] = 1
 
-		observedEdges[flow.SourceIP.String()+flow.DestinationIP.String()] = 1
+		observedEdges[f.SourceIP.String()+f.DestinationIP.String()] = 1
 	}
 
 	fmt.Printf("Total nodes: %d\n", len(observedNodes))
 	fmt.Printf("Total edges: %d\n", len(flows))
 	fmt.Printf("Total Unique edges: %d\n", len(observedEdges))
 
+	if len(args) == 4 {
+		if err := graph.Export(args[3], flows); err != nil {
+			log.Error().Err(err).Msg("Error: Could not export graph")
+			os.Exit(1)
+		}
+		fmt.Printf("Flow graph written to %s\n", args[3])
+	}
+
 }
 
-func generateFlows(storeDevices [][]*Node, officeDevices []*Node, duration time.Duration, eventsPerSecond int) []Flow {
-	var flows []Flow
+func generateFlows(r *rand.Rand, storeDevices [][]*Node, officeDevices []*Node, duration time.Duration, eventsPerSecond int) []flow.Flow {
+	var flows []flow.Flow
 	totalEvents := int(duration.Seconds()) * eventsPerSecond
 
 	officeServer := officeDevices[0] // Designate the first office device as the server
 
+	// Events are spaced evenly across the simulated duration from a fixed
+	// epoch, so the same seed gives the same timestamps on every run
+	runStart := epoch
+
 	for i := 0; i < totalEvents; i++ {
-		storeIndex := rand.Intn(len(storeDevices))
-		deviceIndex := rand.Intn(len(storeDevices[storeIndex]))
+		storeIndex := r.Intn(len(storeDevices))
+		deviceIndex := r.Intn(len(storeDevices[storeIndex]))
+
+		byteCount := randomByteCount(r)
+		startTime := runStart.Add(time.Duration(i) * time.Second / time.Duration(eventsPerSecond))
 
-		flow := Flow{
+		f := flow.Flow{
 			SourceIP:        storeDevices[storeIndex][deviceIndex].ip,
 			DestinationIP:   officeServer.ip, // Change officeDevice to officeServer
-			SourcePort:      randomPort(),
-			DestinationPort: randomPort(),
-			Protocol:        randomProtocol(),
-			ByteCount:       randomByteCount(),
+			SourcePort:      randomPort(r),
+			DestinationPort: randomPort(r),
+			Protocol:        randomProtocol(r),
+			ByteCount:       byteCount,
+			PacketCount:     randomPacketCount(r, byteCount),
+			StartTime:       startTime,
+			EndTime:         startTime.Add(randomFlowDuration(r)),
 		}
-		flows = append(flows, flow)
+		flows = append(flows, f)
 	}
 
 	return flows
 }
 
-func randomPort() uint16 {
-	return uint16(rand.Intn(65535-1024) + 1024)
+func randomPort(r *rand.Rand) uint16 {
+	return uint16(r.Intn(65535-1024) + 1024)
 }
 
-func randomProtocol() uint8 {
+func randomProtocol(r *rand.Rand) uint8 {
 	protocols := []uint8{6, 17} // TCP (6) and UDP (17)
-	return protocols[rand.Intn(len(protocols))]
+	return protocols[r.Intn(len(protocols))]
 }
 
-func randomByteCount() uint32 {
-	return uint32(rand.Intn(10000-100) + 100)
+func randomByteCount(r *rand.Rand) uint32 {
+	return uint32(r.Intn(10000-100) + 100)
 }
 
+func randomPacketCount(r *rand.Rand, byteCount uint32) uint32 {
+	// Assume packets between 64 bytes and a full 1500 byte MTU
+	packetSize := uint32(r.Intn(1500-64) + 64)
+	return byteCount/packetSize + 1
+}
+
+func randomFlowDuration(r *rand.Rand) time.Duration {
+	return time.Duration(r.Intn(5000)) * time.Millisecond
+}
 
-func createDevicesForStores(storeNodes []*Node) [][]*Node {
+func createDevicesForStores(r *rand.Rand, storeNodes []*Node) [][]*Node {
 	storeDevices := make([][]*Node, len(storeNodes))
 
 	for i, storeNode := range storeNodes {
-		numPosDevices := rand.Intn(8) + 5 // Between 5 and 12 POS devices
+		numPosDevices := r.Intn(8) + 5                   // Between 5 and 12 POS devices
 		storeDevices[i] = make([]*Node, numPosDevices+3) // POS devices + inventory + office computer + gateway
 
 		gatewayIP := net.ParseIP(fmt.Sprintf("192.168.%d.254", i+1))
@@ -163,4 +194,4 @@ func createDevicesForOffice(officeNode *Node) []*Node {
 	}
 
 	return officeDevices
-}
\ No newline at end of file
+}
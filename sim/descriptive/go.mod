@@ -2,10 +2,16 @@ module event-gen
 
 go 1.18
 
-require github.com/rs/zerolog v1.29.1
+require (
+	analytics v0.0.0
+	github.com/rs/zerolog v1.29.1
+)
 
 require (
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
+	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 )
+
+// The flow record and the graph export are shared with the analytics
+replace analytics => ../../analytics
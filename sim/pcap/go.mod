@@ -2,11 +2,17 @@ module summarize
 
 go 1.18
 
-require github.com/google/gopacket v1.1.19
+require (
+	analytics v0.0.0
+	github.com/google/gopacket v1.1.19
+	github.com/rs/zerolog v1.29.1
+)
 
 require (
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	github.com/rs/zerolog v1.29.1 // indirect
-	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
+	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
 )
+
+// The seeding of random sources is shared with the analytics
+replace analytics => ../../analytics
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/csv"
+	"flag"
 	"fmt"
 	"math/rand"
 	"net"
@@ -11,6 +12,8 @@ import (
 	"strings"
 	"time"
 
+	"analytics/seed"
+
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
@@ -170,26 +173,30 @@ func main() {
 	observedHosts = make(map[string]int)
 	totalPcapEdges = make(map[string]int)
 
-	rand.Seed(888)
-
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMicro
 
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 
-	if len(os.Args) != 4 {
-		log.Error().Msgf("Usage: ./summarize <path_to_pcap> <output_csv> <num_records_to_generate> %d", len(os.Args))
+	runSeed := flag.Int64("seed", 888, "random seed, the same seed and pcap give the same events")
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) != 3 {
+		log.Error().Msgf("Usage: ./summarize [-seed n] <path_to_pcap> <output_csv> <num_records_to_generate> %d", len(args))
 		os.Exit(1)
 	}
 
-	path := os.Args[1]
-	csvPath := os.Args[2]
+	path := args[0]
+	csvPath := args[1]
 
-	rcdCount, err := strconv.Atoi(os.Args[3])
+	rcdCount, err := strconv.Atoi(args[2])
 
 	if err != nil {
-		log.Error().Msgf("Usage: ./summarize <path_to_pcap> <output_csv> <num_records_to_generate> %d", len(os.Args))
+		log.Error().Msgf("Usage: ./summarize [-seed n] <path_to_pcap> <output_csv> <num_records_to_generate> %d", len(args))
 		os.Exit(1)
 	}
+
+	log.Info().Int64("seed", *runSeed).Str("pcap", path).Str("csv", csvPath).Int("records", rcdCount).Msg("Summarizing")
 	
 	if path == "" {
 		log.Error().Msg("No Pcap Path Provided")
@@ -256,7 +263,15 @@ func main() {
 
 	//displaySubnetStats(subnetStatsMap)
 
-	simulatedEvents := generateSimulatedEvents(subnetStatsMap, hostStatsMap, rcdCount)
+	// Events are spread over the capture's time window, so without it there
+	// is nothing to place them in
+	earliest, latest, err := findTimestamps(path)
+	if err != nil {
+		log.Error().Err(err).Str("pcap", path).Msg("Error: Could not read the capture's timestamps")
+		os.Exit(1)
+	}
+
+	simulatedEvents := generateSimulatedEvents(seed.New(*runSeed, "hosts"), seed.New(*runSeed, "ports"), subnetStatsMap, hostStatsMap, rcdCount, earliest, latest)
 	writeCSV(csvPath, simulatedEvents)
 	//displaySimulatedEvents(simulatedEvents)
 	fmt.Printf("Pcap Host Count: %d\n Edge Count: %d\n", len(hostStatsMap), totalPcapLength)
@@ -269,12 +284,12 @@ func displaySubnetStats(subnetStatsMap map[string]*SubnetStats) {
 	}
 }
 
-func selectRandomItem(items []string, probabilities []float32) string {
+func selectRandomItem(r *rand.Rand, items []string, probabilities []float32) string {
     if len(items) != len(probabilities) {
         return ""
     }
 
-    randVal := rand.Float32()
+    randVal := r.Float32()
     selectedIndex := sort.Search(len(probabilities), func(i int) bool { return probabilities[i] >= randVal })
 
     if selectedIndex >= len(items) {
@@ -285,9 +300,12 @@ func selectRandomItem(items []string, probabilities []float32) string {
 }
 
 
-func generateSimulatedEvents(subnetStatsMap map[string]*SubnetStats, hostStatsMap map[string]*HostStats, recordCount int) []string {
+func generateSimulatedEvents(hostRand, portRand *rand.Rand, subnetStatsMap map[string]*SubnetStats, hostStatsMap map[string]*HostStats, recordCount int, earliest, latest time.Time) []string {
     var simulatedEvents []string
 
+    // Spread the simulated events evenly across the capture window
+    captureWindow := latest.Sub(earliest)
+
     // Prepare subnet selection
     subnetLabels, subnetProbabilities := prepareSelection(subnetStatsMap)
 
@@ -296,18 +314,23 @@ func generateSimulatedEvents(subnetStatsMap map[string]*SubnetStats, hostStatsMa
 
     for i := 0; i < recordCount; i++ {
         // Select source and destination subnets
-        srcSubnet := selectRandomItem(subnetLabels, subnetProbabilities)
-        dstSubnet := selectRandomItem(subnetLabels, subnetProbabilities)
+        srcSubnet := selectRandomItem(hostRand, subnetLabels, subnetProbabilities)
+        dstSubnet := selectRandomItem(hostRand, subnetLabels, subnetProbabilities)
 
         // Select source and destination IPs within the selected subnets
-        srcIP := selectRandomIP(hostLabels, hostProbabilities, srcSubnet)
-        dstIP := selectRandomIP(hostLabels, hostProbabilities, dstSubnet)
+        srcIP := selectRandomIP(hostRand, hostLabels, hostProbabilities, srcSubnet)
+        dstIP := selectRandomIP(hostRand, hostLabels, hostProbabilities, dstSubnet)
 
         // Select source and destination ports, and protocol
-        srcPort, dstPort, protocol, bytes := selectPortsAndProtocol(hostStatsMap[srcIP], hostStatsMap[dstIP])
+        srcPort, dstPort, protocol, bytes := selectPortsAndProtocol(portRand, hostStatsMap[srcIP], hostStatsMap[dstIP])
+
+        // Each event carries the average packet size of its ports, so it stands for a single packet
+        startTime := earliest.Add(captureWindow * time.Duration(i) / time.Duration(recordCount))
+        endTime := startTime
+        packets := 1
 
         // Create simulated network event
-        event := fmt.Sprintf("%s, %s, %d, %d, %s, %d", srcIP, dstIP, srcPort, dstPort, protocol, bytes)
+        event := fmt.Sprintf("%s, %s, %d, %d, %s, %d, %d, %d, %d", srcIP, dstIP, srcPort, dstPort, protocol, bytes, packets, startTime.UnixMicro(), endTime.UnixMicro())
 		//if srcPort <=10000 || dstPort <=10000{
         	simulatedEvents = append(simulatedEvents, event)
 			observedHosts[srcIP] = 1
@@ -318,7 +341,7 @@ func generateSimulatedEvents(subnetStatsMap map[string]*SubnetStats, hostStatsMa
     return simulatedEvents
 }
 
-func selectRandomIP(ips []string, probabilities []float32, subnet string) string {
+func selectRandomIP(r *rand.Rand, ips []string, probabilities []float32, subnet string) string {
     var filteredIPs []string
     var filteredProbabilities []float32
 
@@ -330,17 +353,17 @@ func selectRandomIP(ips []string, probabilities []float32, subnet string) string
         }
     }
 
-    return selectRandomItem(filteredIPs, filteredProbabilities)
+    return selectRandomItem(r, filteredIPs, filteredProbabilities)
 }
 
-func selectPortsAndProtocol(srcHostStats, dstHostStats *HostStats) (uint16, uint16, string, int) {
+func selectPortsAndProtocol(r *rand.Rand, srcHostStats, dstHostStats *HostStats) (uint16, uint16, string, int) {
     var protocol string
     var srcPort, dstPort uint16
 	var bytes int
 
     if srcHostStats == nil || dstHostStats == nil {
-        srcPort = uint16(rand.Intn(65536))
-        dstPort = uint16(rand.Intn(65536))
+        srcPort = uint16(r.Intn(65536))
+        dstPort = uint16(r.Intn(65536))
         protocol = "TCP"
 
         return srcPort, dstPort, protocol, 0
@@ -383,9 +406,13 @@ func selectPortsAndProtocol(srcHostStats, dstHostStats *HostStats) (uint16, uint
 	selectRandomPort := func(portUsage map[uint16]int) uint16 {
 		var ports []uint16
 		var counts []int
-		for port, count := range portUsage {
+		for port := range portUsage {
 			ports = append(ports, port)
-			counts = append(counts, count)
+		}
+		// Map order is random, so sort for the seed to give the same ports
+		sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+		for _, port := range ports {
+			counts = append(counts, portUsage[port])
 		}
 	
 		totalSum := 0
@@ -402,7 +429,7 @@ func selectPortsAndProtocol(srcHostStats, dstHostStats *HostStats) (uint16, uint
 			probabilities[idx] = compoundingBase
 		}
 	
-		randVal := rand.Float32()
+		randVal := r.Float32()
 		selectedIndex := sort.Search(len(probabilities), func(i int) bool { return probabilities[i] > randVal })
 	
 		if selectedIndex >= len(ports) {
@@ -475,6 +502,20 @@ func prepareSelection(statsMap interface{}) ([]string, []float32) {
         return nil, nil
     }
 
+    // Map order is random, so sort for the seed to give the same selections
+    order := make([]int, len(labels))
+    for i := range order {
+        order[i] = i
+    }
+    sort.Slice(order, func(i, j int) bool { return labels[order[i]] < labels[order[j]] })
+    sortedLabels := make([]string, len(labels))
+    sortedCounts := make([]int, len(counts))
+    for i, idx := range order {
+        sortedLabels[i] = labels[idx]
+        sortedCounts[i] = counts[idx]
+    }
+    labels, counts = sortedLabels, sortedCounts
+
     totalSum := 0
     for _, count := range counts {
         totalSum += count
@@ -563,6 +604,9 @@ func findTimestamps(filename string) (time.Time, time.Time, error) {
 		}
 	}
 
+	if earliest.IsZero() {
+		return earliest, latest, fmt.Errorf("%s has no packets", filename)
+	}
 	return earliest, latest, nil
 }
 